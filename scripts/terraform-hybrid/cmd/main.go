@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/commands"
 
@@ -14,15 +18,24 @@ import (
 var CLI struct {
 	GenerateBackend commands.GenerateBackendCmd `cmd:"" help:"Generate backend.tf files for a given config and provider folder."`
 	Workspace       commands.WorkspaceCmd       `cmd:"" help:"Manage Terraform workspaces (create, select, list, delete)."`
+	Run             commands.RunCmd             `cmd:"" help:"Run terraform init, plan, apply, validate or destroy in every discovered root module."`
+	Config          commands.ConfigCmd          `cmd:"" help:"Inspect and validate the config file format."`
+	Pg              commands.PgCmd              `cmd:"" help:"Bootstrap and check the database of the pg backend."`
+	State           commands.StateCmd           `cmd:"" help:"Inspect the states of the configured backends."`
 }
 
 func main() {
+	// Cancel running operations on SIGINT/SIGTERM so they can stop between folders
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize Kong and parse CLI arguments
-	ctx := kong.Parse(&CLI)
+	kongCtx := kong.Parse(&CLI, kong.BindTo(ctx, (*context.Context)(nil)))
 
 	// Run the appropriate command handler
-	err := ctx.Run(&CLI)
+	err := kongCtx.Run(&CLI)
 	if err != nil {
+		stop()
 		log.Fatalf("Error: %v", err)
 	}
 }
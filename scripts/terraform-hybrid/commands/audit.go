@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/audit"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/backend"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+)
+
+// newCaller returns the cloud identity of the provider of audit.provider or the config file name,
+// aws when no config file is given, and the OS user when the provider has none
+func newCaller(loadedConfig *config.TerraformHybridConfig, configPath string, out io.Writer) clients.Caller {
+	provider := loadedConfig.Audit.Provider
+	switch {
+	case provider != "":
+	case configPath != "":
+		provider = backend.ConfigProvider(configPath)
+	default:
+		provider = "aws"
+	}
+
+	caller, err := clients.NewCaller(provider)
+	if err != nil {
+		fmt.Fprintf(out, "Warning: %v, using the OS user instead\n", err)
+		return &clients.OSUserCaller{}
+	}
+	return caller
+}
+
+// openAudit resolves who runs the command and opens the audit log of the config
+func openAudit(loadedConfig *config.TerraformHybridConfig, caller clients.Caller, out io.Writer) *audit.Log {
+	return audit.NewLog(loadedConfig.Audit.Log, clients.ResolveIdentity(caller, out))
+}
+
+// openConfigAudit opens the audit log of a loaded config, resolving the caller from it unless given
+func openConfigAudit(loadedConfig *config.TerraformHybridConfig, configPath string, caller clients.Caller, out io.Writer) *audit.Log {
+	if caller == nil {
+		caller = newCaller(loadedConfig, configPath, out)
+	}
+	return openAudit(loadedConfig, caller, out)
+}
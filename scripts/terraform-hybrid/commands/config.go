@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+)
+
+// ConfigCmd groups the commands working on the config file format
+type ConfigCmd struct {
+	Schema   ConfigSchemaCmd   `cmd:"" help:"Print the JSON Schema of the config file format."`
+	Validate ConfigValidateCmd `cmd:"" help:"Validate config files against the JSON Schema."`
+}
+
+// ConfigSchemaCmd defines the structure for the config schema command
+type ConfigSchemaCmd struct {
+	Output string `help:"Write the schema to this file instead of stdout." type:"path"`
+}
+
+// Run prints the JSON Schema or writes it to the output file
+func (c *ConfigSchemaCmd) Run() error {
+	schema, err := config.GenerateSchema()
+	if err != nil {
+		return fmt.Errorf("error generating schema: %w", err)
+	}
+
+	if c.Output == "" {
+		fmt.Println(string(schema))
+		return nil
+	}
+
+	if err := os.WriteFile(c.Output, append(schema, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing schema file %s: %w", c.Output, err)
+	}
+
+	fmt.Printf("Successfully wrote schema to %s\n", c.Output)
+	return nil
+}
+
+// ConfigValidateCmd defines the structure for the config validate command
+type ConfigValidateCmd struct {
+	Files []string `arg:"" help:"Config files to validate." type:"existingfile"`
+}
+
+// Run validates every config file and fails if any of them is invalid
+func (c *ConfigValidateCmd) Run() error {
+	validator, err := config.NewSchemaValidator()
+	if err != nil {
+		return err
+	}
+
+	invalid := 0
+	for _, file := range c.Files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading config file %s: %w", file, err)
+		}
+
+		violations, err := validator.Validate(data)
+		if err != nil {
+			return fmt.Errorf("error validating config file %s: %w", file, err)
+		}
+
+		if len(violations) == 0 {
+			fmt.Printf("%s: valid\n", file)
+			continue
+		}
+
+		invalid++
+		fmt.Printf("%s: invalid\n", file)
+		for _, violation := range violations {
+			fmt.Printf("  %s\n", violation)
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d config files are invalid", invalid, len(c.Files))
+	}
+	return nil
+}
@@ -1,34 +1,75 @@
 package commands
 
 import (
+	"context"
 	"fmt"
+	"os"
 
 	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/backend"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients"
 	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
 	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
 )
 
 // GenerateBackendCmd defines the structure for the GenerateBackend command
 type GenerateBackendCmd struct {
-	Config         string `help:"Path to the YAML config file." required:"true" type:"path"`
-	ProviderFolder string `help:"Path to the provider folder." required:"true" type:"path"`
+	Config         string   `help:"Path to the YAML config file." required:"true" type:"path"`
+	ProviderFolder string   `help:"Path to the provider folder. Defaults to the layout root from the config." type:"path"`
+	Account        []string `help:"Only process folders of these accounts." sep:","`
+	Include        []string `help:"Only process folders whose path relative to the provider folder matches one of these globs." sep:","`
+	Exclude        []string `help:"Skip folders whose path relative to the provider folder matches one of these globs." sep:","`
+	ChangedSince   string   `help:"Only process folders with files changed since this git ref." placeholder:"GIT-REF"`
+	Parallelism    int      `help:"Number of folders processed concurrently." default:"1"`
+	Atomic         bool     `help:"Roll every folder back to its previous backend.tf if any folder fails, or on the next run if this one is killed." default:"true" negatable:""`
+	Binary         string   `help:"Terraform or tofu binary to generate configuration for. Overrides $TERRAFORM_BINARY and tool.binary from the config."`
+	VerifyAccounts bool     `help:"Refuse to continue when the active cloud credentials act in another account than configured for the selected folders." default:"true" negatable:""`
+	CallerHeader   bool     `help:"Name the caller in a header of every generated backend.tf, so the file changes with whoever runs the generation."`
+
+	caller clients.Caller
 }
 
 // Run executes the logic for the GenerateBackend command
-func (g *GenerateBackendCmd) Run() error {
+func (g *GenerateBackendCmd) Run(ctx context.Context) error {
 	fmt.Printf("Using config file: %s\n", g.Config)
 	fmt.Printf("Using provider folder: %s\n", g.ProviderFolder)
 
 	// Initialize the config loader and utilities
 	configLoader := config.NewConfigLoader()
+	loadedConfig, err := configLoader.LoadConfig(ctx, g.Config)
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
 	folderFinder := utils.NewFolderFinder()
 	backendFactory := backend.NewBackendFactory()
 
+	if g.caller == nil {
+		g.caller = newCaller(loadedConfig, g.Config, os.Stdout)
+	}
+
 	// Create the backend manager
 	manager := backend.NewTerraformBackendManager(configLoader, folderFinder, *backendFactory)
 
 	// Generate the backend configuration
-	if err := manager.GenerateBackends(g.Config, g.ProviderFolder); err != nil {
+	opts := backend.GenerateOptions{
+		ProviderFolder: g.ProviderFolder,
+		Filter: utils.FolderFilter{
+			Accounts:     g.Account,
+			Include:      g.Include,
+			Exclude:      g.Exclude,
+			ChangedSince: g.ChangedSince,
+		},
+		Parallelism:  g.Parallelism,
+		Atomic:       g.Atomic,
+		JournalPath:  backend.DefaultJournalPath,
+		Binary:       g.Binary,
+		Config:       loadedConfig,
+		Audit:        openAudit(loadedConfig, g.caller, os.Stdout),
+		CallerHeader: g.CallerHeader,
+	}
+	if g.VerifyAccounts {
+		opts.Caller = g.caller
+	}
+	if err := manager.GenerateBackends(ctx, g.Config, opts); err != nil {
 		return fmt.Errorf("error generating backends: %w", err)
 	}
 
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/postgres"
+)
+
+// PgCmd groups the commands working on the database of the pg backend
+type PgCmd struct {
+	Bootstrap PgBootstrapCmd `cmd:"" help:"Create the schema, sequence, states table and index of the pg backend and check the privileges on them."`
+	Doctor    PgDoctorCmd    `cmd:"" help:"Check that the database matches what terraform's pg backend expects, e.g. for skip_*_creation = true."`
+	History   PgHistoryCmd   `cmd:"" help:"List, show and restore recorded versions of workspace states."`
+	Lock      PgLockCmd      `cmd:"" help:"Inspect and release the advisory locks of workspaces."`
+}
+
+// PgBootstrapCmd defines the structure for the pg bootstrap command
+type PgBootstrapCmd struct {
+	Config  string `help:"Path to the YAML config file with a postgres backend." required:"true" type:"path"`
+	History bool   `help:"Also install the states_history table and the trigger recording every state terraform writes."`
+
+	schema *postgres.Schema
+	stdout io.Writer
+}
+
+// Run creates the missing objects of the pg backend and checks the privileges of the connected user
+func (p *PgBootstrapCmd) Run(ctx context.Context) error {
+	schema, _, err := openSchema(ctx, p.Config, p.schema)
+	if err != nil {
+		return err
+	}
+	defer schema.Close()
+
+	out := outputOrStdout(p.stdout)
+	checks, err := schema.Bootstrap(ctx, p.History, out)
+	if err != nil {
+		return err
+	}
+	if err := printChecks(out, checks); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Schema %s is ready for the pg backend\n", schema.Name())
+	return nil
+}
+
+// PgDoctorCmd defines the structure for the pg doctor command
+type PgDoctorCmd struct {
+	Config string `help:"Path to the YAML config file with a postgres backend." required:"true" type:"path"`
+
+	schema *postgres.Schema
+	stdout io.Writer
+}
+
+// Run checks the objects of the pg backend and the privileges of the connected user
+func (p *PgDoctorCmd) Run(ctx context.Context) error {
+	schema, _, err := openSchema(ctx, p.Config, p.schema)
+	if err != nil {
+		return err
+	}
+	defer schema.Close()
+
+	checks, err := schema.Doctor(ctx)
+	if err != nil {
+		return err
+	}
+	return printChecks(outputOrStdout(p.stdout), checks)
+}
+
+// openSchema loads the config and connects to its pg backend, unless a schema is already given
+func openSchema(ctx context.Context, configPath string, schema *postgres.Schema) (*postgres.Schema, *config.TerraformHybridConfig, error) {
+	loadedConfig, err := config.NewConfigLoader().LoadConfig(ctx, configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading config: %v", err)
+	}
+	backend, ok := loadedConfig.Global.Backend.(*config.PostgresBackendConfig)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s has backend_type %s, pg commands need %s", configPath, loadedConfig.Global.BackendType, config.BackendTypePostgres)
+	}
+
+	if schema != nil {
+		return schema, loadedConfig, nil
+	}
+	schema, err = postgres.Open(backend.ConnectionString, backend.SchemaName)
+	return schema, loadedConfig, err
+}
+
+// printChecks prints the outcome of every check and fails if any of them failed
+func printChecks(out io.Writer, checks []postgres.Check) error {
+	for _, check := range checks {
+		if check.Problem == "" {
+			fmt.Fprintf(out, "ok    %s\n", check.Name)
+		} else {
+			fmt.Fprintf(out, "FAIL  %s: %s\n", check.Name, check.Problem)
+		}
+	}
+
+	if failed := postgres.Failed(checks); failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// outputOrStdout returns the output of a command, stdout unless set
+func outputOrStdout(out io.Writer) io.Writer {
+	if out == nil {
+		return os.Stdout
+	}
+	return out
+}
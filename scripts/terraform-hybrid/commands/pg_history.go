@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/audit"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/postgres"
+)
+
+// PgHistoryCmd groups the commands working on the states_history table installed by pg bootstrap --history
+type PgHistoryCmd struct {
+	List    PgHistoryListCmd    `cmd:"" help:"List the recorded versions of the state of a workspace."`
+	Show    PgHistoryShowCmd    `cmd:"" help:"Print a recorded version of the state of a workspace."`
+	Restore PgHistoryRestoreCmd `cmd:"" help:"Make a recorded version the current state of a workspace."`
+}
+
+// PgHistoryListCmd defines the structure for the pg history list command
+type PgHistoryListCmd struct {
+	Config    string `help:"Path to the YAML config file with a postgres backend." required:"true" type:"path"`
+	Workspace string `help:"Workspace whose versions are listed." required:"true"`
+
+	schema *postgres.Schema
+	stdout io.Writer
+}
+
+// Run prints the recorded versions of the workspace, oldest first
+func (p *PgHistoryListCmd) Run(ctx context.Context) error {
+	schema, _, err := openSchema(ctx, p.Config, p.schema)
+	if err != nil {
+		return err
+	}
+	defer schema.Close()
+
+	versions, err := schema.History(ctx, p.Workspace)
+	if err != nil {
+		return err
+	}
+	out := outputOrStdout(p.stdout)
+	if len(versions) == 0 {
+		fmt.Fprintf(out, "No recorded versions of workspace %s, is the history installed with pg bootstrap --history?\n", p.Workspace)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERIAL\tRECORDED\tLINEAGE\tSIZE")
+	for _, version := range versions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", formatSerial(version), version.RecordedAt.UTC().Format(time.RFC3339), version.Lineage, version.Size)
+	}
+	return tw.Flush()
+}
+
+// PgHistoryShowCmd defines the structure for the pg history show command
+type PgHistoryShowCmd struct {
+	Config    string    `help:"Path to the YAML config file with a postgres backend." required:"true" type:"path"`
+	Workspace string    `help:"Workspace whose version is shown." required:"true"`
+	Serial    int64     `help:"Show the version with this serial."`
+	At        time.Time `help:"Show the version that was current at this RFC 3339 time, e.g. 2024-05-01T12:00:00Z."`
+
+	schema *postgres.Schema
+	stdout io.Writer
+}
+
+// Run prints the state of the selected version, the latest without --serial and --at
+func (p *PgHistoryShowCmd) Run(ctx context.Context) error {
+	schema, _, err := openSchema(ctx, p.Config, p.schema)
+	if err != nil {
+		return err
+	}
+	defer schema.Close()
+
+	_, state, err := schema.Version(ctx, postgres.VersionQuery{Workspace: p.Workspace, Serial: p.Serial, At: p.At})
+	if err != nil {
+		return err
+	}
+	_, err = outputOrStdout(p.stdout).Write(state)
+	return err
+}
+
+// PgHistoryRestoreCmd defines the structure for the pg history restore command
+type PgHistoryRestoreCmd struct {
+	Config    string    `help:"Path to the YAML config file with a postgres backend." required:"true" type:"path"`
+	Workspace string    `help:"Workspace whose state is restored." required:"true"`
+	Serial    int64     `help:"Restore the version with this serial."`
+	At        time.Time `help:"Restore the version that was current at this RFC 3339 time, e.g. 2024-05-01T12:00:00Z."`
+	Yes       bool      `help:"Confirm replacing the current state of the workspace."`
+
+	schema *postgres.Schema
+	caller clients.Caller
+	audit  *audit.Log
+	stdout io.Writer
+}
+
+// Run replaces the current state of the workspace with the selected version once confirmed with --yes
+func (p *PgHistoryRestoreCmd) Run(ctx context.Context) error {
+	if p.Serial == 0 && p.At.IsZero() {
+		return fmt.Errorf("choose the version to restore with --serial or --at")
+	}
+
+	schema, loadedConfig, err := openSchema(ctx, p.Config, p.schema)
+	if err != nil {
+		return err
+	}
+	defer schema.Close()
+
+	out := outputOrStdout(p.stdout)
+	query := postgres.VersionQuery{Workspace: p.Workspace, Serial: p.Serial, At: p.At}
+	if !p.Yes {
+		version, _, err := schema.Version(ctx, query)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Would restore serial %s of workspace %s recorded at %s\n",
+			formatSerial(*version), p.Workspace, version.RecordedAt.UTC().Format(time.RFC3339))
+		return fmt.Errorf("restoring replaces the current state of workspace %s, pass --yes to confirm", p.Workspace)
+	}
+
+	if p.audit == nil {
+		p.audit = openConfigAudit(loadedConfig, p.Config, p.caller, out)
+	}
+
+	version, err := schema.Restore(ctx, query, out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Restored serial %s of workspace %s recorded at %s\n",
+		formatSerial(*version), p.Workspace, version.RecordedAt.UTC().Format(time.RFC3339))
+	return p.audit.Record("pg-history-restore", schema.Name(), fmt.Sprintf("workspace %s serial %s", p.Workspace, formatSerial(*version)))
+}
+
+// formatSerial returns the serial of a version, - for states without one
+func formatSerial(version postgres.Version) string {
+	if !version.Serial.Valid {
+		return "-"
+	}
+	return fmt.Sprint(version.Serial.Int64)
+}
@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/audit"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/postgres"
+)
+
+// PgLockCmd groups the commands working on the advisory locks of the pg backend
+type PgLockCmd struct {
+	List    PgLockListCmd    `cmd:"" help:"List the locked workspaces with the database sessions holding their locks."`
+	Release PgLockReleaseCmd `cmd:"" help:"Release the lock of a workspace or the creation lock by terminating the database session holding it."`
+}
+
+// PgLockListCmd defines the structure for the pg lock list command
+type PgLockListCmd struct {
+	Config string `help:"Path to the YAML config file with a postgres backend." required:"true" type:"path"`
+
+	schema *postgres.Schema
+	stdout io.Writer
+}
+
+// Run prints the held locks
+func (p *PgLockListCmd) Run(ctx context.Context) error {
+	schema, _, err := openSchema(ctx, p.Config, p.schema)
+	if err != nil {
+		return err
+	}
+	defer schema.Close()
+
+	locks, err := schema.Locks(ctx)
+	if err != nil {
+		return err
+	}
+	out := outputOrStdout(p.stdout)
+	if len(locks) == 0 {
+		fmt.Fprintf(out, "No workspace of schema %s is locked\n", schema.Name())
+		return nil
+	}
+	return printLocks(out, locks)
+}
+
+// PgLockReleaseCmd defines the structure for the pg lock release command
+type PgLockReleaseCmd struct {
+	Config       string `help:"Path to the YAML config file with a postgres backend." required:"true" type:"path"`
+	Workspace    string `help:"Workspace whose lock is released."`
+	CreationLock bool   `help:"Release the lock terraform holds while creating a workspace instead of the lock of a workspace."`
+	Yes          bool   `help:"Confirm terminating the sessions holding the lock, aborting whatever they run."`
+
+	schema *postgres.Schema
+	caller clients.Caller
+	audit  *audit.Log
+	stdout io.Writer
+}
+
+// Run terminates the sessions holding the lock of the workspace or the creation lock once confirmed with --yes
+func (p *PgLockReleaseCmd) Run(ctx context.Context) error {
+	if (p.Workspace == "") == !p.CreationLock {
+		return fmt.Errorf("pass either --workspace or --creation-lock")
+	}
+	schema, loadedConfig, err := openSchema(ctx, p.Config, p.schema)
+	if err != nil {
+		return err
+	}
+	defer schema.Close()
+
+	var locks []postgres.Lock
+	if p.CreationLock {
+		locks, err = schema.CreationLocks(ctx)
+	} else {
+		locks, err = schema.WorkspaceLocks(ctx, p.Workspace)
+	}
+	if err != nil {
+		return err
+	}
+	out := outputOrStdout(p.stdout)
+	if err := printLocks(out, locks); err != nil {
+		return err
+	}
+	if !p.Yes {
+		return fmt.Errorf("releasing the lock terminates the sessions above, check that their terraform runs are gone and pass --yes to confirm")
+	}
+
+	if p.audit == nil {
+		p.audit = openConfigAudit(loadedConfig, p.Config, p.caller, out)
+	}
+
+	for _, lock := range locks {
+		if err := schema.Terminate(ctx, lock); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Terminated backend PID %d holding %s\n", lock.PID, lock)
+		if err := p.audit.Record("pg-lock-release", schema.Name(), fmt.Sprintf("%s held by PID %d of %s (%s)", lockSubject(lock), lock.PID, lock.User, lock.ApplicationName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockSubject names what a lock protects in the audit log
+func lockSubject(lock postgres.Lock) string {
+	if lock.Key == postgres.CreationLockKey {
+		return "creation lock"
+	}
+	return "workspace " + lock.Workspace
+}
+
+// printLocks prints a table of locks and the sessions holding them
+func printLocks(out io.Writer, locks []postgres.Lock) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKSPACE\tPID\tUSER\tAPPLICATION\tCLIENT\tSTATE\tCONNECTED\tLAST ACTIVITY")
+	for _, lock := range locks {
+		workspace := lock.Workspace
+		if workspace == "" {
+			workspace = "(creating a workspace)"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", workspace, lock.PID, lock.User, lock.ApplicationName,
+			lock.ClientAddr, lock.State, formatTime(lock.BackendStart.Time, lock.BackendStart.Valid), formatTime(lock.StateChange.Time, lock.StateChange.Valid))
+	}
+	return tw.Flush()
+}
+
+// formatTime returns a time in RFC 3339, - when it is unknown
+func formatTime(t time.Time, valid bool) string {
+	if !valid {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/audit"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/postgres"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PgCmd", func() {
+	var (
+		root   string
+		stdout *bytes.Buffer
+	)
+
+	// writeConfig writes a config with the given global section
+	writeConfig := func(global string) string {
+		configFile := filepath.Join(root, "aws.yaml")
+		Expect(os.WriteFile(configFile, []byte("global:\n"+global), 0644)).To(Succeed())
+		return configFile
+	}
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+		stdout = &bytes.Buffer{}
+	})
+
+	It("should refuse configs without a postgres backend", func() {
+		cmd := &PgDoctorCmd{Config: writeConfig("  backend_type: local\n  backend:\n    path: state\n"), stdout: stdout}
+		Expect(cmd.Run(context.Background())).To(MatchError(ContainSubstring("has backend_type local, pg commands need postgres")))
+	})
+
+	It("should print every check and fail when one fails", func() {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		Expect(err).NotTo(HaveOccurred())
+		mock.ExpectQuery(`SELECT count(1) FROM information_schema.schemata WHERE schema_name = $1`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(`SELECT to_regclass($1) IS NOT NULL`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(`SELECT column_name, data_type, COALESCE(column_default, '') FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2`).
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "column_default"}).
+				AddRow("id", "bigint", "nextval('global_states_id_seq'::regclass)").
+				AddRow("name", "text", "").
+				AddRow("data", "text", ""))
+		mock.ExpectQuery(`SELECT count(1) FROM pg_indexes WHERE schemaname = $1 AND tablename = $2 AND indexname = $3`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectClose()
+
+		cmd := &PgDoctorCmd{
+			Config: writeConfig("  backend_type: postgres\n  backend:\n    connection_string: postgres://localhost/terraform_backend\n    schema_name: terraform_remote_state\n"),
+			schema: postgres.NewSchema(db, "terraform_remote_state"),
+			stdout: stdout,
+		}
+		Expect(cmd.Run(context.Background())).To(MatchError("1 of 4 checks failed"))
+		Expect(stdout.String()).To(Equal(`ok    schema terraform_remote_state exists
+FAIL  sequence public.global_states_id_seq exists: the id column of the states table draws from it, run pg bootstrap or create it
+ok    table terraform_remote_state.states has the id, name and data columns
+ok    index states_by_name exists
+`))
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+	})
+
+	Describe("history restore", func() {
+		var (
+			mock sqlmock.Sqlmock
+			cmd  *PgHistoryRestoreCmd
+		)
+
+		BeforeEach(func() {
+			db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			Expect(err).NotTo(HaveOccurred())
+			mock = sqlMock
+			mock.ExpectQuery(`SELECT id, name, serial, COALESCE(lineage, ''), recorded_at, COALESCE(data, '')
+FROM "terraform_remote_state".states_history WHERE name = $1 AND serial = $2 ORDER BY recorded_at DESC, id DESC LIMIT 1`).
+				WithArgs("aws_dev_network", int64(3)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "serial", "lineage", "recorded_at", "data"}).
+					AddRow(7, "aws_dev_network", 3, "lineage", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), `{"serial": 3}`))
+
+			cmd = &PgHistoryRestoreCmd{
+				Config:    writeConfig("  backend_type: postgres\n  backend:\n    connection_string: postgres://localhost/terraform_backend\n    schema_name: terraform_remote_state\n"),
+				Workspace: "aws_dev_network",
+				Serial:    3,
+				schema:    postgres.NewSchema(db, "terraform_remote_state"),
+				audit:     audit.NewLog(filepath.Join(root, "audit.log"), "alice"),
+				stdout:    stdout,
+			}
+		})
+
+		It("should require --yes before replacing the state", func() {
+			mock.ExpectClose()
+
+			Expect(cmd.Run(context.Background())).To(MatchError("restoring replaces the current state of workspace aws_dev_network, pass --yes to confirm"))
+			Expect(stdout.String()).To(Equal("Would restore serial 3 of workspace aws_dev_network recorded at 2024-05-01T12:00:00Z\n"))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+
+		It("should restore the version and record it in the audit log", func() {
+			cmd.Yes = true
+			mock.ExpectQuery(`SELECT id, pg_try_advisory_lock(id), data FROM "terraform_remote_state".states WHERE name = $1`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "locked", "data"}).AddRow(42, true, `{"serial": 5}`))
+			mock.ExpectExec(`UPDATE "terraform_remote_state".states SET data = $1 WHERE id = $2`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`SELECT pg_advisory_unlock($1)`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectClose()
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+			Expect(stdout.String()).To(Equal("Restored serial 3 of workspace aws_dev_network recorded at 2024-05-01T12:00:00Z\n"))
+			events, err := os.ReadFile(filepath.Join(root, "audit.log"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(events)).To(ContainSubstring(`"who":"alice","operation":"pg-history-restore","folder":"terraform_remote_state","detail":"workspace aws_dev_network serial 3"`))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
+
+	Describe("lock release", func() {
+		var (
+			mock sqlmock.Sqlmock
+			cmd  *PgLockReleaseCmd
+		)
+
+		BeforeEach(func() {
+			db, sqlMock, err := sqlmock.New()
+			Expect(err).NotTo(HaveOccurred())
+			mock = sqlMock
+			since := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			mock.ExpectQuery(`FROM pg_locks`).
+				WillReturnRows(sqlmock.NewRows([]string{"name", "key", "pid", "usename", "application_name", "client_addr", "state", "backend_start", "state_change"}).
+					AddRow("", -1, 4711, "ci", "terraform", "10.0.0.7", "idle", since, since).
+					AddRow("aws_dev_network", 3, 4242, "ci", "terraform", "10.0.0.8", "idle", since, since))
+
+			cmd = &PgLockReleaseCmd{
+				Config:    writeConfig("  backend_type: postgres\n  backend:\n    connection_string: postgres://localhost/terraform_backend\n    schema_name: terraform_remote_state\n"),
+				Workspace: "aws_dev_network",
+				schema:    postgres.NewSchema(db, "terraform_remote_state"),
+				audit:     audit.NewLog(filepath.Join(root, "audit.log"), "alice"),
+				stdout:    stdout,
+			}
+		})
+
+		It("should require --yes before terminating the sessions", func() {
+			mock.ExpectClose()
+
+			Expect(cmd.Run(context.Background())).To(MatchError(ContainSubstring("pass --yes to confirm")))
+			Expect(stdout.String()).To(ContainSubstring("aws_dev_network  4242  ci    terraform"))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+
+		It("should terminate the session holding the lock and record it in the audit log", func() {
+			cmd.Yes = true
+			mock.ExpectQuery(`SELECT pg_terminate_backend`).WithArgs(4242, 3).
+				WillReturnRows(sqlmock.NewRows([]string{"terminated"}).AddRow(true))
+			mock.ExpectClose()
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+			Expect(stdout.String()).To(ContainSubstring("Terminated backend PID 4242 holding the lock of workspace aws_dev_network\n"))
+			events, err := os.ReadFile(filepath.Join(root, "audit.log"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(events)).To(ContainSubstring(`"operation":"pg-lock-release","folder":"terraform_remote_state","detail":"workspace aws_dev_network held by PID 4242 of ci (terraform)"`))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+
+		It("should release the creation lock", func() {
+			cmd.Workspace = ""
+			cmd.CreationLock = true
+			cmd.Yes = true
+			mock.ExpectQuery(`SELECT pg_terminate_backend`).WithArgs(4711, -1).
+				WillReturnRows(sqlmock.NewRows([]string{"terminated"}).AddRow(true))
+			mock.ExpectClose()
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+			Expect(stdout.String()).NotTo(ContainSubstring("4242"))
+			Expect(stdout.String()).To(ContainSubstring("Terminated backend PID 4711 holding the creation lock\n"))
+			events, err := os.ReadFile(filepath.Join(root, "audit.log"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(events)).To(ContainSubstring(`"detail":"creation lock held by PID 4711 of ci (terraform)"`))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+
+		It("should require exactly one of --workspace and --creation-lock", func() {
+			cmd.CreationLock = true
+
+			Expect(cmd.Run(context.Background())).To(MatchError("pass either --workspace or --creation-lock"))
+		})
+	})
+})
@@ -0,0 +1,350 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/audit"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/backend"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/aws"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/plan"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/terraform"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+)
+
+// RunCmd defines the structure for the Run command
+type RunCmd struct {
+	Command        string   `arg:"" help:"Terraform subcommand to run in every root module." enum:"init,plan,apply,validate,destroy"`
+	Args           []string `arg:"" optional:"" passthrough:"" help:"Extra arguments passed to the terraform subcommand after --."`
+	Config         string   `help:"Path to the YAML config file." required:"true" type:"path"`
+	ProviderFolder string   `help:"Path to the provider folder. Defaults to the layout root from the config." type:"path"`
+	Account        []string `help:"Only run in folders of these accounts." sep:","`
+	Include        []string `help:"Only run in folders whose path relative to the provider folder matches one of these globs." sep:","`
+	Exclude        []string `help:"Skip folders whose path relative to the provider folder matches one of these globs." sep:","`
+	ChangedSince   string   `help:"Only run in folders with files changed since this git ref." placeholder:"GIT-REF"`
+	Parallelism    int      `help:"Number of folders processed concurrently." default:"1"`
+	FailFast       bool     `help:"Stop starting new folders after the first failure instead of continuing with the rest."`
+	LogDir         string   `help:"Write the output of every folder to a log file named after its path and a hash of it in this directory." type:"path"`
+	Binary         string   `help:"Terraform or tofu binary to run. Overrides $TERRAFORM_BINARY and tool.binary from the config."`
+	Report         string   `help:"After plan, summarize the changes of every folder as table, markdown or json." placeholder:"FORMAT"`
+	ReportFile     string   `help:"Write the plan summary to this file instead of standard output." type:"path"`
+	VerifyAccounts bool     `help:"Refuse to continue when the active cloud credentials act in another account than configured for the selected folders." default:"true" negatable:""`
+
+	runner  terraform.Runner
+	binary  string
+	caller  clients.Caller
+	audit   *audit.Log
+	assumer *aws.RoleAssumer
+	stdout  io.Writer
+	report  *plan.Aggregate
+}
+
+// defaultPlanFile is where plans are saved for the summary unless -out is given, relative to the folder
+var defaultPlanFile = filepath.Join(".terraform", "terraform-hybrid.tfplan")
+
+// errFailFast cancels the remaining folders of a run after the first failure
+var errFailFast = errors.New("stopped after the first failure (--fail-fast)")
+
+// Run executes the logic for the Run command
+func (r *RunCmd) Run(ctx context.Context) error {
+	if (r.Command == "apply" || r.Command == "destroy") && !slices.Contains(r.Args, "-auto-approve") {
+		return fmt.Errorf("%s runs without a terminal, pass -- -auto-approve to confirm it for every folder", r.Command)
+	}
+
+	if r.Report != "" {
+		if r.Command != "plan" {
+			return fmt.Errorf("--report is only supported for plan")
+		}
+		if !slices.Contains([]plan.Format{plan.FormatTable, plan.FormatMarkdown, plan.FormatJSON}, plan.Format(r.Report)) {
+			return fmt.Errorf("unsupported report format %s, use table, markdown or json", r.Report)
+		}
+		r.report = &plan.Aggregate{}
+	}
+
+	manager := backend.NewTerraformBackendManager(config.NewConfigLoader(), utils.NewFolderFinder(), *backend.NewBackendFactory())
+	selection, err := manager.SelectFolders(ctx, r.Config, r.ProviderFolder, utils.FolderFilter{
+		Accounts:     r.Account,
+		Include:      r.Include,
+		Exclude:      r.Exclude,
+		ChangedSince: r.ChangedSince,
+	})
+	if err != nil {
+		return err
+	}
+
+	stdout := r.stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+
+	// Folders reading the state of others run after them, or before them when destroying
+	graph, err := backend.BuildDependencyGraph(ctx, selection.Config, selection.Layout, selection.Discovered, stdout)
+	if err != nil {
+		return fmt.Errorf("error resolving dependencies between folders: %w", err)
+	}
+
+	r.binary = terraform.ResolveBinaryName(r.Binary, selection.Config.Tool.Binary)
+	if r.runner == nil {
+		runner, err := terraform.NewRunner(r.Binary, selection.Config.Tool.Binary)
+		if err != nil {
+			return err
+		}
+		r.runner = runner
+	}
+
+	if r.LogDir != "" {
+		if err := os.MkdirAll(r.LogDir, 0755); err != nil {
+			return fmt.Errorf("error creating log directory: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	if r.caller == nil {
+		r.caller = newCaller(selection.Config, r.Config, stdout)
+	}
+	if r.VerifyAccounts {
+		if err := backend.VerifyAccounts(selection, r.caller, stdout); err != nil {
+			return err
+		}
+	}
+	if r.audit == nil {
+		r.audit = openAudit(selection.Config, r.caller, stdout)
+	}
+	if r.assumer == nil {
+		r.assumer = aws.NewRoleAssumer()
+	}
+
+	fmt.Fprintf(stdout, "Running terraform %s in %d folders\n", r.Command, len(selection.Folders))
+	err = utils.ProcessFoldersInOrder(ctx, graph, selection.Folders, r.Command == "destroy", r.Parallelism, stdout, func(ctx context.Context, folder string, out io.Writer) error {
+		err := r.runFolder(ctx, selection, folder, out)
+		if err != nil && r.FailFast {
+			cancel(errFailFast)
+		}
+		return err
+	})
+	if r.report != nil {
+		r.reportNotPlanned(selection, err)
+		if reportErr := r.writeReport(stdout); reportErr != nil {
+			return errors.Join(err, reportErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error running terraform %s: %w", r.Command, err)
+	}
+
+	fmt.Fprintf(stdout, "terraform %s succeeded in %d folders\n", r.Command, len(selection.Folders))
+	return nil
+}
+
+// runFolder selects the folder's workspace and runs the terraform subcommand in it with the credentials of its account.
+// init runs before the workspace is selected since workspaces need an initialized backend.
+func (r *RunCmd) runFolder(ctx context.Context, selection *backend.FolderSelection, folder string, out io.Writer) error {
+	namer, layout := selection.Namer, selection.Layout
+	if r.LogDir != "" {
+		logFile, err := r.openLog(layout, folder)
+		if err != nil {
+			return err
+		}
+		defer logFile.Close()
+		out = io.MultiWriter(out, logFile)
+	}
+
+	fmt.Fprintf(out, "Processing subfolder: %s\n", folder)
+	env, err := backend.AccountEnv(selection, folder, r.assumer)
+	if err != nil {
+		r.reportComponent(layout, folder, nil, err)
+		return err
+	}
+	workspace := &WorkspaceCmd{Dir: folder, runner: r.runner, audit: r.audit, env: env, stdout: out, stderr: out}
+
+	if r.Command != "init" {
+		if err := workspace.selectOrCreateWorkspace(ctx, namer); err != nil {
+			r.reportComponent(layout, folder, nil, err)
+			return err
+		}
+	}
+
+	cmd := terraform.Command{
+		Binary: r.binary,
+		Args:   r.commandArgs(),
+		Dir:    folder,
+		Env:    env,
+		Stdout: out,
+		Stderr: out,
+	}
+	fmt.Fprintf(out, "Running terraform command: %s\n", cmd)
+	if err := r.runner.Run(ctx, cmd); err != nil {
+		err = fmt.Errorf("terraform %s failed: %v", r.Command, err)
+		r.reportComponent(layout, folder, nil, err)
+		return err
+	}
+
+	switch {
+	case r.Command == "init":
+		return workspace.selectOrCreateWorkspace(ctx, namer)
+	case r.report != nil:
+		summary, err := r.summarizePlan(ctx, folder, env, out)
+		r.reportComponent(layout, folder, summary, err)
+		return err
+	case r.Command == "apply" || r.Command == "destroy":
+		return r.audit.Record("run-"+r.Command, folder, strings.Join(r.Args, " "))
+	default:
+		return nil
+	}
+}
+
+// summarizePlan summarizes the plan saved in a folder
+func (r *RunCmd) summarizePlan(ctx context.Context, folder string, env []string, out io.Writer) (*plan.Summary, error) {
+	var planJSON bytes.Buffer
+	cmd := terraform.Command{
+		Binary: r.binary,
+		Args:   []string{"show", "-json", "-no-color", r.planFile()},
+		Dir:    folder,
+		Env:    env,
+		Stdout: &planJSON,
+		Stderr: out,
+	}
+	if err := r.runner.Run(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("terraform show failed: %v", err)
+	}
+	return plan.ParseShowJSON(planJSON.Bytes())
+}
+
+// reportComponent adds the plan outcome of a folder to the report, if one is requested
+func (r *RunCmd) reportComponent(layout *utils.Layout, folder string, summary *plan.Summary, err error) {
+	if r.report == nil {
+		return
+	}
+
+	component := componentReport(layout, folder)
+	component.Summary = summary
+	if err != nil {
+		component.Summary = nil
+		component.Error = err.Error()
+	}
+	r.report.Add(component)
+}
+
+// componentReport returns the report entry of a folder with its component and account
+func componentReport(layout *utils.Layout, folder string) plan.ComponentReport {
+	component := plan.ComponentReport{Component: folder, Folder: folder}
+	if relativePath, err := layout.RelativePath(folder); err == nil {
+		component.Component = filepath.ToSlash(relativePath)
+		values, _ := layout.Match(relativePath)
+		component.Account = values["account"]
+	}
+	return component
+}
+
+// reportNotPlanned adds the folders that were skipped or never started to the report, so an interrupted run
+// never reports that every component is unchanged
+func (r *RunCmd) reportNotPlanned(selection *backend.FolderSelection, err error) {
+	r.report.Expected = len(selection.Folders)
+
+	reasons := map[string]string{}
+	var folderErrors *utils.FolderErrors
+	if errors.As(err, &folderErrors) {
+		for _, folderErr := range folderErrors.Errors {
+			reasons[folderErr.Folder] = folderErr.Err.Error()
+		}
+	}
+
+	for _, folder := range selection.Folders {
+		if r.report.Has(folder) {
+			continue
+		}
+		component := componentReport(selection.Layout, folder)
+		component.NotPlanned = true
+		component.Error = reasons[folder]
+		if component.Error == "" {
+			component.Error = "not started"
+			if folderErrors != nil && folderErrors.Cause != nil {
+				component.Error = fmt.Sprintf("not started: %v", folderErrors.Cause)
+			}
+		}
+		r.report.Add(component)
+	}
+}
+
+// writeReport writes the plan summary to the report file or stdout
+func (r *RunCmd) writeReport(stdout io.Writer) error {
+	if r.ReportFile == "" {
+		fmt.Fprintln(stdout)
+		return r.report.Write(stdout, plan.Format(r.Report))
+	}
+
+	var buffer bytes.Buffer
+	if err := r.report.Write(&buffer, plan.Format(r.Report)); err != nil {
+		return err
+	}
+	if err := utils.WriteFileAtomic(r.ReportFile, buffer.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing report: %v", err)
+	}
+	fmt.Fprintf(stdout, "Wrote plan summary to %s\n", r.ReportFile)
+	return nil
+}
+
+// planFile returns the plan file given with -out, or the default plan file
+func (r *RunCmd) planFile() string {
+	if file, ok := outFile(r.Args); ok {
+		return file
+	}
+	return defaultPlanFile
+}
+
+// outFile returns the plan file given with -out, in any of the forms terraform accepts:
+// -out=FILE, -out FILE and the same with two dashes
+func outFile(args []string) (string, bool) {
+	for i, arg := range args {
+		flag := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if flag == arg {
+			continue
+		}
+		if file, ok := strings.CutPrefix(flag, "out="); ok {
+			return file, true
+		}
+		if flag == "out" && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// commandArgs returns the subcommand with its extra arguments, disabling interactive input where supported
+// and saving the plan when it is summarized
+func (r *RunCmd) commandArgs() []string {
+	args := []string{r.Command}
+	if r.Command != "validate" && !slices.ContainsFunc(r.Args, func(arg string) bool { return strings.HasPrefix(arg, "-input") }) {
+		args = append(args, "-input=false")
+	}
+	if _, ok := outFile(r.Args); r.report != nil && !ok {
+		args = append(args, "-out="+defaultPlanFile)
+	}
+	return append(args, r.Args...)
+}
+
+// openLog creates the log file of a folder, named like the workspace of the hash strategy after its path
+// relative to the layout root, so that paths with the same slug such as a/b_c and a_b/c get their own log
+func (r *RunCmd) openLog(layout *utils.Layout, folder string) (*os.File, error) {
+	name, err := (&utils.WorkspaceNamer{Layout: layout, Strategy: utils.WorkspaceStrategyHash}).Name(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.Create(filepath.Join(r.LogDir, name+".log"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating log file: %v", err)
+	}
+	return logFile, nil
+}
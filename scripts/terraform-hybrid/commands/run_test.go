@@ -0,0 +1,386 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/aws"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/clientstest"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/terraform"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RunCmd", func() {
+	var (
+		root    string
+		runner  *terraform.FakeRunner
+		stdout  *bytes.Buffer
+		cmd     *RunCmd
+		folders []string
+	)
+
+	// mkdir creates a root module under the layout root
+	mkdir := func(parts ...string) string {
+		dir := filepath.Join(append([]string{root, "live"}, parts...)...)
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "main.tf"), []byte("resource \"null_resource\" \"this\" {}\n"), 0644)).To(Succeed())
+		return dir
+	}
+
+	// writeConfig writes a config with the given accounts section
+	writeConfig := func(configFile, accounts string) {
+		Expect(os.WriteFile(configFile, []byte(`
+global:
+  backend_type: local
+  backend:
+    path: state
+  accounts:`+accounts+`
+layout:
+  root: `+filepath.Join(root, "live")+`
+  path_template: "{provider}/{account}/{stack}"
+audit:
+  log: `+filepath.Join(root, "audit.log")+`
+`), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+		configFile := filepath.Join(root, "aws.yaml")
+		writeConfig(configFile, `
+    dev: "111111111111"
+    prod: "222222222222"`)
+
+		folders = []string{mkdir("aws", "dev", "network"), mkdir("aws", "prod", "network")}
+		runner = terraform.NewFakeRunner()
+		stdout = &bytes.Buffer{}
+		cmd = &RunCmd{Config: configFile, Parallelism: 1, runner: runner, caller: &clientstest.FakeCaller{Name: "alice"}, stdout: stdout}
+	})
+
+	It("should select the workspace before running the subcommand in every folder", func() {
+		cmd.Command = "plan"
+		cmd.Args = []string{"-lock=false"}
+		Expect(cmd.Run(context.Background())).To(Succeed())
+
+		Expect(runner.Args()).To(Equal([][]string{
+			{"workspace", "select", "--or-create", "aws_dev_network"},
+			{"plan", "-input=false", "-lock=false"},
+			{"workspace", "select", "--or-create", "aws_prod_network"},
+			{"plan", "-input=false", "-lock=false"},
+		}))
+		Expect(runner.Calls()[1].Dir).To(Equal(folders[0]))
+		Expect(runner.Calls()[3].Dir).To(Equal(folders[1]))
+	})
+
+	It("should show the chosen binary in the command lines it prints", func() {
+		cmd.Command = "plan"
+		cmd.Binary = "tofu"
+		Expect(cmd.Run(context.Background())).To(Succeed())
+
+		Expect(stdout.String()).To(ContainSubstring("Running terraform command: tofu plan -input=false"))
+		Expect(runner.Calls()[1].Binary).To(Equal("tofu"))
+	})
+
+	It("should verify the active account before running", func() {
+		cmd.Command = "plan"
+		cmd.Account = []string{"dev"}
+		cmd.VerifyAccounts = true
+		cmd.caller = &clientstest.FakeCaller{Name: "alice", Account: "111111111111"}
+		Expect(cmd.Run(context.Background())).To(Succeed())
+
+		Expect(stdout.String()).To(ContainSubstring("Verified account dev: active credentials act in 111111111111\n"))
+		Expect(runner.Calls()).To(HaveLen(2))
+	})
+
+	It("should refuse to run in folders of another account", func() {
+		cmd.Command = "plan"
+		cmd.Account = []string{"dev"}
+		cmd.VerifyAccounts = true
+		cmd.caller = &clientstest.FakeCaller{Name: "alice", Account: "999999999999"}
+
+		err := cmd.Run(context.Background())
+		Expect(err).To(MatchError("refusing to continue, the active credentials act in account 999999999999 but account dev is configured as 111111111111"))
+		Expect(runner.Calls()).To(BeEmpty())
+	})
+
+	It("should suggest --account when the selected folders span several account IDs", func() {
+		cmd.Command = "plan"
+		cmd.VerifyAccounts = true
+		cmd.caller = &clientstest.FakeCaller{Name: "alice", Account: "111111111111"}
+
+		err := cmd.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("account prod is configured as 222222222222; the selected folders span 2 account IDs, select the folders of one account with --account")))
+		Expect(runner.Calls()).To(BeEmpty())
+	})
+
+	It("should run terraform with the credentials of the role of an account", func() {
+		writeConfig(cmd.Config, `
+    dev: "111111111111"
+    prod:
+      id: "123456789012"
+      role_arn: arn:aws:iam::123456789012:role/terraform
+      region: eu-west-1`)
+		client := &fakeSTS{}
+		cmd.assumer = &aws.RoleAssumer{
+			NewSTS:      func(string, string) (stsiface.STSAPI, error) { return client, nil },
+			SessionName: aws.DefaultSessionName,
+		}
+		cmd.Command = "plan"
+		Expect(cmd.Run(context.Background())).To(Succeed())
+
+		credentials := []string{
+			"AWS_ACCESS_KEY_ID=ASIAEXAMPLE",
+			"AWS_SECRET_ACCESS_KEY=secret",
+			"AWS_SESSION_TOKEN=token",
+			"AWS_REGION=eu-west-1",
+			"AWS_DEFAULT_REGION=eu-west-1",
+		}
+		Expect(runner.Calls()[0].Env).To(BeEmpty())
+		Expect(runner.Calls()[1].Env).To(BeEmpty())
+		Expect(runner.Calls()[2].Env).To(Equal(credentials))
+		Expect(runner.Calls()[3].Env).To(Equal(credentials))
+		Expect(client.assumed).To(Equal(1))
+	})
+
+	It("should not run in the folders of an account whose role cannot be assumed", func() {
+		writeConfig(cmd.Config, `
+    prod:
+      id: "210987654321"
+      role_arn: arn:aws:iam::210987654321:role/terraform`)
+		cmd.assumer = &aws.RoleAssumer{
+			NewSTS: func(string, string) (stsiface.STSAPI, error) { return &fakeSTS{}, nil },
+		}
+		cmd.Command = "plan"
+
+		err := cmd.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("error acting in account prod: role arn:aws:iam::210987654321:role/terraform acts in account 123456789012, not the configured 210987654321")))
+		Expect(runner.Calls()).To(BeEmpty())
+	})
+
+	It("should initialize before selecting the workspace", func() {
+		cmd.Command = "init"
+		Expect(cmd.Run(context.Background())).To(Succeed())
+
+		Expect(runner.Args()[:2]).To(Equal([][]string{
+			{"init", "-input=false"},
+			{"workspace", "select", "--or-create", "aws_dev_network"},
+		}))
+	})
+
+	It("should require -auto-approve for apply", func() {
+		cmd.Command = "apply"
+		Expect(cmd.Run(context.Background())).To(MatchError(ContainSubstring("-auto-approve")))
+		Expect(runner.Calls()).To(BeEmpty())
+	})
+
+	It("should record applies in the audit log", func() {
+		cmd.Command = "apply"
+		cmd.Args = []string{"-auto-approve"}
+		Expect(cmd.Run(context.Background())).To(Succeed())
+
+		data, err := os.ReadFile(filepath.Join(root, "audit.log"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"who":"alice","operation":"run-apply","folder":"` + folders[1] + `","detail":"-auto-approve"`))
+	})
+
+	It("should continue with the remaining folders after a failure", func() {
+		runner.OnIn(folders[0], terraform.FakeResponse{Err: errors.New("exit status 1")}, "validate")
+		cmd.Command = "validate"
+
+		err := cmd.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("1 of 2 folders failed")))
+		Expect(runner.Args()).To(ContainElement([]string{"workspace", "select", "--or-create", "aws_prod_network"}))
+	})
+
+	It("should not start further folders with --fail-fast", func() {
+		runner.OnIn(folders[0], terraform.FakeResponse{Err: errors.New("exit status 1")}, "validate")
+		cmd.Command = "validate"
+		cmd.FailFast = true
+
+		err := cmd.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("1 were not started")))
+		Expect(errors.Is(err, errFailFast)).To(BeTrue())
+		Expect(runner.Args()).NotTo(ContainElement([]string{"workspace", "select", "--or-create", "aws_prod_network"}))
+	})
+
+	It("should write the output of every folder to its log file", func() {
+		runner.OnIn(folders[1], terraform.FakeResponse{Stdout: "No changes.\n"}, "plan")
+		cmd.Command = "plan"
+		cmd.LogDir = filepath.Join(root, "logs")
+		Expect(cmd.Run(context.Background())).To(Succeed())
+
+		prodLogs, err := filepath.Glob(filepath.Join(cmd.LogDir, "aws_prod_network-*.log"))
+		Expect(err).To(BeNil())
+		Expect(prodLogs).To(HaveLen(1))
+		content, err := os.ReadFile(prodLogs[0])
+		Expect(err).To(BeNil())
+		Expect(string(content)).To(ContainSubstring("No changes."))
+		Expect(filepath.Glob(filepath.Join(cmd.LogDir, "aws_dev_network-*.log"))).To(HaveLen(1))
+		Expect(stdout.String()).To(ContainSubstring("No changes."))
+	})
+
+	It("should give folders with the same slug their own log file", func() {
+		layout, err := utils.NewLayout(filepath.Join(root, "live"), "{provider}/{account}/{stack}", nil)
+		Expect(err).To(BeNil())
+		cmd.LogDir = filepath.Join(root, "logs")
+		Expect(os.MkdirAll(cmd.LogDir, 0755)).To(Succeed())
+
+		first, err := cmd.openLog(layout, filepath.Join(root, "live", "aws", "dev_x", "network"))
+		Expect(err).To(BeNil())
+		defer first.Close()
+		second, err := cmd.openLog(layout, filepath.Join(root, "live", "aws", "dev", "x_network"))
+		Expect(err).To(BeNil())
+		defer second.Close()
+
+		Expect(first.Name()).To(HavePrefix(filepath.Join(cmd.LogDir, "aws_dev_x_network-")))
+		Expect(second.Name()).To(HavePrefix(filepath.Join(cmd.LogDir, "aws_dev_x_network-")))
+		Expect(first.Name()).NotTo(Equal(second.Name()))
+	})
+
+	Describe("with --report", func() {
+		BeforeEach(func() {
+			cmd.Command = "plan"
+			cmd.Report = "json"
+			runner.On(terraform.FakeResponse{Stdout: `{"resource_changes": []}`}, "show")
+			runner.OnIn(folders[1], terraform.FakeResponse{
+				Stdout: `{"resource_changes": [{"address": "aws_vpc.main", "change": {"actions": ["create"]}}]}`,
+			}, "show")
+		})
+
+		It("should save every plan and summarize it", func() {
+			cmd.ReportFile = filepath.Join(root, "report.json")
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()[1:3]).To(Equal([][]string{
+				{"plan", "-input=false", "-out=" + defaultPlanFile},
+				{"show", "-json", "-no-color", defaultPlanFile},
+			}))
+
+			content, err := os.ReadFile(cmd.ReportFile)
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(ContainSubstring(`"no_changes": false`))
+			Expect(string(content)).To(ContainSubstring(`"component": "aws/prod/network"`))
+			Expect(string(content)).To(ContainSubstring(`"account": "prod"`))
+		})
+
+		It("should use the plan file given with -out", func() {
+			cmd.Args = []string{"-out=custom.tfplan"}
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()[1:3]).To(Equal([][]string{
+				{"plan", "-input=false", "-out=custom.tfplan"},
+				{"show", "-json", "-no-color", "custom.tfplan"},
+			}))
+		})
+
+		It("should use the plan file given as a separate argument of -out", func() {
+			cmd.Args = []string{"--out", "custom.tfplan"}
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()[1:3]).To(Equal([][]string{
+				{"plan", "-input=false", "--out", "custom.tfplan"},
+				{"show", "-json", "-no-color", "custom.tfplan"},
+			}))
+		})
+
+		It("should report failed plans", func() {
+			runner.OnIn(folders[0], terraform.FakeResponse{Err: errors.New("exit status 1")}, "plan")
+
+			Expect(cmd.Run(context.Background())).To(HaveOccurred())
+			Expect(stdout.String()).To(ContainSubstring(`"error": "terraform plan failed: exit status 1"`))
+		})
+
+		It("should report folders cancelled by --fail-fast as not planned", func() {
+			// Only prod has changes, so a report missing it would otherwise show no changes
+			runner.OnIn(folders[0], terraform.FakeResponse{Err: errors.New("exit status 1")}, "plan")
+			cmd.FailFast = true
+
+			Expect(cmd.Run(context.Background())).To(HaveOccurred())
+			Expect(stdout.String()).To(ContainSubstring(`"no_changes": false`))
+			Expect(stdout.String()).To(ContainSubstring(`"component": "aws/prod/network",`))
+			Expect(stdout.String()).To(ContainSubstring(`"not_planned": true`))
+			Expect(stdout.String()).To(ContainSubstring(`"not planned": 1`))
+		})
+
+		It("should only be supported for plan", func() {
+			cmd.Command = "validate"
+			Expect(cmd.Run(context.Background())).To(MatchError("--report is only supported for plan"))
+		})
+
+		It("should reject unknown formats", func() {
+			cmd.Report = "html"
+			Expect(cmd.Run(context.Background())).To(MatchError(ContainSubstring("unsupported report format html")))
+		})
+	})
+
+	Describe("with folders reading each other's state", func() {
+		BeforeEach(func() {
+			// dev/network reads the state of prod/network
+			Expect(os.WriteFile(filepath.Join(folders[0], "remote.tf"), []byte(`
+data "terraform_remote_state" "prod" {
+  backend   = "local"
+  workspace = "aws_prod_network"
+  config = {
+    workspace_dir = "../../prod/network/terraform.tfstate.d"
+  }
+}
+`), 0644)).To(Succeed())
+		})
+
+		It("should run folders after the folders they depend on", func() {
+			cmd.Command = "validate"
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()).To(Equal([][]string{
+				{"workspace", "select", "--or-create", "aws_prod_network"},
+				{"validate"},
+				{"workspace", "select", "--or-create", "aws_dev_network"},
+				{"validate"},
+			}))
+		})
+
+		It("should destroy dependents first", func() {
+			cmd.Command = "destroy"
+			cmd.Args = []string{"-auto-approve"}
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Calls()[1].Dir).To(Equal(folders[0]))
+			Expect(runner.Calls()[3].Dir).To(Equal(folders[1]))
+		})
+
+		It("should not start dependents of a failed folder", func() {
+			runner.OnIn(folders[1], terraform.FakeResponse{Err: errors.New("exit status 1")}, "validate")
+			cmd.Command = "validate"
+
+			err := cmd.Run(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("not started because " + folders[1] + " failed")))
+			Expect(runner.Args()).To(HaveLen(2))
+		})
+	})
+})
+
+// fakeSTS assumes roles of account 123456789012
+type fakeSTS struct {
+	stsiface.STSAPI
+	assumed int
+}
+
+func (f *fakeSTS) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	f.assumed++
+	return &sts.AssumeRoleOutput{
+		AssumedRoleUser: &sts.AssumedRoleUser{Arn: awssdk.String("arn:aws:sts::123456789012:assumed-role/terraform/" + awssdk.StringValue(input.RoleSessionName))},
+		Credentials: &sts.Credentials{
+			AccessKeyId:     awssdk.String("ASIAEXAMPLE"),
+			SecretAccessKey: awssdk.String("secret"),
+			SessionToken:    awssdk.String("token"),
+		},
+	}, nil
+}
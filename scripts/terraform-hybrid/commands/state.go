@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/backend"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/inventory"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+)
+
+// StateCmd groups the commands working on the states of the configured backends
+type StateCmd struct {
+	Inventory StateInventoryCmd `cmd:"" help:"List every state of the configured backends with the folder it belongs to."`
+	Orphans   StateOrphansCmd   `cmd:"" help:"Report states no discovered folder writes and folders without a state."`
+}
+
+// StateInventoryCmd defines the structure for the state inventory command
+type StateInventoryCmd struct {
+	Config         []string `help:"Paths to the YAML config files, e.g. one per provider." required:"true" type:"path" sep:","`
+	ProviderFolder string   `help:"Path to the provider folder. Defaults to the layout root from each config." type:"path"`
+	Format         string   `help:"Output format: table, json or csv." default:"table" enum:"table,json,csv"`
+	Output         string   `help:"Write the inventory to this file instead of stdout." type:"path"`
+
+	stdout io.Writer
+}
+
+// Run lists the states of every config and writes them in the requested format
+func (s *StateInventoryCmd) Run(ctx context.Context) error {
+	var states []inventory.State
+	for _, configPath := range s.Config {
+		selection, store, err := openStates(ctx, configPath, s.ProviderFolder)
+		if err != nil {
+			return fmt.Errorf("error listing states of %s: %w", configPath, err)
+		}
+		configStates, err := backend.Inventory(ctx, selection, store, backend.ConfigProvider(configPath))
+		store.Close()
+		if err != nil {
+			return fmt.Errorf("error listing states of %s: %w", configPath, err)
+		}
+		states = append(states, configStates...)
+	}
+
+	return writeOutput(outputOrStdout(s.stdout), s.Output, fmt.Sprintf("%d states", len(states)), func(w io.Writer) error {
+		return inventory.Write(w, states, inventory.Format(s.Format))
+	})
+}
+
+// StateOrphansCmd defines the structure for the state orphans command
+type StateOrphansCmd struct {
+	Config         []string `help:"Paths to the YAML config files, e.g. one per provider." required:"true" type:"path" sep:","`
+	ProviderFolder string   `help:"Path to the provider folder. Defaults to the layout root from each config." type:"path"`
+	Format         string   `help:"Output format: table, json or csv." default:"table" enum:"table,json,csv"`
+	Output         string   `help:"Write the report to this file instead of stdout." type:"path"`
+
+	stdout io.Writer
+}
+
+// Run reports the orphans of every config and fails when there are any
+func (s *StateOrphansCmd) Run(ctx context.Context) error {
+	orphans := &inventory.Orphans{}
+	for _, configPath := range s.Config {
+		selection, store, err := openStates(ctx, configPath, s.ProviderFolder)
+		if err != nil {
+			return fmt.Errorf("error listing states of %s: %w", configPath, err)
+		}
+		configOrphans, err := backend.Orphans(ctx, selection, store, backend.ConfigProvider(configPath))
+		store.Close()
+		if err != nil {
+			return fmt.Errorf("error listing states of %s: %w", configPath, err)
+		}
+		orphans.Add(configOrphans)
+	}
+
+	err := writeOutput(outputOrStdout(s.stdout), s.Output, "orphans", func(w io.Writer) error {
+		return inventory.WriteOrphans(w, orphans, inventory.Format(s.Format))
+	})
+	if err != nil {
+		return err
+	}
+	if !orphans.Empty() {
+		return fmt.Errorf("found %d orphaned states tracking %d resources and %d folders without state",
+			len(orphans.States), orphans.Resources(), len(orphans.Folders))
+	}
+	return nil
+}
+
+// openStates discovers the root modules of a config and opens the store of its backend
+func openStates(ctx context.Context, configPath, providerFolder string) (*backend.FolderSelection, inventory.Store, error) {
+	manager := backend.NewTerraformBackendManager(config.NewConfigLoader(), utils.NewFolderFinder(), *backend.NewBackendFactory())
+	selection, err := manager.SelectFolders(ctx, configPath, providerFolder, utils.FolderFilter{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store, err := backend.NewStateStore(selection)
+	if err != nil {
+		return nil, nil, err
+	}
+	return selection, store, nil
+}
+
+// writeOutput renders to the output file, naming what was written on out, or to out when no file is given
+func writeOutput(out io.Writer, output, what string, render func(io.Writer) error) error {
+	if output == "" {
+		return render(out)
+	}
+
+	var buffer bytes.Buffer
+	if err := render(&buffer); err != nil {
+		return err
+	}
+	if err := utils.WriteFileAtomic(output, buffer.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", output, err)
+	}
+	fmt.Fprintf(out, "Wrote %s to %s\n", what, output)
+	return nil
+}
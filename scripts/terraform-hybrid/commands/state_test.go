@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/clientstest"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/terraform"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StateInventoryCmd", func() {
+	It("should write the states found in the folders of a relative local backend path", func() {
+		root := GinkgoT().TempDir()
+		folder := filepath.Join(root, "live", "aws", "dev", "network")
+		Expect(os.MkdirAll(folder, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(folder, "main.tf"), []byte("resource \"null_resource\" \"this\" {}\n"), 0644)).To(Succeed())
+		statePath := filepath.Join(folder, "state", "aws", "dev", "network", "terraform.tfstate")
+		Expect(os.MkdirAll(filepath.Dir(statePath), 0755)).To(Succeed())
+		Expect(os.WriteFile(statePath, []byte(`{"serial": 2, "lineage": "abc", "terraform_version": "1.9.5", "resources": []}`), 0644)).To(Succeed())
+
+		configFile := filepath.Join(root, "aws.yaml")
+		Expect(os.WriteFile(configFile, []byte(`
+global:
+  backend_type: local
+  backend:
+    path: state
+layout:
+  root: `+filepath.Join(root, "live")+`
+  path_template: "{provider}/{account}/{stack}"
+workspace:
+  strategy: default
+`), 0644)).To(Succeed())
+
+		stdout := &bytes.Buffer{}
+		output := filepath.Join(root, "inventory.csv")
+		cmd := &StateInventoryCmd{Config: []string{configFile}, Format: "csv", Output: output, stdout: stdout}
+		Expect(cmd.Run(context.Background())).To(Succeed())
+
+		Expect(stdout.String()).To(Equal("Wrote 1 states to " + output + "\n"))
+		content, err := os.ReadFile(output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("\naws,local," + statePath + ",,2,abc,1.9.5,0,"))
+		Expect(string(content)).To(ContainSubstring(",dev,aws/dev/network," + folder + ",\n"))
+	})
+
+	It("should report orphaned states and fail", func() {
+		root := GinkgoT().TempDir()
+		stateDir := filepath.Join(root, "state")
+		folder := filepath.Join(root, "live", "aws", "dev", "network")
+		Expect(os.MkdirAll(folder, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(folder, "main.tf"), []byte("resource \"null_resource\" \"this\" {}\n"), 0644)).To(Succeed())
+		for _, stack := range []string{"network", "legacy"} {
+			statePath := filepath.Join(stateDir, "aws", "dev", stack, "terraform.tfstate")
+			Expect(os.MkdirAll(filepath.Dir(statePath), 0755)).To(Succeed())
+			Expect(os.WriteFile(statePath, []byte(`{"serial": 2, "resources": [{"mode": "managed", "instances": [{}, {}]}]}`), 0644)).To(Succeed())
+		}
+
+		configFile := filepath.Join(root, "aws.yaml")
+		Expect(os.WriteFile(configFile, []byte(`
+global:
+  backend_type: local
+  backend:
+    path: `+stateDir+`
+layout:
+  root: `+filepath.Join(root, "live")+`
+  path_template: "{provider}/{account}/{stack}"
+workspace:
+  strategy: default
+`), 0644)).To(Succeed())
+
+		stdout := &bytes.Buffer{}
+		cmd := &StateOrphansCmd{Config: []string{configFile}, Format: "table", stdout: stdout}
+		Expect(cmd.Run(context.Background())).To(MatchError("found 1 orphaned states tracking 2 resources and 0 folders without state"))
+
+		Expect(stdout.String()).To(ContainSubstring("Orphaned states: 1, tracking 2 resources\n"))
+		Expect(stdout.String()).To(MatchRegexp(`aws\s+local\s+` + filepath.Join(stateDir, "aws", "dev", "legacy", "terraform.tfstate") + `\s+2\s+2\s+\S+\s+dev\s+aws/dev/legacy\n`))
+		Expect(stdout.String()).To(HaveSuffix("\nFolders without state: 0\n"))
+	})
+
+	It("should not report the state of a workspace created by run as orphaned", func() {
+		root := GinkgoT().TempDir()
+		folder := filepath.Join(root, "live", "aws", "dev", "network")
+		Expect(os.MkdirAll(folder, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(folder, "main.tf"), []byte("resource \"null_resource\" \"this\" {}\n"), 0644)).To(Succeed())
+		configFile := filepath.Join(root, "aws.yaml")
+		Expect(os.WriteFile(configFile, []byte(`
+global:
+  backend_type: local
+  backend:
+    path: state
+layout:
+  root: `+filepath.Join(root, "live")+`
+  path_template: "{provider}/{account}/{stack}"
+audit:
+  log: `+filepath.Join(root, "audit.log")+`
+`), 0644)).To(Succeed())
+
+		runner := terraform.NewFakeRunner()
+		run := &RunCmd{Config: configFile, Command: "apply", Args: []string{"-auto-approve"}, Parallelism: 1, runner: runner, caller: &clientstest.FakeCaller{Name: "alice"}, stdout: &bytes.Buffer{}}
+		Expect(run.Run(context.Background())).To(Succeed())
+		Expect(runner.Args()[0]).To(Equal([]string{"workspace", "select", "--or-create", "aws_dev_network"}))
+		// terraform writes the state of a workspace other than default below terraform.tfstate.d of the folder
+		statePath := filepath.Join(folder, "terraform.tfstate.d", "aws_dev_network", "terraform.tfstate")
+		Expect(os.MkdirAll(filepath.Dir(statePath), 0755)).To(Succeed())
+		Expect(os.WriteFile(statePath, []byte(`{"serial": 1, "resources": [{"mode": "managed", "instances": [{}]}]}`), 0644)).To(Succeed())
+
+		stdout := &bytes.Buffer{}
+		cmd := &StateOrphansCmd{Config: []string{configFile}, Format: "table", stdout: stdout}
+		Expect(cmd.Run(context.Background())).To(Succeed())
+
+		Expect(stdout.String()).To(ContainSubstring("Orphaned states: 0, tracking 0 resources\n"))
+		Expect(stdout.String()).To(HaveSuffix("\nFolders without state: 0\n"))
+	})
+})
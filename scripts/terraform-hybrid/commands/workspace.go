@@ -1,114 +1,410 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
-)
+	"time"
 
-const providerBaseDir = "deploy/provider"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/audit"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/backend"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/aws"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/terraform"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/workspace"
+)
 
 // WorkspaceCmd defines the structure for the Workspace command
 type WorkspaceCmd struct {
+	Config         string `help:"Path to the YAML config file whose layout is used for workspace naming." type:"path"`
+	Dir            string `help:"Terraform root module to run in. Defaults to the current directory." type:"existingdir"`
 	SelectOrCreate bool   `help:"Select a workspace, or create it if it doesn't exist."`
 	Select         string `help:"Select an existing workspace."`
 	New            string `help:"Create a new workspace."`
 	List           bool   `help:"List all available workspaces."`
 	Current        bool   `help:"Show the current active workspace."`
-	Delete         string `help:"Delete a workspace."`
+	Delete         string `help:"Delete a workspace. Refused while its state tracks resources unless --force is given."`
+	Force          bool   `help:"With --delete, delete a workspace whose state still tracks resources."`
+	BackupDir      string `help:"With --delete, where the state is backed up before deletion. Relative to the root module, defaults to terraform-hybrid/backups in the user cache directory." placeholder:"DIR"`
+	Binary         string `help:"Terraform or tofu binary to run. Overrides $TERRAFORM_BINARY and tool.binary from the config."`
+	Native         bool   `help:"Manage the workspaces of a local or pg backend from --config directly, without terraform or terraform init."`
+
+	All            bool     `help:"Run --list, --select-or-create or --delete in every discovered root module. Requires --config."`
+	ProviderFolder string   `help:"With --all, the path to the provider folder. Defaults to the layout root from the config." type:"path"`
+	Account        []string `help:"With --all, only run in folders of these accounts." sep:","`
+	Include        []string `help:"With --all, only run in folders whose path relative to the provider folder matches one of these globs." sep:","`
+	Exclude        []string `help:"With --all, skip folders whose path relative to the provider folder matches one of these globs." sep:","`
+	ChangedSince   string   `help:"With --all, only run in folders with files changed since this git ref." placeholder:"GIT-REF"`
+	Parallelism    int      `help:"With --all, the number of folders processed concurrently." default:"1"`
+	VerifyAccounts bool     `help:"With --all, refuse to continue when the active cloud credentials act in another account than configured for the selected folders." default:"true" negatable:""`
+
+	runner     terraform.Runner
+	binary     string
+	workspaces *workspace.Manager
+	caller     clients.Caller
+	audit      *audit.Log
+	assumer    *aws.RoleAssumer
+	// env holds the account credentials, profile and region terraform runs with
+	env    []string
+	stdout io.Writer
+	stderr io.Writer
 }
 
 // Run executes the logic for the Workspace command
-func (w *WorkspaceCmd) Run() error {
+func (w *WorkspaceCmd) Run(ctx context.Context) error {
+	if w.All {
+		return w.runAll(ctx)
+	}
+
+	loadedConfig, err := w.loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	closeBackend, err := w.setup(loadedConfig)
+	if err != nil {
+		return err
+	}
+	defer closeBackend()
+	w.openAudit(loadedConfig)
+	if err := w.setupAccountEnv(loadedConfig); err != nil {
+		return err
+	}
+
 	switch {
 	case w.List:
-		return w.ListWorkspaces()
+		return w.ListWorkspaces(ctx)
 	case w.Current:
-		return w.CurrentWorkspace()
+		return w.CurrentWorkspace(ctx)
 	case w.New != "":
-		return w.CreateWorkspace(w.New)
+		return w.CreateWorkspace(ctx, w.New)
 	case w.Select != "":
-		return w.SelectWorkspace(w.Select)
+		return w.SelectWorkspace(ctx, w.Select)
 	case w.Delete != "":
-		return w.DeleteWorkspace(w.Delete)
+		return w.DeleteWorkspace(ctx, w.Delete)
 	case w.SelectOrCreate:
-		return w.SelectOrCreateWorkspace()
+		return w.SelectOrCreateWorkspace(ctx)
 	default:
 		return fmt.Errorf("no workspace operation provided, use --help for options")
 	}
 }
 
+// setup manages workspaces directly when the configured backend supports it and runs terraform otherwise.
+// It returns a function closing the backend connections.
+func (w *WorkspaceCmd) setup(loadedConfig *config.TerraformHybridConfig) (func(), error) {
+	closeBackend := func() {}
+	if w.Native && w.Config != "" && w.workspaces == nil {
+		backend, err := workspace.NewBackend(loadedConfig)
+		switch {
+		case errors.Is(err, workspace.ErrUnsupportedBackend):
+			// Fall back to terraform
+		case err != nil:
+			return nil, err
+		default:
+			w.workspaces = workspace.NewManager(backend)
+			closeBackend = func() { _ = backend.Close() }
+		}
+	}
+
+	w.binary = terraform.ResolveBinaryName(w.Binary, loadedConfig.Tool.Binary)
+	if w.workspaces == nil && w.runner == nil {
+		runner, err := terraform.NewRunner(w.Binary, loadedConfig.Tool.Binary)
+		if err != nil {
+			return nil, err
+		}
+		w.runner = runner
+	}
+	return closeBackend, nil
+}
+
+// setupAccountEnv makes terraform act in the account of the root module, with the credentials of its
+// role or its profile, as run and --all do for every folder
+func (w *WorkspaceCmd) setupAccountEnv(loadedConfig *config.TerraformHybridConfig) error {
+	if w.workspaces != nil || w.env != nil || len(loadedConfig.Global.Accounts) == 0 {
+		return nil
+	}
+	dir, err := w.workingDir()
+	if err != nil {
+		return err
+	}
+	if w.assumer == nil {
+		w.assumer = aws.NewRoleAssumer()
+	}
+	w.env, err = backend.FolderAccountEnv(loadedConfig, dir, w.assumer)
+	return err
+}
+
+// openAudit opens the audit log for the operations changing workspaces
+func (w *WorkspaceCmd) openAudit(loadedConfig *config.TerraformHybridConfig) {
+	if w.audit == nil && (w.New != "" || w.Delete != "" || w.SelectOrCreate) {
+		w.audit = openAudit(loadedConfig, w.identity(loadedConfig), w.output())
+	}
+}
+
+// identity returns the caller of the command, resolved from the config on first use
+func (w *WorkspaceCmd) identity(loadedConfig *config.TerraformHybridConfig) clients.Caller {
+	if w.caller == nil {
+		w.caller = newCaller(loadedConfig, w.Config, w.output())
+	}
+	return w.caller
+}
+
 // ListWorkspaces lists all available workspaces
-func (w *WorkspaceCmd) ListWorkspaces() error {
-	return runTerraformCommand("Listing available workspaces...", "terraform", "workspace", "list")
+func (w *WorkspaceCmd) ListWorkspaces(ctx context.Context) error {
+	if w.workspaces != nil {
+		return w.listNative(ctx)
+	}
+	return w.runTerraformCommand(ctx, "Listing available workspaces...", "workspace", "list")
 }
 
 // CurrentWorkspace shows the current workspace
-func (w *WorkspaceCmd) CurrentWorkspace() error {
-	return runTerraformCommand("Showing current workspace...", "terraform", "workspace", "show")
+func (w *WorkspaceCmd) CurrentWorkspace(ctx context.Context) error {
+	if w.workspaces != nil {
+		return w.currentNative()
+	}
+	return w.runTerraformCommand(ctx, "Showing current workspace...", "workspace", "show")
 }
 
 // CreateWorkspace creates a new workspace
-func (w *WorkspaceCmd) CreateWorkspace(workspace string) error {
-	return runTerraformCommand(
-		fmt.Sprintf("Creating new workspace: %s", workspace),
-		"terraform", "workspace", "new", workspace)
+func (w *WorkspaceCmd) CreateWorkspace(ctx context.Context, workspace string) error {
+	if err := utils.ValidateWorkspaceName(workspace); err != nil {
+		return err
+	}
+
+	var err error
+	if w.workspaces != nil {
+		err = w.runNative(fmt.Sprintf("Creating new workspace: %s", workspace), func(dir string) error {
+			return w.workspaces.Create(ctx, dir, workspace)
+		})
+	} else {
+		err = w.runTerraformCommand(ctx,
+			fmt.Sprintf("Creating new workspace: %s", workspace),
+			"workspace", "new", workspace)
+	}
+	if err != nil {
+		return err
+	}
+	return w.record("workspace-new", workspace)
 }
 
 // SelectWorkspace selects the specified workspace
-func (w *WorkspaceCmd) SelectWorkspace(workspace string) error {
-	return runTerraformCommand(
+func (w *WorkspaceCmd) SelectWorkspace(ctx context.Context, workspace string) error {
+	if err := utils.ValidateWorkspaceName(workspace); err != nil {
+		return err
+	}
+	if w.workspaces != nil {
+		return w.runNative(fmt.Sprintf("Selecting workspace: %s", workspace), func(dir string) error {
+			return w.workspaces.Select(ctx, dir, workspace)
+		})
+	}
+	return w.runTerraformCommand(ctx,
 		fmt.Sprintf("Selecting workspace: %s", workspace),
-		"terraform", "workspace", "select", workspace)
+		"workspace", "select", workspace)
 }
 
 // SelectOrCreateWorkspace selects or creates a workspace based on the current directory
-func (w *WorkspaceCmd) SelectOrCreateWorkspace() error {
-	currentDir, err := os.Getwd()
+func (w *WorkspaceCmd) SelectOrCreateWorkspace(ctx context.Context) error {
+	namer, err := w.loadNamer(ctx)
 	if err != nil {
-		return fmt.Errorf("error getting current directory: %v", err)
+		return err
 	}
 
-	baseDirIndex := strings.Index(currentDir, providerBaseDir)
-	if baseDirIndex == -1 {
-		return fmt.Errorf("current directory is not within the %s directory", providerBaseDir)
+	return w.selectOrCreateWorkspace(ctx, namer)
+}
+
+// selectOrCreateWorkspace selects or creates the workspace the naming strategy gives the working directory
+func (w *WorkspaceCmd) selectOrCreateWorkspace(ctx context.Context, namer *utils.WorkspaceNamer) error {
+	currentDir, err := w.workingDir()
+	if err != nil {
+		return err
 	}
 
-	baseDir := currentDir[:baseDirIndex+len(providerBaseDir)]
-	relativePath, err := filepath.Rel(baseDir, currentDir)
+	if _, err := namer.Layout.RelativePath(currentDir); err != nil {
+		return fmt.Errorf("current directory is not within the %s directory", namer.Layout.Root)
+	}
+	workspace, err := namer.Name(currentDir)
 	if err != nil {
-		return fmt.Errorf("error calculating relative path: %v", err)
+		return err
 	}
 
-	workspace := strings.ReplaceAll(relativePath, string(filepath.Separator), "_")
-	workspace = strings.TrimPrefix(workspace, string(filepath.Separator))
+	fmt.Fprintf(w.output(), "Selecting or creating workspace: %s\n", workspace)
 
-	fmt.Printf("Selecting or creating workspace: %s\n", workspace)
+	if w.workspaces != nil {
+		err = w.workspaces.SelectOrCreate(ctx, currentDir, workspace)
+	} else {
+		err = w.runTerraformCommand(ctx,
+			fmt.Sprintf("Selecting workspace: %s", workspace),
+			"workspace", "select", "--or-create",
+			workspace)
+	}
+	if err != nil {
+		return err
+	}
+	return w.record("workspace-select-or-create", workspace)
+}
 
-	return runTerraformCommand(
-		fmt.Sprintf("Selecting workspace: %s", workspace),
-		"terraform", "workspace", "select", "--or-create",
-		workspace)
+// loadNamer returns the workspace naming from the config file, or the default naming when no config is given
+func (w *WorkspaceCmd) loadNamer(ctx context.Context) (*utils.WorkspaceNamer, error) {
+	loadedConfig, err := w.loadConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
 
+	layout, err := loadedConfig.Layout.Build()
+	if err != nil {
+		return nil, err
+	}
+	return loadedConfig.Workspace.Build(layout)
 }
 
-// DeleteWorkspace deletes the specified workspace
-func (w *WorkspaceCmd) DeleteWorkspace(workspace string) error {
-	return runTerraformCommand(
-		fmt.Sprintf("Deleting workspace: %s", workspace),
-		"terraform", "workspace", "delete", workspace)
+// loadConfig loads the config file, or returns an empty config when no config is given
+func (w *WorkspaceCmd) loadConfig(ctx context.Context) (*config.TerraformHybridConfig, error) {
+	if w.Config == "" {
+		return &config.TerraformHybridConfig{}, nil
+	}
+
+	loadedConfig, err := config.NewConfigLoader().LoadConfig(ctx, w.Config)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %v", err)
+	}
+	return loadedConfig, nil
 }
 
-func runTerraformCommand(message string, args ...string) error {
-	fmt.Println(message)
-	fmt.Printf("Running terraform command: %s\n", strings.Join(args, " "))
-	cmd := exec.Command(args[0], args[1:]...)
-	output, err := cmd.CombinedOutput()
-	fmt.Println(string(output))
+// DeleteWorkspace deletes the specified workspace. The workspace must not track resources unless
+// --force is given, and its state is backed up and the deletion logged with the caller identity first.
+func (w *WorkspaceCmd) DeleteWorkspace(ctx context.Context, name string) error {
+	if err := utils.ValidateWorkspaceName(name); err != nil {
+		return err
+	}
+	if name == utils.DefaultWorkspace {
+		return fmt.Errorf("the default workspace cannot be deleted")
+	}
+	dir, err := w.workingDir()
+	if err != nil {
+		return err
+	}
+
+	if w.workspaces != nil {
+		// Hold the lock from reading the state until it is deleted, terraform locks on its own
+		unlock, err := w.workspaces.Lock(ctx, dir, name, "workspace delete", w.audit.Who())
+		if err != nil {
+			return err
+		}
+		defer func() { _ = unlock() }()
+	}
+
+	state, err := w.workspaceState(ctx, dir, name)
 	if err != nil {
-		return fmt.Errorf("error executing command: %v, output: %s", err, string(output))
+		return err
+	}
+	resources, err := workspace.CountResources(state)
+	if err != nil {
+		return fmt.Errorf("error inspecting state of workspace %s: %v", name, err)
+	}
+	if resources > 0 && !w.Force {
+		return fmt.Errorf("workspace %s still tracks %d resources, destroy them first or use --force to delete it anyway", name, resources)
+	}
+
+	out := w.output()
+	backup := "no state to back up"
+	if len(state) > 0 {
+		path, err := workspace.WriteBackup(dir, w.BackupDir, name, state, time.Now())
+		if err != nil {
+			return err
+		}
+		backup = fmt.Sprintf("state backed up to %s", path)
+		fmt.Fprintf(out, "Backed up state of workspace %s to %s\n", name, path)
+	}
+	message := fmt.Sprintf("Deleting workspace: %s", name)
+	if w.workspaces != nil {
+		fmt.Fprintln(out, message)
+		err = w.workspaces.Delete(ctx, dir, name, state)
+	} else {
+		// Without -force terraform checks again that the state tracks no resources while holding its state lock
+		args := []string{"workspace", "delete"}
+		if resources > 0 {
+			args = append(args, "-force")
+		}
+		err = w.runTerraformCommand(ctx, message, append(args, name)...)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Workspace %s of %s with %d resources deleted by %s, %s\n", name, dir, resources, w.audit.Who(), backup)
+	return w.record("workspace-delete", fmt.Sprintf("workspace %s with %d resources, %s", name, resources, backup))
+}
+
+// workspaceState reads the state of a workspace from the backend, or with terraform state pull
+func (w *WorkspaceCmd) workspaceState(ctx context.Context, dir, name string) ([]byte, error) {
+	if w.workspaces != nil {
+		return w.workspaces.State(ctx, dir, name)
 	}
-	return nil
+
+	state, err := w.captureTerraform(ctx, w.Dir, append(slices.Clone(w.env), "TF_WORKSPACE="+name), "state", "pull")
+	if err != nil {
+		return nil, fmt.Errorf("error reading state of workspace %s: %v", name, err)
+	}
+	if strings.TrimSpace(state) == "" {
+		return nil, nil
+	}
+	return []byte(state), nil
+}
+
+// record adds an operation in the working directory to the audit log
+func (w *WorkspaceCmd) record(operation, detail string) error {
+	dir, err := w.workingDir()
+	if err != nil {
+		return err
+	}
+	return w.audit.Record(operation, dir, detail)
+}
+
+// workingDir returns the root module directory the command runs in
+func (w *WorkspaceCmd) workingDir() (string, error) {
+	if w.Dir != "" {
+		return filepath.Abs(w.Dir)
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("error getting current directory: %v", err)
+	}
+	return currentDir, nil
+}
+
+// output returns where the command writes its output
+func (w *WorkspaceCmd) output() io.Writer {
+	if w.stdout == nil {
+		return os.Stdout
+	}
+	return w.stdout
+}
+
+// runTerraformCommand runs terraform in the working directory, streaming its output
+func (w *WorkspaceCmd) runTerraformCommand(ctx context.Context, message string, args ...string) error {
+	stdout, stderr := w.output(), w.stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	cmd := terraform.Command{
+		Binary: w.binary,
+		Args:   args,
+		Dir:    w.Dir,
+		Env:    w.env,
+		Stdin:  os.Stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	}
+
+	fmt.Fprintln(stdout, message)
+	fmt.Fprintf(stdout, "Running terraform command: %s\n", cmd)
+	return w.runner.Run(ctx, cmd)
 }
@@ -0,0 +1,213 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/backend"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/aws"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/terraform"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+)
+
+// folderWorkspaces is the workspace state of one root module
+type folderWorkspaces struct {
+	Folder    string
+	Expected  string
+	Current   string
+	Available []string
+	Err       error
+}
+
+// status flags folders that are not on the workspace of the naming strategy
+func (fw *folderWorkspaces) status() string {
+	switch {
+	case fw.Err != nil:
+		return fmt.Sprintf("error: %v", fw.Err)
+	case fw.Current == fw.Expected:
+		return "ok"
+	case fw.Current == utils.DefaultWorkspace:
+		return "on default workspace"
+	default:
+		return fmt.Sprintf("expected %s", fw.Expected)
+	}
+}
+
+// runAll runs the workspace operation in every discovered root module
+func (w *WorkspaceCmd) runAll(ctx context.Context) error {
+	if w.Config == "" {
+		return fmt.Errorf("--all requires --config to discover root modules")
+	}
+	if w.Dir != "" {
+		return fmt.Errorf("--all cannot be combined with --dir")
+	}
+
+	manager := backend.NewTerraformBackendManager(config.NewConfigLoader(), utils.NewFolderFinder(), *backend.NewBackendFactory())
+	selection, err := manager.SelectFolders(ctx, w.Config, w.ProviderFolder, utils.FolderFilter{
+		Accounts:     w.Account,
+		Include:      w.Include,
+		Exclude:      w.Exclude,
+		ChangedSince: w.ChangedSince,
+	})
+	if err != nil {
+		return err
+	}
+
+	if w.VerifyAccounts && !w.List {
+		if err := backend.VerifyAccounts(selection, w.identity(selection.Config), w.output()); err != nil {
+			return err
+		}
+	}
+
+	if w.assumer == nil {
+		w.assumer = aws.NewRoleAssumer()
+	}
+
+	closeBackend, err := w.setup(selection.Config)
+	if err != nil {
+		return err
+	}
+	defer closeBackend()
+	w.openAudit(selection.Config)
+
+	switch {
+	case w.List:
+		return w.listAll(ctx, selection)
+	case w.SelectOrCreate:
+		return w.forEachFolder(ctx, selection, func(ctx context.Context, folderCmd *WorkspaceCmd) error {
+			return folderCmd.selectOrCreateWorkspace(ctx, selection.Namer)
+		})
+	case w.Delete != "":
+		return w.forEachFolder(ctx, selection, func(ctx context.Context, folderCmd *WorkspaceCmd) error {
+			return folderCmd.DeleteWorkspace(ctx, w.Delete)
+		})
+	default:
+		return fmt.Errorf("--all supports --list, --select-or-create and --delete")
+	}
+}
+
+// forEachFolder runs an operation with a WorkspaceCmd for every selected folder
+func (w *WorkspaceCmd) forEachFolder(
+	ctx context.Context, selection *backend.FolderSelection, operation func(context.Context, *WorkspaceCmd) error,
+) error {
+	return utils.ProcessFolders(ctx, selection.Folders, w.Parallelism, w.output(), func(ctx context.Context, folder string, out io.Writer) error {
+		fmt.Fprintf(out, "Processing subfolder: %s\n", folder)
+		env, err := backend.AccountEnv(selection, folder, w.assumer)
+		if err != nil {
+			return err
+		}
+		return operation(ctx, &WorkspaceCmd{
+			Dir:        folder,
+			Force:      w.Force,
+			BackupDir:  w.BackupDir,
+			runner:     w.runner,
+			workspaces: w.workspaces,
+			audit:      w.audit,
+			env:        env,
+			stdout:     out,
+			stderr:     out,
+		})
+	})
+}
+
+// listAll prints a table of the current and available workspaces of every folder,
+// flagging folders that are not on the workspace of the naming strategy
+func (w *WorkspaceCmd) listAll(ctx context.Context, selection *backend.FolderSelection) error {
+	var mu sync.Mutex
+	results := map[string]*folderWorkspaces{}
+
+	err := utils.ProcessFolders(ctx, selection.Folders, w.Parallelism, io.Discard, func(ctx context.Context, folder string, _ io.Writer) error {
+		result := w.inspectWorkspaces(ctx, selection, folder)
+		mu.Lock()
+		results[folder] = result
+		mu.Unlock()
+		return result.Err
+	})
+
+	out := w.output()
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FOLDER\tCURRENT\tWORKSPACES\tSTATUS")
+	mismatched := 0
+	for _, folder := range selection.Folders {
+		result, ok := results[folder]
+		if !ok {
+			continue
+		}
+		if result.Err == nil && result.Current != result.Expected {
+			mismatched++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", folder, utils.OrDash(result.Current), utils.OrDash(strings.Join(result.Available, ",")), result.status())
+	}
+	if flushErr := tw.Flush(); flushErr != nil {
+		return flushErr
+	}
+
+	fmt.Fprintf(out, "\n%d of %d folders are not on the workspace of the %s strategy\n", mismatched, len(results), selection.Namer.Strategy)
+	return err
+}
+
+// inspectWorkspaces reads the current and available workspaces of a folder
+func (w *WorkspaceCmd) inspectWorkspaces(ctx context.Context, selection *backend.FolderSelection, folder string) *folderWorkspaces {
+	result := &folderWorkspaces{Folder: folder}
+	result.Expected, _ = selection.Workspaces.Name(folder)
+
+	if w.workspaces != nil {
+		result.Current, result.Err = w.workspaces.Current(folder)
+		if result.Err == nil {
+			result.Available, result.Err = w.workspaces.List(ctx, folder)
+		}
+		return result
+	}
+
+	env, err := backend.AccountEnv(selection, folder, w.assumer)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	current, err := w.captureTerraform(ctx, folder, env, "workspace", "show")
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Current = strings.TrimSpace(current)
+
+	list, err := w.captureTerraform(ctx, folder, env, "workspace", "list")
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Available = parseWorkspaceList(list)
+	return result
+}
+
+// captureTerraform runs terraform in a folder with additional environment variables and returns its output
+func (w *WorkspaceCmd) captureTerraform(ctx context.Context, folder string, env []string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := w.runner.Run(ctx, terraform.Command{Binary: w.binary, Args: args, Dir: folder, Env: env, Stdout: &stdout, Stderr: &stderr})
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%v: %s", err, message)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// parseWorkspaceList parses the output of `terraform workspace list`, where the current workspace is marked with *
+func parseWorkspaceList(output string) []string {
+	var workspaces []string
+	for _, line := range strings.Split(output, "\n") {
+		name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "*"))
+		if name != "" {
+			workspaces = append(workspaces, name)
+		}
+	}
+	return workspaces
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+)
+
+// listNative prints the workspaces of the backend, marking the selected workspace with * like terraform
+func (w *WorkspaceCmd) listNative(ctx context.Context) error {
+	dir, err := w.workingDir()
+	if err != nil {
+		return err
+	}
+
+	names, err := w.workspaces.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+	current, err := w.workspaces.Current(dir)
+	if err != nil {
+		return err
+	}
+
+	out := w.output()
+	fmt.Fprintln(out, "Listing available workspaces...")
+	for _, name := range names {
+		marker := " "
+		if name == current {
+			marker = "*"
+		}
+		fmt.Fprintf(out, "%s %s\n", marker, name)
+	}
+	return nil
+}
+
+// currentNative prints the selected workspace
+func (w *WorkspaceCmd) currentNative() error {
+	dir, err := w.workingDir()
+	if err != nil {
+		return err
+	}
+
+	current, err := w.workspaces.Current(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w.output(), "Showing current workspace...")
+	fmt.Fprintln(w.output(), current)
+	return nil
+}
+
+// runNative prints a message and runs a workspace operation in the working directory
+func (w *WorkspaceCmd) runNative(message string, operation func(dir string) error) error {
+	dir, err := w.workingDir()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w.output(), message)
+	return operation(dir)
+}
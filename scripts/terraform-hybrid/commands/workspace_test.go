@@ -0,0 +1,426 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/audit"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/aws"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/clientstest"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/terraform"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCommands(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Commands Suite")
+}
+
+var _ = Describe("WorkspaceCmd", func() {
+	var (
+		runner *terraform.FakeRunner
+		stdout *bytes.Buffer
+		cmd    *WorkspaceCmd
+	)
+
+	BeforeEach(func() {
+		// Backups of deleted workspaces go to the user cache directory
+		GinkgoT().Setenv("XDG_CACHE_HOME", GinkgoT().TempDir())
+		runner = terraform.NewFakeRunner()
+		stdout = &bytes.Buffer{}
+		auditLog := audit.NewLog(filepath.Join(GinkgoT().TempDir(), "audit.log"), "alice")
+		cmd = &WorkspaceCmd{runner: runner, caller: &clientstest.FakeCaller{Name: "alice"}, audit: auditLog, stdout: stdout, stderr: stdout}
+	})
+
+	DescribeTable("should run the matching terraform workspace command",
+		func(configure func(*WorkspaceCmd), expectedArgs []string) {
+			configure(cmd)
+			Expect(cmd.Run(context.Background())).To(Succeed())
+			Expect(runner.Args()).To(Equal([][]string{expectedArgs}))
+		},
+		Entry("list", func(w *WorkspaceCmd) { w.List = true }, []string{"workspace", "list"}),
+		Entry("current", func(w *WorkspaceCmd) { w.Current = true }, []string{"workspace", "show"}),
+		Entry("new", func(w *WorkspaceCmd) { w.New = "dev" }, []string{"workspace", "new", "dev"}),
+		Entry("select", func(w *WorkspaceCmd) { w.Select = "dev" }, []string{"workspace", "select", "dev"}),
+	)
+
+	It("should refuse workspace names outside the workspace directory", func() {
+		cmd.New = "../../x"
+		Expect(cmd.Run(context.Background())).To(MatchError(ContainSubstring(`workspace "../../x" contains characters`)))
+		Expect(runner.Calls()).To(BeEmpty())
+	})
+
+	It("should fail without an operation", func() {
+		err := cmd.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("no workspace operation provided")))
+		Expect(runner.Calls()).To(BeEmpty())
+	})
+
+	It("should stream terraform output", func() {
+		runner.On(terraform.FakeResponse{Stdout: "  default\n* dev\n"}, "workspace", "list")
+		cmd.List = true
+		Expect(cmd.Run(context.Background())).To(Succeed())
+		Expect(stdout.String()).To(ContainSubstring("* dev"))
+	})
+
+	Describe("DeleteWorkspace", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+			cmd.Dir = dir
+			cmd.Delete = "dev"
+		})
+
+		It("should delete a workspace without state and log the caller", func() {
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()).To(Equal([][]string{{"state", "pull"}, {"workspace", "delete", "dev"}}))
+			Expect(runner.Calls()[0].Env).To(Equal([]string{"TF_WORKSPACE=dev"}))
+			Expect(stdout.String()).To(ContainSubstring("Workspace dev of " + dir + " with 0 resources deleted by alice, no state to back up"))
+
+			data, err := os.ReadFile(cmd.audit.Path())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(`"who":"alice","operation":"workspace-delete","folder":"` + dir + `"`))
+		})
+
+		It("should refuse to delete a workspace that tracks resources", func() {
+			runner.On(terraform.FakeResponse{Stdout: resourceState}, "state", "pull")
+
+			err := cmd.Run(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("workspace dev still tracks 2 resources")))
+			Expect(runner.Args()).To(Equal([][]string{{"state", "pull"}}))
+		})
+
+		It("should back up the state and force the deletion with --force", func() {
+			runner.On(terraform.FakeResponse{Stdout: resourceState}, "state", "pull")
+			cmd.Force = true
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()[1]).To(Equal([]string{"workspace", "delete", "-force", "dev"}))
+			backups, err := filepath.Glob(filepath.Join(os.Getenv("XDG_CACHE_HOME"), "terraform-hybrid", "backups", "dev-*.tfstate"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(backups).To(HaveLen(1))
+			Expect(os.ReadFile(backups[0])).To(Equal([]byte(resourceState)))
+			Expect(stdout.String()).To(ContainSubstring("with 2 resources deleted by alice, state backed up to " + backups[0]))
+		})
+
+		It("should refuse to delete the default workspace", func() {
+			cmd.Delete = "default"
+			Expect(cmd.Run(context.Background())).To(MatchError("the default workspace cannot be deleted"))
+			Expect(runner.Calls()).To(BeEmpty())
+		})
+	})
+
+	It("should return terraform failures", func() {
+		runner.On(terraform.FakeResponse{Err: errors.New("exit status 1")}, "workspace", "delete")
+		cmd.Delete = "dev"
+		Expect(cmd.Run(context.Background())).To(MatchError("exit status 1"))
+	})
+
+	Describe("SelectOrCreateWorkspace", func() {
+		var root string
+
+		BeforeEach(func() {
+			root = GinkgoT().TempDir()
+		})
+
+		It("should derive the workspace from the path under deploy/provider", func() {
+			cmd.Dir = filepath.Join(root, "deploy", "provider", "aws", "accounts", "prod", "component", "vpc")
+			Expect(os.MkdirAll(cmd.Dir, 0755)).To(Succeed())
+			cmd.SelectOrCreate = true
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()).To(Equal([][]string{
+				{"workspace", "select", "--or-create", "aws_accounts_prod_component_vpc"},
+			}))
+			Expect(runner.Calls()[0].Dir).To(Equal(cmd.Dir))
+		})
+
+		It("should use the layout root from the config", func() {
+			configFile := filepath.Join(root, "aws.yaml")
+			Expect(os.WriteFile(configFile, []byte(`
+global:
+  backend_type: local
+  backend:
+    path: state
+layout:
+  root: live
+`), 0644)).To(Succeed())
+			cmd.Config = configFile
+			cmd.Dir = filepath.Join(root, "live", "aws", "vpc")
+			Expect(os.MkdirAll(cmd.Dir, 0755)).To(Succeed())
+			cmd.SelectOrCreate = true
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()).To(Equal([][]string{{"workspace", "select", "--or-create", "aws_vpc"}}))
+		})
+
+		It("should use the workspace strategy from the config", func() {
+			configFile := filepath.Join(root, "aws.yaml")
+			Expect(os.WriteFile(configFile, []byte(`
+global:
+  backend_type: local
+  backend:
+    path: state
+layout:
+  root: live
+  path_template: "{provider}/{account}/{stack}"
+workspace:
+  strategy: template
+  template: "{account}-{stack}"
+`), 0644)).To(Succeed())
+			cmd.Config = configFile
+			cmd.Dir = filepath.Join(root, "live", "aws", "prod", "vpc")
+			Expect(os.MkdirAll(cmd.Dir, 0755)).To(Succeed())
+			cmd.SelectOrCreate = true
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()).To(Equal([][]string{{"workspace", "select", "--or-create", "prod-vpc"}}))
+		})
+
+		It("should select the workspace without terraform when the backend is managed natively", func() {
+			GinkgoT().Setenv("TF_WORKSPACE", "")
+			configFile := filepath.Join(root, "aws.yaml")
+			Expect(os.WriteFile(configFile, []byte(`
+global:
+  backend_type: local
+  backend:
+    path: state
+layout:
+  root: live
+`), 0644)).To(Succeed())
+			cmd.Config = configFile
+			cmd.Native = true
+			cmd.Dir = filepath.Join(root, "live", "aws", "vpc")
+			Expect(os.MkdirAll(cmd.Dir, 0755)).To(Succeed())
+			cmd.SelectOrCreate = true
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Calls()).To(BeEmpty())
+			Expect(os.ReadFile(filepath.Join(cmd.Dir, ".terraform", "environment"))).To(Equal([]byte("aws_vpc")))
+		})
+
+		It("should run terraform for a local backend unless --native is given", func() {
+			configFile := filepath.Join(root, "aws.yaml")
+			Expect(os.WriteFile(configFile, []byte(`
+global:
+  backend_type: local
+  backend:
+    path: state
+layout:
+  root: live
+`), 0644)).To(Succeed())
+			cmd.Config = configFile
+			cmd.Dir = filepath.Join(root, "live", "aws", "vpc")
+			Expect(os.MkdirAll(cmd.Dir, 0755)).To(Succeed())
+			cmd.SelectOrCreate = true
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()).To(Equal([][]string{{"workspace", "select", "--or-create", "aws_vpc"}}))
+			Expect(filepath.Join(cmd.Dir, ".terraform", "environment")).NotTo(BeAnExistingFile())
+		})
+
+		It("should fail outside the layout root", func() {
+			cmd.Dir = root
+			cmd.SelectOrCreate = true
+
+			err := cmd.Run(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("not within the deploy/provider directory")))
+			Expect(runner.Calls()).To(BeEmpty())
+		})
+	})
+
+	Describe("in the folder of an account", func() {
+		It("should run terraform with the credentials of the role of the account", func() {
+			root := GinkgoT().TempDir()
+			cmd.Config = filepath.Join(root, "aws.yaml")
+			Expect(os.WriteFile(cmd.Config, []byte(`
+global:
+  backend_type: local
+  backend:
+    path: state
+  accounts:
+    prod:
+      id: "123456789012"
+      role_arn: arn:aws:iam::123456789012:role/terraform
+layout:
+  root: `+filepath.Join(root, "live")+`
+  path_template: "{provider}/{account}/{stack}"
+`), 0644)).To(Succeed())
+			cmd.Dir = filepath.Join(root, "live", "aws", "prod", "network")
+			Expect(os.MkdirAll(cmd.Dir, 0755)).To(Succeed())
+			client := &fakeSTS{}
+			cmd.assumer = &aws.RoleAssumer{
+				NewSTS:      func(string, string) (stsiface.STSAPI, error) { return client, nil },
+				SessionName: aws.DefaultSessionName,
+			}
+			runner.On(terraform.FakeResponse{Stdout: `{"resources": []}`}, "state", "pull")
+			cmd.Delete = "old"
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			credentials := []string{"AWS_ACCESS_KEY_ID=ASIAEXAMPLE", "AWS_SECRET_ACCESS_KEY=secret", "AWS_SESSION_TOKEN=token"}
+			Expect(runner.Args()).To(Equal([][]string{{"state", "pull"}, {"workspace", "delete", "old"}}))
+			Expect(runner.Calls()[0].Env).To(Equal(append(credentials, "TF_WORKSPACE=old")))
+			Expect(runner.Calls()[1].Env).To(Equal(credentials))
+			Expect(client.assumed).To(Equal(1))
+		})
+	})
+
+	Describe("--all", func() {
+		var (
+			root    string
+			folders []string
+		)
+
+		BeforeEach(func() {
+			root = GinkgoT().TempDir()
+			cmd.Config = filepath.Join(root, "aws.yaml")
+			Expect(os.WriteFile(cmd.Config, []byte(`
+global:
+  backend_type: local
+  backend:
+    path: state
+  accounts:
+    dev: "111111111111"
+    prod: "222222222222"
+layout:
+  root: `+filepath.Join(root, "live")+`
+  path_template: "{provider}/{account}/{stack}"
+audit:
+  log: `+filepath.Join(root, "audit.log")+`
+`), 0644)).To(Succeed())
+			cmd.audit = nil
+
+			folders = nil
+			for _, account := range []string{"dev", "prod"} {
+				dir := filepath.Join(root, "live", "aws", account, "network")
+				Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(dir, "main.tf"), []byte("resource \"null_resource\" \"this\" {}\n"), 0644)).To(Succeed())
+				folders = append(folders, dir)
+			}
+			cmd.All = true
+		})
+
+		It("should select or create the workspace of every folder", func() {
+			cmd.SelectOrCreate = true
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()).To(Equal([][]string{
+				{"workspace", "select", "--or-create", "aws_dev_network"},
+				{"workspace", "select", "--or-create", "aws_prod_network"},
+			}))
+			Expect(runner.Calls()[1].Dir).To(Equal(folders[1]))
+
+			data, err := os.ReadFile(filepath.Join(root, "audit.log"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Count(string(data), `"who":"alice","operation":"workspace-select-or-create"`)).To(Equal(2))
+		})
+
+		It("should only run in the filtered folders", func() {
+			cmd.Delete = "old"
+			cmd.Account = []string{"prod"}
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(runner.Args()).To(Equal([][]string{{"state", "pull"}, {"workspace", "delete", "old"}}))
+			Expect(runner.Calls()[1].Dir).To(Equal(folders[1]))
+		})
+
+		It("should refuse to change the workspaces of another account", func() {
+			cmd.SelectOrCreate = true
+			cmd.VerifyAccounts = true
+			cmd.caller = &clientstest.FakeCaller{Name: "alice", Account: "222222222222"}
+
+			err := cmd.Run(context.Background())
+			Expect(err).To(MatchError(HavePrefix("refusing to continue, the active credentials act in account 222222222222 but account dev is configured as 111111111111; ")))
+			Expect(runner.Calls()).To(BeEmpty())
+		})
+
+		It("should list the workspaces of every folder and flag folders on the wrong workspace", func() {
+			runner.OnIn(folders[0], terraform.FakeResponse{Stdout: "aws_dev_network\n"}, "workspace", "show")
+			runner.OnIn(folders[0], terraform.FakeResponse{Stdout: "  default\n* aws_dev_network\n"}, "workspace", "list")
+			runner.OnIn(folders[1], terraform.FakeResponse{Stdout: "default\n"}, "workspace", "show")
+			runner.OnIn(folders[1], terraform.FakeResponse{Stdout: "* default\n"}, "workspace", "list")
+			cmd.List = true
+
+			Expect(cmd.Run(context.Background())).To(Succeed())
+
+			Expect(stdout.String()).To(MatchRegexp(`dev/network\s+aws_dev_network\s+default,aws_dev_network\s+ok`))
+			Expect(stdout.String()).To(MatchRegexp(`prod/network\s+default\s+default\s+on default workspace`))
+			Expect(stdout.String()).To(ContainSubstring("1 of 2 folders are not on the workspace of the path strategy"))
+		})
+
+		It("should manage the workspaces of the local backend without terraform", func() {
+			GinkgoT().Setenv("TF_WORKSPACE", "")
+			cmd.Native = true
+			cmd.SelectOrCreate = true
+			Expect(cmd.Run(context.Background())).To(Succeed())
+			Expect(runner.Calls()).To(BeEmpty())
+
+			Expect(os.ReadFile(filepath.Join(folders[0], ".terraform", "environment"))).To(Equal([]byte("aws_dev_network")))
+			Expect(filepath.Join(folders[1], "terraform.tfstate.d", "aws_prod_network", "terraform.tfstate")).To(BeAnExistingFile())
+
+			stdout.Reset()
+			listCmd := &WorkspaceCmd{Config: cmd.Config, All: true, Native: true, List: true, runner: runner, stdout: stdout}
+			Expect(listCmd.Run(context.Background())).To(Succeed())
+			Expect(stdout.String()).To(MatchRegexp(`prod/network\s+aws_prod_network\s+default,aws_prod_network\s+ok`))
+			Expect(runner.Calls()).To(BeEmpty())
+		})
+
+		It("should refuse to delete a native workspace that tracks resources", func() {
+			GinkgoT().Setenv("TF_WORKSPACE", "")
+			stateDir := filepath.Join(folders[0], "terraform.tfstate.d", "old")
+			Expect(os.MkdirAll(stateDir, 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(stateDir, "terraform.tfstate"), []byte(resourceState), 0644)).To(Succeed())
+			cmd.Native = true
+			cmd.Delete = "old"
+			cmd.Account = []string{"dev"}
+
+			Expect(cmd.Run(context.Background())).To(MatchError(ContainSubstring("workspace old still tracks 2 resources")))
+			Expect(stateDir).To(BeADirectory())
+			Expect(filepath.Join(stateDir, ".terraform.tfstate.lock.info")).NotTo(BeAnExistingFile())
+
+			cmd.Force = true
+			Expect(cmd.Run(context.Background())).To(Succeed())
+			Expect(stateDir).NotTo(BeADirectory())
+			Expect(runner.Calls()).To(BeEmpty())
+		})
+
+		It("should require --config", func() {
+			cmd.Config = ""
+			cmd.List = true
+			Expect(cmd.Run(context.Background())).To(MatchError(ContainSubstring("--all requires --config")))
+		})
+
+		It("should reject operations on a single workspace", func() {
+			cmd.Select = "dev"
+			Expect(cmd.Run(context.Background())).To(MatchError(ContainSubstring("--all supports")))
+		})
+	})
+})
+
+// resourceState is a state tracking two managed resource instances and a data source
+const resourceState = `{
+  "version": 4,
+  "serial": 3,
+  "lineage": "3f0c1e4a-5b7d-4c2e-9a1f-0d2b3c4e5f60",
+  "resources": [
+    {"mode": "managed", "type": "null_resource", "name": "this", "instances": [{}, {}]},
+    {"mode": "data", "type": "aws_caller_identity", "name": "current", "instances": [{}]}
+  ]
+}`
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultPath is the audit log used when the config does not choose one, relative to the current directory
+const DefaultPath = ".terraform-hybrid/audit.log"
+
+// Event is one state-changing operation
+type Event struct {
+	Time      time.Time `json:"time"`
+	Who       string    `json:"who"`
+	Operation string    `json:"operation"`
+	Folder    string    `json:"folder"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// Log appends events as JSON lines to a file shared by every command
+type Log struct {
+	mu   sync.Mutex
+	path string
+	who  string
+	now  func() time.Time
+}
+
+// NewLog creates a Log writing to path and attributing every entry to who
+func NewLog(path, who string) *Log {
+	if path == "" {
+		path = DefaultPath
+	}
+	return &Log{path: path, who: who, now: time.Now}
+}
+
+// Path returns the file the log is written to
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Who returns whom the events are attributed to, empty for a nil Log
+func (l *Log) Who() string {
+	if l == nil {
+		return ""
+	}
+	return l.who
+}
+
+// Record appends an operation on a folder to the log. Recording on a nil Log does nothing.
+func (l *Log) Record(operation, folder, detail string) error {
+	if l == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(Event{Time: l.now().UTC(), Who: l.who, Operation: operation, Folder: folder, Detail: detail})
+	if err != nil {
+		return fmt.Errorf("error encoding audit entry: %v", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("error creating audit log directory: %v", err)
+	}
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing audit log: %v", err)
+	}
+	return nil
+}
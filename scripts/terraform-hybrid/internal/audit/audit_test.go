@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAudit(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Audit Suite")
+}
+
+var _ = Describe("Log", func() {
+	It("should append entries as JSON lines", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "logs", "audit.log")
+		log := NewLog(path, "alice")
+		log.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+		Expect(log.Record("generate-backend", "/repo/aws/vpc", "")).To(Succeed())
+		Expect(log.Record("workspace-delete", "/repo/aws/vpc", "workspace old")).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(MatchJSON(`{"time": "2024-05-01T12:00:00Z", "who": "alice", "operation": "generate-backend", "folder": "/repo/aws/vpc"}`))
+		Expect(lines[1]).To(MatchJSON(`{"time": "2024-05-01T12:00:00Z", "who": "alice", "operation": "workspace-delete", "folder": "/repo/aws/vpc", "detail": "workspace old"}`))
+	})
+
+	It("should ignore entries recorded on a nil log", func() {
+		var log *Log
+		Expect(log.Record("generate-backend", "/repo/aws/vpc", "")).To(Succeed())
+	})
+})
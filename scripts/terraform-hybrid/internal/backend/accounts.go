@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/aws"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+)
+
+// SelectedAccounts returns the configured accounts of the selected folders in name order,
+// none when no accounts are configured
+func SelectedAccounts(selection *FolderSelection) []string {
+	if len(selection.Config.Global.Accounts) == 0 {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var accounts []string
+	for _, folder := range selection.Folders {
+		account, ok := accountForFolder(selection.Layout, selection.ProviderFolder, folder)
+		if _, configured := selection.Config.Global.Accounts[account]; !ok || !configured || seen[account] {
+			continue
+		}
+		seen[account] = true
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// VerifyAccounts refuses to continue when the active credentials of the caller act in another account
+// than the configured ID of an account the selected folders belong to. The active credentials act in a
+// single account, so folders of accounts with different IDs can only run together when those accounts
+// have a role or profile. Accounts with a role or profile are skipped, their credentials are verified
+// when acquired.
+func VerifyAccounts(selection *FolderSelection, caller clients.Caller, out io.Writer) error {
+	var accounts []string
+	for _, account := range SelectedAccounts(selection) {
+		if accountConfig := selection.Config.Global.Accounts[account]; accountConfig.RoleArn == "" && accountConfig.Profile == "" {
+			accounts = append(accounts, account)
+		}
+	}
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	liveID, err := caller.GetAccountID()
+	if err != nil {
+		return fmt.Errorf("error verifying the active account, use --no-verify-accounts to skip the check: %v", err)
+	}
+
+	var mismatches []string
+	ids := map[string]bool{}
+	for _, account := range accounts {
+		ids[selection.Config.Global.Accounts[account].ID] = true
+	}
+	for _, account := range accounts {
+		configuredID := selection.Config.Global.Accounts[account].ID
+		if configuredID != liveID {
+			mismatches = append(mismatches, fmt.Sprintf("account %s is configured as %s", account, configuredID))
+			continue
+		}
+		fmt.Fprintf(out, "Verified account %s: active credentials act in %s\n", account, liveID)
+	}
+	if len(mismatches) > 0 {
+		err := fmt.Errorf("refusing to continue, the active credentials act in account %s but %s", liveID, strings.Join(mismatches, ", "))
+		if len(ids) > 1 {
+			err = fmt.Errorf("%v; the selected folders span %d account IDs, select the folders of one account with --account"+
+				" or configure a role_arn or profile for each account", err, len(ids))
+		}
+		return err
+	}
+	return nil
+}
+
+// AccountEnv returns the environment of terraform acting in a folder: the credentials of the role of its
+// account, or its profile, and its region. It is empty outside accounts with these settings.
+func AccountEnv(selection *FolderSelection, folder string, assumer *aws.RoleAssumer) ([]string, error) {
+	if len(selection.Config.Global.Accounts) == 0 {
+		return nil, nil
+	}
+	account, ok := accountForFolder(selection.Layout, selection.ProviderFolder, folder)
+	if !ok {
+		return nil, nil
+	}
+	return accountEnv(selection.Config, account, assumer)
+}
+
+// FolderAccountEnv is AccountEnv for a single folder without a selection, such as the root module
+// of a workspace command, taking the account from the folder's path relative to the layout root
+func FolderAccountEnv(cfg *config.TerraformHybridConfig, folder string, assumer *aws.RoleAssumer) ([]string, error) {
+	if len(cfg.Global.Accounts) == 0 {
+		return nil, nil
+	}
+	layout, err := cfg.Layout.Build()
+	if err != nil {
+		return nil, err
+	}
+	relativePath, err := layout.RelativePath(folder)
+	if err != nil {
+		return nil, nil
+	}
+	values, ok := layout.Match(relativePath)
+	if !ok || values["account"] == "" {
+		return nil, nil
+	}
+	return accountEnv(cfg, values["account"], assumer)
+}
+
+// accountEnv returns the environment of terraform acting in a configured account
+func accountEnv(cfg *config.TerraformHybridConfig, account string, assumer *aws.RoleAssumer) ([]string, error) {
+	accountConfig, configured := cfg.Global.Accounts[account]
+	if !configured || (accountConfig.RoleArn == "" && accountConfig.Profile == "" && accountConfig.Region == "") {
+		return nil, nil
+	}
+
+	env, err := assumer.Env(aws.Account{
+		ID:         accountConfig.ID,
+		RoleArn:    accountConfig.RoleArn,
+		ExternalID: accountConfig.ExternalID,
+		Profile:    accountConfig.Profile,
+		Region:     accountConfig.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error acting in account %s: %v", account, err)
+	}
+	return env, nil
+}
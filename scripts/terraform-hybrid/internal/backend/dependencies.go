@@ -0,0 +1,204 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+)
+
+// BuildDependencyGraph inspects the folders for terraform_remote_state data sources reading the state
+// generated for another folder and returns the graph of folders and the folders they read.
+// Data sources reading a state outside the configured backend are ignored, and those whose location
+// depends on variables are reported as warnings to out. A data source reading a state in the configured
+// backend that no folder writes is an error.
+func BuildDependencyGraph(
+	ctx context.Context, cfg *config.TerraformHybridConfig, layout *utils.Layout, folders []string, out io.Writer,
+) (*utils.Graph, error) {
+	namer, err := cfg.Workspace.Build(layout)
+	if err != nil {
+		return nil, err
+	}
+	workspaces, err := namer.Index(folders)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := utils.NewGraph()
+	writtenBy := map[string]string{}
+	for _, folder := range folders {
+		graph.AddNode(folder)
+
+		address, err := stateAddress(cfg, layout, workspaces, folder)
+		if err != nil {
+			return nil, err
+		}
+		writtenBy[address] = folder
+	}
+
+	var errs []error
+	for _, folder := range folders {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		info, err := utils.InspectModule(folder)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range info.RemoteStates {
+			address, reason := remoteStateAddress(cfg, folder, ref)
+			switch {
+			case reason != "":
+				fmt.Fprintf(out, "Warning: ignoring %s for ordering: %s\n", ref, reason)
+			case address == "":
+				// The data source reads a state outside the configured backend
+			case writtenBy[address] == "":
+				errs = append(errs, fmt.Errorf("%s reads state %s which no discovered folder writes", ref, address))
+			default:
+				graph.AddDependency(folder, writtenBy[address])
+			}
+		}
+	}
+
+	return graph, errors.Join(errs...)
+}
+
+// stateAddress returns where the generated backend stores the state of a folder in its workspace, in the form
+// remoteStateAddress reports it: an absolute path for local, the object key for cloud storage
+// and the workspace for Postgres
+func stateAddress(cfg *config.TerraformHybridConfig, layout *utils.Layout, workspaces *utils.WorkspaceIndex, folder string) (string, error) {
+	relativePath, err := layout.RelativePath(folder)
+	if err != nil {
+		return "", err
+	}
+	workspace, ok := workspaces.Name(folder)
+	if !ok {
+		workspace = utils.DefaultWorkspace
+	}
+
+	switch backend := cfg.Global.Backend.(type) {
+	case *config.LocalBackendConfig:
+		if workspace != utils.DefaultWorkspace {
+			return localWorkspaceStatePath(folder, "", workspace), nil
+		}
+		return absoluteStatePath(folder, localStatePath(backend, relativePath)), nil
+	case *config.CloudStorageBackendConfig:
+		return workspaceStateKey(cloudStorageStateKey(relativePath), "", workspace), nil
+	case *config.PostgresBackendConfig:
+		return workspace, nil
+	default:
+		return "", fmt.Errorf("unsupported backend type: %s", cfg.Global.BackendType)
+	}
+}
+
+// remoteStateAddress returns the state a terraform_remote_state data source of a folder reads.
+// The address is empty when the data source reads a state outside the configured backend,
+// and reason explains why a data source cannot be resolved without evaluating variables.
+func remoteStateAddress(cfg *config.TerraformHybridConfig, folder string, ref utils.RemoteStateRef) (address, reason string) {
+	dynamic := func(attributes ...string) bool {
+		return slices.ContainsFunc(ref.Dynamic, func(name string) bool {
+			return name == "config" || slices.Contains(attributes, name)
+		})
+	}
+	if slices.Contains(ref.Dynamic, "backend") {
+		return "", "backend is not a literal"
+	}
+
+	workspace := ref.Workspace
+	if workspace == "" {
+		workspace = utils.DefaultWorkspace
+	}
+
+	switch backend := cfg.Global.Backend.(type) {
+	case *config.LocalBackendConfig:
+		if ref.Backend != "local" {
+			return "", ""
+		}
+		if dynamic("workspace", "config.workspace_dir") {
+			return "", "workspace or config.workspace_dir is not a literal"
+		}
+		if workspace != utils.DefaultWorkspace {
+			return localWorkspaceStatePath(folder, ref.Config["workspace_dir"], workspace), ""
+		}
+		if path, ok := ref.Config["path"]; ok {
+			return absoluteStatePath(folder, path), ""
+		}
+		if dynamic("config.path") {
+			return "", "config.path is not a literal"
+		}
+		return "", ""
+	case *config.CloudStorageBackendConfig:
+		if ref.Backend != backend.Type {
+			return "", ""
+		}
+		if bucket, ok := ref.Config["bucket"]; ok && bucket != backend.BucketName {
+			return "", ""
+		}
+		if dynamic("config.bucket", "config.key", "config.prefix", "config.workspace_key_prefix", "workspace") {
+			return "", "config.bucket, config.key, config.prefix or workspace is not a literal"
+		}
+		if prefix, ok := ref.Config["prefix"]; ok {
+			// The gcs backend stores every workspace as <prefix>/<workspace>.tfstate
+			return fmt.Sprintf("%s/%s.tfstate", strings.TrimSuffix(prefix, "/"), workspace), ""
+		}
+		key, ok := ref.Config["key"]
+		if !ok {
+			return "", "neither config.key nor config.prefix is set"
+		}
+		return workspaceStateKey(key, ref.Config["workspace_key_prefix"], workspace), ""
+	case *config.PostgresBackendConfig:
+		if ref.Backend != "pg" {
+			return "", ""
+		}
+		if schema, ok := ref.Config["schema_name"]; ok && schema != backend.SchemaName {
+			return "", ""
+		}
+		if dynamic("config.schema_name", "workspace") {
+			return "", "config.schema_name or workspace is not a literal"
+		}
+		if ref.Workspace == "" || ref.Workspace == utils.DefaultWorkspace {
+			// Generated Postgres backends never use the default workspace
+			return "", ""
+		}
+		return ref.Workspace, ""
+	default:
+		return "", ""
+	}
+}
+
+// absoluteStatePath resolves a local state path against the folder terraform runs in
+func absoluteStatePath(folder, path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(folder, path)
+	}
+	return filepath.Clean(strings.TrimSpace(path))
+}
+
+// localWorkspaceStatePath returns the state of a non-default workspace of the local backend, which terraform keeps
+// under workspaceDir (terraform.tfstate.d by default) relative to the folder it runs in
+func localWorkspaceStatePath(folder, workspaceDir, workspace string) string {
+	if workspaceDir == "" {
+		workspaceDir = "terraform.tfstate.d"
+	}
+	return absoluteStatePath(folder, filepath.Join(workspaceDir, workspace, "terraform.tfstate"))
+}
+
+// workspaceStateKey returns the object key of a workspace's state, which the s3 backend stores under
+// <workspace_key_prefix>/<workspace>/<key> for every workspace but the default one
+func workspaceStateKey(key, workspaceKeyPrefix, workspace string) string {
+	if workspace == utils.DefaultWorkspace {
+		return key
+	}
+	if workspaceKeyPrefix == "" {
+		workspaceKeyPrefix = "env:"
+	}
+	return fmt.Sprintf("%s/%s/%s", workspaceKeyPrefix, workspace, key)
+}
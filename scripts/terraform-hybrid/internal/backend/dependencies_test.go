@@ -0,0 +1,227 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BuildDependencyGraph", func() {
+	var (
+		providerRoot string
+		layout       *utils.Layout
+		hybridConfig *config.TerraformHybridConfig
+		network      string
+		app          string
+	)
+
+	// component creates a root module with the given configuration
+	component := func(relativePath, content string) string {
+		dir := filepath.Join(providerRoot, relativePath)
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "main.tf"), []byte(content), 0644)).To(Succeed())
+		return dir
+	}
+
+	BeforeEach(func() {
+		providerRoot = filepath.Join(GinkgoT().TempDir(), "deploy", "provider")
+		var err error
+		layout, err = (&config.LayoutConfig{}).Build()
+		Expect(err).To(BeNil())
+		hybridConfig = &config.TerraformHybridConfig{
+			Global: config.GlobalConfig{
+				BackendType: config.BackendTypeCloudStorage,
+				Backend:     &config.CloudStorageBackendConfig{Type: "s3", BucketName: "state"},
+			},
+		}
+		network = component("aws/accounts/prod/component/network", `resource "null_resource" "this" {}`)
+	})
+
+	It("should resolve cloud storage keys to the folders writing them", func() {
+		app = component("aws/accounts/prod/component/app", `
+data "terraform_remote_state" "network" {
+  backend   = "s3"
+  workspace = "aws_accounts_prod_component_network"
+  config = {
+    bucket = "state"
+    key    = "aws/accounts/prod/component/network/terraform.tfstate"
+  }
+}
+`)
+
+		graph, err := BuildDependencyGraph(context.Background(), hybridConfig, layout, []string{app, network}, io.Discard)
+		Expect(err).To(BeNil())
+		Expect(graph.Dependencies(app)).To(Equal([]string{network}))
+		Expect(graph.Dependencies(network)).To(BeEmpty())
+	})
+
+	It("should not resolve the default workspace key to a folder using a named workspace", func() {
+		app = component("aws/accounts/prod/component/app", `
+data "terraform_remote_state" "network" {
+  backend = "s3"
+  config = {
+    bucket = "state"
+    key    = "aws/accounts/prod/component/network/terraform.tfstate"
+  }
+}
+`)
+
+		_, err := BuildDependencyGraph(context.Background(), hybridConfig, layout, []string{app, network}, io.Discard)
+		Expect(err).To(MatchError(ContainSubstring("no discovered folder writes")))
+	})
+
+	It("should resolve the default workspace key when every folder uses the default workspace", func() {
+		hybridConfig.Workspace.Strategy = string(utils.WorkspaceStrategyDefault)
+		app = component("aws/accounts/prod/component/app", `
+data "terraform_remote_state" "network" {
+  backend = "s3"
+  config = {
+    bucket = "state"
+    key    = "aws/accounts/prod/component/network/terraform.tfstate"
+  }
+}
+`)
+
+		graph, err := BuildDependencyGraph(context.Background(), hybridConfig, layout, []string{app, network}, io.Discard)
+		Expect(err).To(BeNil())
+		Expect(graph.Dependencies(app)).To(Equal([]string{network}))
+	})
+
+	It("should resolve gcs prefixes to the workspace state", func() {
+		hybridConfig.Global.Backend = &config.CloudStorageBackendConfig{Type: "gcs", BucketName: "state"}
+		app = component("aws/accounts/prod/component/app", `
+data "terraform_remote_state" "network" {
+  backend   = "gcs"
+  workspace = "aws_accounts_prod_component_network"
+  config = {
+    bucket = "state"
+    prefix = "aws/accounts/prod/component/vpc"
+  }
+}
+`)
+
+		_, err := BuildDependencyGraph(context.Background(), hybridConfig, layout, []string{app, network}, io.Discard)
+		Expect(err).To(MatchError(ContainSubstring("aws/accounts/prod/component/vpc/aws_accounts_prod_component_network.tfstate")))
+	})
+
+	It("should ignore states in other buckets and backends", func() {
+		app = component("aws/accounts/prod/component/app", `
+data "terraform_remote_state" "shared" {
+  backend = "s3"
+  config = {
+    bucket = "other-team-state"
+    key    = "shared/terraform.tfstate"
+  }
+}
+
+data "terraform_remote_state" "legacy" {
+  backend = "gcs"
+  config = {
+    bucket = "state"
+    prefix = "legacy"
+  }
+}
+`)
+
+		graph, err := BuildDependencyGraph(context.Background(), hybridConfig, layout, []string{app, network}, io.Discard)
+		Expect(err).To(BeNil())
+		Expect(graph.Dependencies(app)).To(BeEmpty())
+	})
+
+	It("should report states in the configured bucket that no folder writes", func() {
+		app = component("aws/accounts/prod/component/app", `
+data "terraform_remote_state" "network" {
+  backend = "s3"
+  config = {
+    bucket = "state"
+    key    = "aws/accounts/prod/component/vpc/terraform.tfstate"
+  }
+}
+`)
+
+		_, err := BuildDependencyGraph(context.Background(), hybridConfig, layout, []string{app, network}, io.Discard)
+		Expect(err).To(MatchError(ContainSubstring("data.terraform_remote_state.network")))
+		Expect(err).To(MatchError(ContainSubstring("no discovered folder writes")))
+	})
+
+	It("should resolve local state paths relative to the reading folder", func() {
+		hybridConfig.Workspace.Strategy = string(utils.WorkspaceStrategyDefault)
+		hybridConfig.Global.BackendType = config.LocalBackendType
+		hybridConfig.Global.Backend = &config.LocalBackendConfig{Path: "state"}
+		app = component("aws/accounts/prod/component/app", `
+data "terraform_remote_state" "network" {
+  backend = "local"
+  config = {
+    path = "../network/state/aws/accounts/prod/component/network/terraform.tfstate"
+  }
+}
+`)
+
+		graph, err := BuildDependencyGraph(context.Background(), hybridConfig, layout, []string{app, network}, io.Discard)
+		Expect(err).To(BeNil())
+		Expect(graph.Dependencies(app)).To(Equal([]string{network}))
+	})
+
+	It("should resolve local workspace states under the workspace directory", func() {
+		hybridConfig.Global.BackendType = config.LocalBackendType
+		hybridConfig.Global.Backend = &config.LocalBackendConfig{Path: "state"}
+		app = component("aws/accounts/prod/component/app", `
+data "terraform_remote_state" "network" {
+  backend   = "local"
+  workspace = "aws_accounts_prod_component_network"
+  config = {
+    workspace_dir = "../network/terraform.tfstate.d"
+  }
+}
+`)
+
+		graph, err := BuildDependencyGraph(context.Background(), hybridConfig, layout, []string{app, network}, io.Discard)
+		Expect(err).To(BeNil())
+		Expect(graph.Dependencies(app)).To(Equal([]string{network}))
+	})
+
+	It("should resolve Postgres workspaces", func() {
+		hybridConfig.Global.BackendType = config.BackendTypePostgres
+		hybridConfig.Global.Backend = &config.PostgresBackendConfig{ConnectionString: "postgres://db", SchemaName: "terraform"}
+		app = component("aws/accounts/prod/component/app", `
+data "terraform_remote_state" "network" {
+  backend   = "pg"
+  workspace = "aws_accounts_prod_component_network"
+  config = {
+    conn_str    = var.conn_str
+    schema_name = "terraform"
+  }
+}
+`)
+
+		graph, err := BuildDependencyGraph(context.Background(), hybridConfig, layout, []string{app, network}, io.Discard)
+		Expect(err).To(BeNil())
+		Expect(graph.Dependencies(app)).To(Equal([]string{network}))
+	})
+
+	It("should skip data sources whose location is not a literal", func() {
+		app = component("aws/accounts/prod/component/app", `
+data "terraform_remote_state" "network" {
+  backend = "s3"
+  config = {
+    bucket = "state"
+    key    = "${var.account}/network/terraform.tfstate"
+  }
+}
+`)
+
+		var out bytes.Buffer
+		graph, err := BuildDependencyGraph(context.Background(), hybridConfig, layout, []string{app, network}, &out)
+		Expect(err).To(BeNil())
+		Expect(graph.Dependencies(app)).To(BeEmpty())
+		Expect(out.String()).To(ContainSubstring("Warning: ignoring data.terraform_remote_state.network"))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/terraform"
 )
 
 // WriteFactory is responsible for creating backend writers based on the backend type
@@ -13,15 +14,11 @@ func NewBackendFactory() *WriteFactory {
 	return &WriteFactory{}
 }
 
-// CreateBackendWriter creates a backend writer based on the given backend type
-func (f *WriteFactory) CreateBackendWriter(backendType config.BackendType) (Writer, error) {
+// CreateBackendWriter creates a backend writer based on the given backend type and target tool
+func (f *WriteFactory) CreateBackendWriter(backendType config.BackendType, tool *terraform.Tool) (Writer, error) {
 	switch backendType {
-	case config.LocalBackendType:
-		return &TerraformBackendWriter{}, nil
-	case config.BackendTypeCloudStorage:
-		return &TerraformBackendWriter{}, nil
-	case config.BackendTypePostgres:
-		return &TerraformBackendWriter{}, nil
+	case config.LocalBackendType, config.BackendTypeCloudStorage, config.BackendTypePostgres:
+		return &TerraformBackendWriter{Tool: tool}, nil
 	default:
 		return nil, fmt.Errorf("unsupported backend type: %s", backendType)
 	}
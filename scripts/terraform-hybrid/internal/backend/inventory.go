@@ -0,0 +1,176 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/inventory"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/postgres"
+)
+
+// NewStateStore opens the store of the states of the configured backend. A relative local path is
+// searched in every discovered folder, since terraform resolves it against the folder it runs in,
+// and so is the terraform.tfstate.d directory holding the states of the workspaces other than default.
+func NewStateStore(selection *FolderSelection) (inventory.Store, error) {
+	switch backend := selection.Config.Global.Backend.(type) {
+	case *config.LocalBackendConfig:
+		var dirs []string
+		if filepath.IsAbs(backend.Path) {
+			dirs = append(dirs, backend.Path)
+		}
+		for _, folder := range selection.Discovered {
+			if !filepath.IsAbs(backend.Path) {
+				dirs = append(dirs, filepath.Join(folder, backend.Path))
+			}
+			dirs = append(dirs, filepath.Join(folder, "terraform.tfstate.d"))
+		}
+		return inventory.NewLocalStore(dirs...), nil
+	case *config.CloudStorageBackendConfig:
+		return inventory.NewBucketStore(backend)
+	case *config.PostgresBackendConfig:
+		schema, err := postgres.Open(backend.ConnectionString, backend.SchemaName)
+		if err != nil {
+			return nil, err
+		}
+		return inventory.NewPostgresStore(schema), nil
+	default:
+		return nil, fmt.Errorf("unsupported backend type: %s", selection.Config.Global.BackendType)
+	}
+}
+
+// Inventory describes every state of the store and maps it back to the discovered folder whose
+// generated backend stores its state at the same address. States of no folder get the component
+// their address was generated for, where the address tells.
+func Inventory(ctx context.Context, selection *FolderSelection, store inventory.Store, provider string) ([]inventory.State, error) {
+	addresses, err := folderAddresses(selection)
+	if err != nil {
+		return nil, err
+	}
+	writtenBy := make(map[string]string, len(addresses))
+	for folder, address := range addresses {
+		writtenBy[address] = folder
+	}
+
+	objects, err := store.Objects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]inventory.State, 0, len(objects))
+	for _, object := range objects {
+		state := inventory.ReadState(object)
+		state.Provider = provider
+		state.Backend = selection.Config.Global.BackendType.String()
+		if folder, ok := writtenBy[object.Address]; ok {
+			state.Folder = folder
+			if relativePath, err := selection.Layout.RelativePath(folder); err == nil {
+				state.Component = filepath.ToSlash(relativePath)
+			}
+		} else {
+			state.Component = addressComponent(selection.Config, object)
+		}
+		state.Account = componentAccount(selection, state.Component)
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Orphans compares the states of the store with the discovered folders, reporting the states no folder
+// writes, such as those of components deleted from the repository, and the folders without a state
+func Orphans(ctx context.Context, selection *FolderSelection, store inventory.Store, provider string) (*inventory.Orphans, error) {
+	states, err := Inventory(ctx, selection, store, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := &inventory.Orphans{}
+	hasState := map[string]bool{}
+	for _, state := range states {
+		if state.Folder == "" {
+			orphans.States = append(orphans.States, state)
+		} else {
+			hasState[state.Folder] = true
+		}
+	}
+
+	addresses, err := folderAddresses(selection)
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range selection.Discovered {
+		if hasState[folder] {
+			continue
+		}
+		missing := inventory.MissingState{
+			Provider: provider,
+			Backend:  selection.Config.Global.BackendType.String(),
+			Address:  addresses[folder],
+			Folder:   folder,
+		}
+		if relativePath, err := selection.Layout.RelativePath(folder); err == nil {
+			missing.Component = filepath.ToSlash(relativePath)
+			missing.Account = componentAccount(selection, missing.Component)
+		}
+		orphans.Folders = append(orphans.Folders, missing)
+	}
+	return orphans, nil
+}
+
+// folderAddresses returns where the generated backend of every discovered folder stores the state
+// of the workspace the folder runs in
+func folderAddresses(selection *FolderSelection) (map[string]string, error) {
+	addresses := make(map[string]string, len(selection.Discovered))
+	for _, folder := range selection.Discovered {
+		address, err := stateAddress(selection.Config, selection.Layout, selection.Workspaces, folder)
+		if err != nil {
+			return nil, err
+		}
+		addresses[folder] = address
+	}
+	return addresses, nil
+}
+
+// addressComponent returns the path relative to the layout root a state address was generated for:
+// the reverse of cloudStorageStateKey and of localStatePath with an absolute path, also below the
+// env:/<workspace>/ prefix of a workspace. Postgres workspace names and the local states of workspaces,
+// which live in the folder itself, cannot be reversed, and other addresses give an empty component.
+func addressComponent(cfg *config.TerraformHybridConfig, object inventory.Object) string {
+	address := object.Address
+	var relativeState string
+	switch backend := cfg.Global.Backend.(type) {
+	case *config.LocalBackendConfig:
+		if !filepath.IsAbs(backend.Path) || object.Workspace != "" {
+			return ""
+		}
+		relativePath, err := filepath.Rel(filepath.Clean(backend.Path), address)
+		if err != nil || strings.HasPrefix(relativePath, "..") {
+			return ""
+		}
+		relativeState = filepath.ToSlash(relativePath)
+	case *config.CloudStorageBackendConfig:
+		relativeState = address
+		if object.Workspace != "" {
+			relativeState = strings.TrimPrefix(address, "env:/"+object.Workspace+"/")
+		}
+	default:
+		return ""
+	}
+
+	component, ok := strings.CutSuffix(relativeState, "/terraform.tfstate")
+	if !ok {
+		return ""
+	}
+	return component
+}
+
+// componentAccount returns the {account} segment of a component path relative to the layout root
+func componentAccount(selection *FolderSelection, component string) string {
+	if component == "" {
+		return ""
+	}
+	values, _ := selection.Layout.Match(filepath.FromSlash(component))
+	return values["account"]
+}
@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/inventory"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inventory", func() {
+	var (
+		providerRoot string
+		stateDir     string
+		selection    *FolderSelection
+	)
+
+	// mkdir creates a root module folder containing Terraform configuration
+	mkdir := func(relativePath string) string {
+		dir := filepath.Join(providerRoot, relativePath)
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`resource "null_resource" "this" {}`), 0644)).To(Succeed())
+		return dir
+	}
+
+	// writeState writes a state tracking one resource below the state directory
+	writeState := func(relativePath string) {
+		path := filepath.Join(stateDir, relativePath, "terraform.tfstate")
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(`{"serial": 4, "lineage": "abc", "resources": [
+  {"mode": "managed", "type": "null_resource", "name": "this", "instances": [{}]}
+]}`), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		root := GinkgoT().TempDir()
+		providerRoot = filepath.Join(root, "deploy", "provider")
+		stateDir = filepath.Join(root, "state")
+	})
+
+	// selectFolders discovers the folders created so far with an absolute local backend path and the default workspace
+	selectFolders := func() {
+		hybridConfig := &config.TerraformHybridConfig{
+			Global:    config.GlobalConfig{BackendType: config.LocalBackendType, Backend: &config.LocalBackendConfig{Path: stateDir}},
+			Workspace: config.WorkspaceConfig{Strategy: string(utils.WorkspaceStrategyDefault)},
+		}
+		manager := NewTerraformBackendManager(&fakeConfigLoader{config: hybridConfig}, utils.NewFolderFinder(), *NewBackendFactory())
+		var err error
+		selection, err = manager.SelectFolders(context.Background(), "aws.yaml", providerRoot, utils.FolderFilter{})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("should map local states to the folders whose backend writes them", func() {
+		folder := mkdir("aws/accounts/prod/component/network")
+		writeState("aws/accounts/prod/component/network")
+		writeState("aws/accounts/prod/component/legacy")
+		selectFolders()
+
+		store, err := NewStateStore(selection)
+		Expect(err).NotTo(HaveOccurred())
+		states, err := Inventory(context.Background(), selection, store, "aws")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(states).To(HaveLen(2))
+		Expect(states[0].Address).To(Equal(filepath.Join(stateDir, "aws/accounts/prod/component/legacy/terraform.tfstate")))
+		Expect(states[0].Folder).To(BeEmpty())
+		Expect(states[0].Component).To(Equal("aws/accounts/prod/component/legacy"))
+		Expect(states[0].Account).To(Equal("prod"))
+		Expect(states[1].Address).To(Equal(filepath.Join(stateDir, "aws/accounts/prod/component/network/terraform.tfstate")))
+		Expect(states[1].Folder).To(Equal(folder))
+		Expect(states[1].Account).To(Equal("prod"))
+		Expect(states[1].Component).To(Equal("aws/accounts/prod/component/network"))
+		Expect(states[1].Provider).To(Equal("aws"))
+		Expect(states[1].Backend).To(Equal("local"))
+		Expect(states[1].Serial).To(Equal(int64(4)))
+	})
+
+	It("should report states of no folder and folders without state", func() {
+		mkdir("aws/accounts/prod/component/network")
+		dns := mkdir("aws/accounts/dev/component/dns")
+		writeState("aws/accounts/prod/component/network")
+		writeState("aws/accounts/prod/component/legacy")
+		selectFolders()
+
+		store, err := NewStateStore(selection)
+		Expect(err).NotTo(HaveOccurred())
+		orphans, err := Orphans(context.Background(), selection, store, "aws")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(orphans.States).To(HaveLen(1))
+		Expect(orphans.States[0].Component).To(Equal("aws/accounts/prod/component/legacy"))
+		Expect(orphans.Resources()).To(Equal(1))
+		Expect(orphans.Folders).To(HaveLen(1))
+		Expect(orphans.Folders[0].Folder).To(Equal(dns))
+		Expect(orphans.Folders[0].Account).To(Equal("dev"))
+		Expect(orphans.Folders[0].Component).To(Equal("aws/accounts/dev/component/dns"))
+		Expect(orphans.Folders[0].Address).To(Equal(filepath.Join(stateDir, "aws/accounts/dev/component/dns/terraform.tfstate")))
+	})
+
+	It("should map the local states of workspaces to their folders", func() {
+		folder := mkdir("aws/accounts/prod/component/network")
+		workspaceState := filepath.Join(folder, "terraform.tfstate.d", "aws_accounts_prod_component_network", "terraform.tfstate")
+		Expect(os.MkdirAll(filepath.Dir(workspaceState), 0755)).To(Succeed())
+		Expect(os.WriteFile(workspaceState, []byte(`{"serial": 2, "lineage": "abc", "resources": []}`), 0644)).To(Succeed())
+		hybridConfig := &config.TerraformHybridConfig{
+			Global: config.GlobalConfig{BackendType: config.LocalBackendType, Backend: &config.LocalBackendConfig{Path: stateDir}},
+		}
+		manager := NewTerraformBackendManager(&fakeConfigLoader{config: hybridConfig}, utils.NewFolderFinder(), *NewBackendFactory())
+		selection, err := manager.SelectFolders(context.Background(), "aws.yaml", providerRoot, utils.FolderFilter{})
+		Expect(err).NotTo(HaveOccurred())
+
+		store, err := NewStateStore(selection)
+		Expect(err).NotTo(HaveOccurred())
+		states, err := Inventory(context.Background(), selection, store, "aws")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(states).To(HaveLen(1))
+		Expect(states[0].Address).To(Equal(workspaceState))
+		Expect(states[0].Workspace).To(Equal("aws_accounts_prod_component_network"))
+		Expect(states[0].Folder).To(Equal(folder))
+		Expect(states[0].Component).To(Equal("aws/accounts/prod/component/network"))
+	})
+
+	It("should reverse the addresses of cloud storage keys but not of Postgres workspaces", func() {
+		cloudStorage := &config.TerraformHybridConfig{Global: config.GlobalConfig{
+			BackendType: config.BackendTypeCloudStorage, Backend: &config.CloudStorageBackendConfig{Type: "s3", BucketName: "state"},
+		}}
+		Expect(addressComponent(cloudStorage, inventory.Object{Address: "aws/accounts/prod/component/network/terraform.tfstate"})).To(Equal("aws/accounts/prod/component/network"))
+		Expect(addressComponent(cloudStorage, inventory.Object{
+			Address: "env:/aws_accounts_prod_component_network/aws/accounts/prod/component/network/terraform.tfstate", Workspace: "aws_accounts_prod_component_network",
+		})).To(Equal("aws/accounts/prod/component/network"))
+		Expect(addressComponent(cloudStorage, inventory.Object{Address: "env:/staging/network.tfstate", Workspace: "staging"})).To(BeEmpty())
+
+		postgres := &config.TerraformHybridConfig{Global: config.GlobalConfig{
+			BackendType: config.BackendTypePostgres, Backend: &config.PostgresBackendConfig{SchemaName: "terraform_remote_state"},
+		}}
+		Expect(addressComponent(postgres, inventory.Object{Address: "aws_accounts_prod_component_network"})).To(BeEmpty())
+	})
+})
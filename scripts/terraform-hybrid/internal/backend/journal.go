@@ -0,0 +1,203 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+)
+
+// DefaultJournalPath is where an atomic run keeps its journal until it completes, relative to the working directory
+const DefaultJournalPath = ".terraform-hybrid/journal.json"
+
+// JournalEntry records the content of a file before a run changed it
+type JournalEntry struct {
+	Path     string      `json:"path"`
+	Existed  bool        `json:"existed"`
+	Previous []byte      `json:"previous,omitempty"`
+	Mode     fs.FileMode `json:"mode,omitempty"`
+}
+
+// journalFile is the persisted form of a Journal
+type journalFile struct {
+	// PID is the process of the run writing the journal
+	PID     int            `json:"pid"`
+	Entries []JournalEntry `json:"entries"`
+}
+
+// processRunning reports whether a process is still running, so the journal of a running run is left alone
+var processRunning = func(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Journal records every file a run is about to change so the run can be rolled back
+type Journal struct {
+	mu       sync.Mutex
+	entries  []JournalEntry
+	recorded map[string]bool
+	// path is where the journal is persisted, it is only kept in memory when empty
+	path string
+}
+
+// NewJournal creates an empty Journal kept in memory
+func NewJournal() *Journal {
+	return &Journal{recorded: map[string]bool{}}
+}
+
+// OpenJournal creates an empty Journal that is saved to path before every change, so that a run killed
+// halfway can be rolled back by RecoverJournal. It fails when a journal is already there.
+func OpenJournal(path string) (*Journal, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("journal %s of another run exists, remove it once that run has finished", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating journal directory: %v", err)
+	}
+
+	journal := NewJournal()
+	journal.path = path
+	if err := journal.save(); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// RecoverJournal rolls back the changes recorded in the journal left at path by a run that was killed,
+// printing every restored file, and removes the journal. It returns the number of restored files,
+// doing nothing when there is no journal. The journal of a run that is still going is refused.
+func RecoverJournal(path string, out io.Writer) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading journal %s: %v", path, err)
+	}
+
+	var file journalFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return 0, fmt.Errorf("error parsing journal %s: %v", path, err)
+	}
+	if file.PID != os.Getpid() && processRunning(file.PID) {
+		return 0, fmt.Errorf("journal %s belongs to the run of PID %d which is still going", path, file.PID)
+	}
+
+	journal := NewJournal()
+	journal.path = path
+	journal.entries = file.Entries
+	fmt.Fprintf(out, "Rolling back %d backend files of an interrupted run recorded in %s\n", len(file.Entries), path)
+	if err := journal.Rollback(); err != nil {
+		return 0, fmt.Errorf("error rolling back the interrupted run, the journal %s is kept: %v", path, err)
+	}
+	for _, entry := range file.Entries {
+		fmt.Fprintf(out, "Rolled back %s\n", entry.Path)
+	}
+	return len(file.Entries), journal.Close()
+}
+
+// Record saves the current content of path, if any, before it is changed.
+// Recording the same path again keeps the first recorded content.
+func (j *Journal) Record(path string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.recorded[path] {
+		return nil
+	}
+
+	entry := JournalEntry{Path: path}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		entry.Existed = true
+		entry.Mode = info.Mode().Perm()
+		if entry.Previous, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("error reading %s for the journal: %v", path, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("error inspecting %s for the journal: %v", path, err)
+	}
+
+	j.entries = append(j.entries, entry)
+	j.recorded[path] = true
+	if err := j.save(); err != nil {
+		j.entries = j.entries[:len(j.entries)-1]
+		delete(j.recorded, path)
+		return err
+	}
+	return nil
+}
+
+// save persists the entries, the caller holds the lock
+func (j *Journal) save() error {
+	if j.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(journalFile{PID: os.Getpid(), Entries: j.entries})
+	if err != nil {
+		return fmt.Errorf("error encoding journal: %v", err)
+	}
+	// The journal holds previous backend files, which may contain connection strings
+	if err := utils.WriteFileAtomic(j.path, data, 0600); err != nil {
+		return fmt.Errorf("error writing journal: %v", err)
+	}
+	return nil
+}
+
+// Entries returns the recorded entries in the order they were recorded
+func (j *Journal) Entries() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]JournalEntry(nil), j.entries...)
+}
+
+// Rollback restores every recorded file to its previous content, removing files that did not exist.
+// It attempts every entry and returns all failures together.
+func (j *Journal) Rollback() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var errs []error
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		entry := j.entries[i]
+		if entry.Existed {
+			if err := utils.WriteFileAtomic(entry.Path, entry.Previous, entry.Mode); err != nil {
+				errs = append(errs, fmt.Errorf("error restoring %s: %v", entry.Path, err))
+			}
+			continue
+		}
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("error removing %s: %v", entry.Path, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close removes the persisted journal once the run has completed or was rolled back
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.path == "" {
+		return nil
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing journal %s: %v", j.path, err)
+	}
+	return nil
+}
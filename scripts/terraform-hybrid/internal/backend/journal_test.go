@@ -0,0 +1,110 @@
+package backend
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Journal", func() {
+	var (
+		dir     string
+		journal *Journal
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		journal = NewJournal()
+	})
+
+	It("should restore modified files and remove created ones", func() {
+		existing := filepath.Join(dir, "existing.tf")
+		created := filepath.Join(dir, "created.tf")
+		Expect(os.WriteFile(existing, []byte("old"), 0600)).To(Succeed())
+
+		Expect(journal.Record(existing)).To(Succeed())
+		Expect(journal.Record(created)).To(Succeed())
+		Expect(os.WriteFile(existing, []byte("new"), 0644)).To(Succeed())
+		Expect(os.WriteFile(created, []byte("new"), 0644)).To(Succeed())
+
+		// Recording again must not overwrite the original content
+		Expect(journal.Record(existing)).To(Succeed())
+		Expect(journal.Entries()).To(HaveLen(2))
+
+		Expect(journal.Rollback()).To(Succeed())
+
+		content, err := os.ReadFile(existing)
+		Expect(err).To(BeNil())
+		Expect(string(content)).To(Equal("old"))
+		info, err := os.Stat(existing)
+		Expect(err).To(BeNil())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		Expect(created).NotTo(BeAnExistingFile())
+	})
+
+	It("should roll back files that were recorded but never written", func() {
+		Expect(journal.Record(filepath.Join(dir, "missing.tf"))).To(Succeed())
+		Expect(journal.Rollback()).To(Succeed())
+	})
+
+	Describe("persisted", func() {
+		var journalPath string
+
+		BeforeEach(func() {
+			journalPath = filepath.Join(dir, ".terraform-hybrid", "journal.json")
+		})
+
+		It("should roll back a killed run on recovery and remove the journal", func() {
+			existing := filepath.Join(dir, "existing.tf")
+			created := filepath.Join(dir, "created.tf")
+			Expect(os.WriteFile(existing, []byte("old"), 0644)).To(Succeed())
+
+			journal, err := OpenJournal(journalPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(journal.Record(existing)).To(Succeed())
+			Expect(journal.Record(created)).To(Succeed())
+			Expect(os.WriteFile(existing, []byte("new"), 0644)).To(Succeed())
+			Expect(os.WriteFile(created, []byte("new"), 0644)).To(Succeed())
+
+			// The run is killed without closing the journal
+			var out bytes.Buffer
+			restored, err := RecoverJournal(journalPath, &out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(Equal(2))
+			Expect(out.String()).To(ContainSubstring("Rolled back " + existing))
+
+			content, err := os.ReadFile(existing)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("old"))
+			Expect(created).NotTo(BeAnExistingFile())
+			Expect(journalPath).NotTo(BeAnExistingFile())
+		})
+
+		It("should remove the journal of a completed run", func() {
+			journal, err := OpenJournal(journalPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(journal.Record(filepath.Join(dir, "main.tf"))).To(Succeed())
+			Expect(journal.Close()).To(Succeed())
+
+			Expect(journalPath).NotTo(BeAnExistingFile())
+			restored, err := RecoverJournal(journalPath, &bytes.Buffer{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(BeZero())
+		})
+
+		It("should leave the journal of a run that is still going alone", func() {
+			Expect(os.MkdirAll(filepath.Dir(journalPath), 0755)).To(Succeed())
+			Expect(os.WriteFile(journalPath, []byte(`{"pid": 4242, "entries": []}`), 0600)).To(Succeed())
+			DeferCleanup(func(running func(int) bool) { processRunning = running }, processRunning)
+			processRunning = func(pid int) bool { return pid == 4242 }
+
+			_, err := RecoverJournal(journalPath, &bytes.Buffer{})
+			Expect(err).To(MatchError(ContainSubstring("belongs to the run of PID 4242 which is still going")))
+			_, err = OpenJournal(journalPath)
+			Expect(err).To(MatchError(ContainSubstring("of another run exists")))
+		})
+	})
+})
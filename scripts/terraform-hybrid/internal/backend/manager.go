@@ -1,12 +1,19 @@
 package backend
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/audit"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients"
 	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/terraform"
 	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
 )
 
@@ -30,108 +37,301 @@ func NewTerraformBackendManager(
 	}
 }
 
-// GenerateBackends orchestrates the loading of config, finding folders, and generating backend.tf files
-func (tbm *TerraformBackendManager) GenerateBackends(configPath, providerFolderPath string) error {
+// GenerateOptions controls which folders GenerateBackends processes and how
+type GenerateOptions struct {
+	// ProviderFolder is the root of the provider trees, the layout root from the config when empty
+	ProviderFolder string
+	// Filter narrows down the discovered folders
+	Filter utils.FolderFilter
+	// Parallelism is the number of folders processed concurrently
+	Parallelism int
+	// Atomic rolls every touched folder back to its previous backend.tf when any folder fails
+	Atomic bool
+	// JournalPath is where an atomic run saves its journal before every change, so that the next run
+	// rolls back a run that was killed halfway. The journal is only kept in memory when empty.
+	JournalPath string
+	// Binary is the terraform or tofu binary to generate configuration for, overriding the config
+	Binary string
+	// Config is the config already loaded from the config path, which is loaded again when nil
+	Config *config.TerraformHybridConfig
+	// Audit records every written backend, nothing is recorded when nil
+	Audit *audit.Log
+	// CallerHeader names the caller of Audit in the header of every written backend.tf
+	CallerHeader bool
+	// Caller verifies that the active credentials belong to the selected accounts, nothing is verified when nil
+	Caller clients.Caller
+}
+
+// FolderSelection is the outcome of discovering and filtering the root modules of a config
+type FolderSelection struct {
+	Config *config.TerraformHybridConfig
+	Layout *utils.Layout
+	// Namer names the workspaces of the folders
+	Namer *utils.WorkspaceNamer
+	// Workspaces maps the discovered folders to their workspaces and back
+	Workspaces *utils.WorkspaceIndex
+	// ProviderFolder is the folder discovery started from
+	ProviderFolder string
+	// Discovered are the root modules of the configured accounts before filtering
+	Discovered []string
+	// Folders are the selected root modules in path order
+	Folders []string
+}
+
+// SelectFolders loads the config, discovers the root modules matching its layout and narrows them down
+// to the configured accounts and the filter, printing why every folder was included or skipped
+func (tbm *TerraformBackendManager) SelectFolders(
+	ctx context.Context, configPath, providerFolderPath string, filter utils.FolderFilter,
+) (*FolderSelection, error) {
 	// Load the configuration
-	loadedConfig, err := tbm.configLoader.LoadConfig(configPath)
+	loadedConfig, err := tbm.configLoader.LoadConfig(ctx, configPath)
 	if err != nil {
-		return fmt.Errorf("error loading config: %v", err)
+		return nil, fmt.Errorf("error loading config: %v", err)
 	}
+	return tbm.selectFolders(ctx, loadedConfig, configPath, providerFolderPath, filter)
+}
 
-	// Determine provider folder based on config path (e.g., gcp, aws, ali)
-	providerFolder := getProviderFolder(providerFolderPath, configPath)
+// selectFolders is SelectFolders with a config loaded from configPath
+func (tbm *TerraformBackendManager) selectFolders(
+	ctx context.Context, loadedConfig *config.TerraformHybridConfig, configPath, providerFolderPath string, filter utils.FolderFilter,
+) (*FolderSelection, error) {
+	layout, err := loadedConfig.Layout.Build()
+	if err != nil {
+		return nil, err
+	}
 
-	// Find the component folders under the provider folder
-	componentFolders, err := tbm.folderFinder.FindComponentProviderFolders(providerFolder)
+	namer, err := loadedConfig.Workspace.Build(layout)
 	if err != nil {
-		return fmt.Errorf("error finding component provider folders: %v", err)
+		return nil, err
 	}
 
-	if len(loadedConfig.Global.Accounts) == 0 {
-		// Walk through all component folders and their subdirectories
-		for _, componentFolder := range componentFolders {
-			if err := tbm.walkAndProcessComponentFolders(loadedConfig, componentFolder); err != nil {
-				return fmt.Errorf("error processing folder %s: %v", componentFolder, err)
-			}
+	for _, account := range filter.Accounts {
+		if _, ok := loadedConfig.Global.Accounts[account]; len(loadedConfig.Global.Accounts) > 0 && !ok {
+			return nil, fmt.Errorf("account %s is not configured in %s", account, configPath)
 		}
-	} else {
-		// Process only folders that match the account names
-		for _, componentFolder := range componentFolders {
-			if tbm.isFolderForAccount(componentFolder, loadedConfig.Global.Accounts) {
-				if err := tbm.walkAndProcessComponentFolders(loadedConfig, componentFolder); err != nil {
-					return fmt.Errorf("error processing folder %s: %v", componentFolder, err)
-				}
-			}
+	}
+
+	if providerFolderPath == "" {
+		providerFolderPath = layout.Root
+	}
+
+	// Determine provider based on config path (e.g., gcp, aws, ali)
+	provider := ConfigProvider(configPath)
+
+	// Find the root modules matching the layout for the provider
+	decisions, err := tbm.folderFinder.FindComponentProviderFolders(ctx, providerFolderPath, provider, layout)
+	if err != nil {
+		return nil, fmt.Errorf("error finding component provider folders: %v", err)
+	}
+	reportFolderDecisions(decisions)
+	componentFolders := utils.IncludedFolders(decisions)
+
+	if len(loadedConfig.Global.Accounts) > 0 {
+		// Process only folders that map to a configured account
+		componentFolders, err = tbm.selectAccountFolders(loadedConfig, layout, providerFolderPath, componentFolders)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	// Workspace names must identify folders across the whole tree, not only the selected folders
+	workspaces, err := namer.Index(componentFolders)
+	if err != nil {
+		return nil, err
+	}
+
+	selectedFolders, skipped, err := filter.Apply(ctx, layout, providerFolderPath, componentFolders)
+	if err != nil {
+		return nil, fmt.Errorf("error filtering folders: %v", err)
+	}
+	reportFolderDecisions(skipped)
+
+	return &FolderSelection{
+		Config:         loadedConfig,
+		Layout:         layout,
+		Namer:          namer,
+		Workspaces:     workspaces,
+		ProviderFolder: providerFolderPath,
+		Discovered:     componentFolders,
+		Folders:        selectedFolders,
+	}, nil
 }
 
-// walkAndProcessComponentFolders walks the component folder and generates backend.tf in subdirectories
-func (tbm *TerraformBackendManager) walkAndProcessComponentFolders(loadedConfig *config.TerraformHybridConfig, componentFolder string) error {
-	// Use WalkDir to traverse all directories under the component folder
-	err := filepath.WalkDir(componentFolder, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
+// GenerateBackends orchestrates the loading of config, finding folders, and generating backend.tf files.
+// Every folder is processed even when others fail, and all failures are returned together.
+// Cancelling ctx stops the run before the next folder, leaving each folder fully written or untouched.
+// With opts.Atomic a failed or cancelled run is rolled back as a whole, and with opts.JournalPath also
+// a killed run, when the next run starts.
+func (tbm *TerraformBackendManager) GenerateBackends(ctx context.Context, configPath string, opts GenerateOptions) error {
+	if opts.JournalPath != "" {
+		if _, err := RecoverJournal(opts.JournalPath, os.Stdout); err != nil {
 			return err
 		}
+	}
 
-		// Skip if it's not a directory
-		if !d.IsDir() {
-			return nil
-		}
+	var selection *FolderSelection
+	var err error
+	if opts.Config != nil {
+		selection, err = tbm.selectFolders(ctx, opts.Config, configPath, opts.ProviderFolder, opts.Filter)
+	} else {
+		selection, err = tbm.SelectFolders(ctx, configPath, opts.ProviderFolder, opts.Filter)
+	}
+	if err != nil {
+		return err
+	}
+	loadedConfig := selection.Config
 
-		// Skip the component folder itself
-		if filepath.Base(componentFolder) == filepath.Base(path) {
-			return nil
+	if opts.Caller != nil {
+		if err := VerifyAccounts(selection, opts.Caller, os.Stdout); err != nil {
+			return err
 		}
+	}
 
-		// Skip the .terraform directory
-		if d.Name() == ".terraform" || d.Name() == "terraform.tfstate.d" {
-			return filepath.SkipDir
-		}
+	tool, err := terraform.ResolveTool(ctx, opts.Binary, loadedConfig.Tool.Binary, loadedConfig.Tool.Version)
+	if err != nil {
+		return fmt.Errorf("error resolving tool: %v", err)
+	}
+	if tool.Version == nil {
+		fmt.Printf("Warning: could not determine the version of %s, features that need a known version (state encryption, use_lockfile) are refused unless tool.version is set\n", tool.Binary)
+	}
+	fmt.Printf("Generating backends for %s\n", tool)
 
-		// Process the subfolder to generate backend.tf
-		fmt.Printf("Processing subfolder: %s\n", path)
-		if err := tbm.processFolder(loadedConfig, path); err != nil {
-			return fmt.Errorf("error processing folder %s: %v", path, err)
+	journal := NewJournal()
+	if opts.Atomic && opts.JournalPath != "" {
+		if journal, err = OpenJournal(opts.JournalPath); err != nil {
+			return err
 		}
-
-		return nil
+	}
+	err = utils.ProcessFolders(ctx, selection.Folders, opts.Parallelism, os.Stdout, func(ctx context.Context, folder string, out io.Writer) error {
+		fmt.Fprintf(out, "Processing subfolder: %s\n", folder)
+		return tbm.processFolder(ctx, loadedConfig, tool, folder, journal, opts, out)
 	})
+	if err == nil || !opts.Atomic {
+		return errors.Join(err, journal.Close())
+	}
+
+	return rollback(journal, err)
+}
+
+// rollback restores every file recorded in the journal after a failed run
+func rollback(journal *Journal, runErr error) error {
+	entries := journal.Entries()
+	fmt.Printf("Rolling back %d backend files\n", len(entries))
+
+	if err := journal.Rollback(); err != nil {
+		// The journal is kept so that the next run retries the rollback
+		return fmt.Errorf("%w\nrollback failed, some folders may be left modified: %v", runErr, err)
+	}
 
-	return err
+	for _, entry := range entries {
+		fmt.Printf("Rolled back %s\n", entry.Path)
+	}
+	return errors.Join(fmt.Errorf("%w\nrolled back all %d changed backend files", runErr, len(entries)), journal.Close())
 }
 
-// Helper to get the provider folder based on config file name
-func getProviderFolder(basePath, configPath string) string {
+// reportFolderDecisions prints why each discovered folder was included or skipped
+func reportFolderDecisions(decisions []utils.FolderDecision) {
+	for _, decision := range decisions {
+		if decision.Included {
+			fmt.Printf("Including folder %s: %s\n", decision.Path, decision.Reason)
+		} else {
+			fmt.Printf("Skipping folder %s: %s\n", decision.Path, decision.Reason)
+		}
+	}
+}
+
+// ConfigProvider returns the provider name of a config file based on its name, e.g. aws for aws.yaml
+func ConfigProvider(configPath string) string {
 	configFile := filepath.Base(configPath)
-	provider := strings.TrimSuffix(configFile, filepath.Ext(configFile))
-	return filepath.Join(basePath, provider)
+	return strings.TrimSuffix(configFile, filepath.Ext(configFile))
 }
 
-// Helper to check if folder matches account from config
-func (tbm *TerraformBackendManager) isFolderForAccount(folder string, accounts map[string]string) bool {
+// selectAccountFolders keeps the folders whose account segment exactly matches a configured account.
+// It warns about folders that map to no configured account and about accounts without any folder.
+func (tbm *TerraformBackendManager) selectAccountFolders(
+	loadedConfig *config.TerraformHybridConfig, layout *utils.Layout, basePath string, folders []string,
+) ([]string, error) {
+	if !layout.HasPlaceholder("account") {
+		return nil, fmt.Errorf("layout path template %s has no {account} placeholder to match accounts against", layout.Template)
+	}
+
+	accounts := loadedConfig.Global.Accounts
+	matchedAccounts := map[string]bool{}
+	var selected []string
+
+	for _, folder := range folders {
+		account, ok := accountForFolder(layout, basePath, folder)
+		if !ok {
+			fmt.Printf("Warning: folder %s does not match layout %s, skipping\n", folder, layout.Template)
+			continue
+		}
+		if _, configured := accounts[account]; !configured {
+			fmt.Printf("Warning: folder %s belongs to account %s which is not configured, skipping\n", folder, account)
+			continue
+		}
+
+		matchedAccounts[account] = true
+		selected = append(selected, folder)
+	}
+
+	var missing []string
 	for account := range accounts {
-		if strings.Contains(folder, account) {
-			return true
+		if !matchedAccounts[account] {
+			missing = append(missing, account)
 		}
 	}
-	return false
+	sort.Strings(missing)
+	for _, account := range missing {
+		fmt.Printf("Warning: configured account %s has no folder matching layout %s\n", account, layout.Template)
+	}
+
+	return selected, nil
+}
+
+// accountForFolder extracts the {account} segment of a folder relative to the base path
+func accountForFolder(layout *utils.Layout, basePath, folder string) (string, bool) {
+	relativePath, err := filepath.Rel(basePath, folder)
+	if err != nil {
+		return "", false
+	}
+
+	values, ok := layout.Match(relativePath)
+	if !ok {
+		return "", false
+	}
+
+	account, ok := values["account"]
+	return account, ok
 }
 
 // processFolder handles backend.tf generation for a specific folder
-func (tbm *TerraformBackendManager) processFolder(loadedConfig *config.TerraformHybridConfig, folder string) error {
-	writer, err := tbm.backendFactory.CreateBackendWriter(loadedConfig.Global.BackendType)
+func (tbm *TerraformBackendManager) processFolder(
+	ctx context.Context, loadedConfig *config.TerraformHybridConfig, tool *terraform.Tool, folder string,
+	journal *Journal, opts GenerateOptions, out io.Writer,
+) error {
+	writer, err := tbm.backendFactory.CreateBackendWriter(loadedConfig.Global.BackendType, tool)
 	if err != nil {
 		return fmt.Errorf("error creating backend writer: %v", err)
 	}
 
+	// Record the current backend.tf so the run can be rolled back
+	if err := journal.Record(filepath.Join(folder, BackendFileName)); err != nil {
+		return err
+	}
+
 	// Write the backend configuration for the folder
-	if err := writer.WriteBackend(loadedConfig, folder, "main"); err != nil {
+	callerName := ""
+	if opts.CallerHeader {
+		callerName = opts.Audit.Who()
+	}
+	if err := writer.WriteBackend(ctx, loadedConfig, folder, callerName); err != nil {
 		return fmt.Errorf("error writing backend for folder %s: %v", folder, err)
 	}
+	// The backend is written, failing the folder now would roll back a correct change
+	if err := opts.Audit.Record("generate-backend", folder, loadedConfig.Global.BackendType.String()); err != nil {
+		fmt.Fprintf(out, "Warning: %v\n", err)
+	}
 
-	fmt.Printf("Successfully wrote backend for folder: %s\n", folder)
+	fmt.Fprintf(out, "Successfully wrote backend for folder: %s\n", folder)
 	return nil
 }
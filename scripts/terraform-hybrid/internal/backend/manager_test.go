@@ -0,0 +1,318 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/audit"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/clientstest"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeConfigLoader returns a fixed configuration
+type fakeConfigLoader struct {
+	config *config.TerraformHybridConfig
+	loads  int
+}
+
+func (f *fakeConfigLoader) LoadConfig(context.Context, string) (*config.TerraformHybridConfig, error) {
+	f.loads++
+	return f.config, nil
+}
+
+var _ = Describe("TerraformBackendManager", func() {
+	var (
+		providerRoot string
+		hybridConfig *config.TerraformHybridConfig
+		manager      *TerraformBackendManager
+	)
+
+	// mkdir creates a root module folder containing Terraform configuration
+	mkdir := func(relativePath string) string {
+		dir := filepath.Join(providerRoot, relativePath)
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`resource "null_resource" "this" {}`), 0644)).To(Succeed())
+		return dir
+	}
+
+	BeforeEach(func() {
+		providerRoot = filepath.Join(GinkgoT().TempDir(), "deploy", "provider")
+		hybridConfig = &config.TerraformHybridConfig{
+			Global: config.GlobalConfig{
+				BackendType: config.LocalBackendType,
+				Backend:     &config.LocalBackendConfig{Path: LocalBackendPath},
+			},
+		}
+		manager = NewTerraformBackendManager(&fakeConfigLoader{config: hybridConfig}, utils.NewFolderFinder(), *NewBackendFactory())
+	})
+
+	Context("when accounts are configured", func() {
+		It("should only process folders whose account segment matches exactly", func() {
+			hybridConfig.Global.Accounts = map[string]config.AccountConfig{"aws_test_1": {ID: "1"}, "aws_test_3": {ID: "3"}}
+			matching := mkdir("aws/accounts/aws_test_1/component/file1")
+			similar := mkdir("aws/accounts/aws_test_10/component/file1")
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot})).To(Succeed())
+
+			Expect(filepath.Join(matching, "backend.tf")).To(BeAnExistingFile())
+			Expect(filepath.Join(similar, "backend.tf")).NotTo(BeAnExistingFile())
+		})
+
+		It("should ignore account names that appear elsewhere in the path", func() {
+			hybridConfig.Global.Accounts = map[string]config.AccountConfig{"aws": {ID: "1"}}
+			folder := mkdir("aws/accounts/aws_test_1/component/file1")
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot})).To(Succeed())
+
+			Expect(filepath.Join(folder, "backend.tf")).NotTo(BeAnExistingFile())
+		})
+
+		It("should only process the accounts selected by the filter", func() {
+			hybridConfig.Global.Accounts = map[string]config.AccountConfig{"aws_test_1": {ID: "1"}, "aws_test_2": {ID: "2"}}
+			selected := mkdir("aws/accounts/aws_test_1/component/file1")
+			other := mkdir("aws/accounts/aws_test_2/component/file1")
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{
+				ProviderFolder: providerRoot,
+				Filter:         utils.FolderFilter{Accounts: []string{"aws_test_1"}},
+			})).To(Succeed())
+
+			Expect(filepath.Join(selected, "backend.tf")).To(BeAnExistingFile())
+			Expect(filepath.Join(other, "backend.tf")).NotTo(BeAnExistingFile())
+		})
+
+		It("should fail when the filter selects an account that is not configured", func() {
+			hybridConfig.Global.Accounts = map[string]config.AccountConfig{"aws_test_1": {ID: "1"}}
+
+			err := manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{
+				ProviderFolder: providerRoot,
+				Filter:         utils.FolderFilter{Accounts: []string{"aws_test_9"}},
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("account aws_test_9 is not configured"))
+		})
+
+		It("should fail when the layout has no account placeholder", func() {
+			hybridConfig.Global.Accounts = map[string]config.AccountConfig{"aws_test_1": {ID: "1"}}
+			hybridConfig.Layout.PathTemplate = "{provider}/**/component/**"
+			mkdir("aws/accounts/aws_test_1/component/file1")
+
+			err := manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("no {account} placeholder"))
+		})
+	})
+
+	Context("when verifying accounts", func() {
+		var folder string
+
+		BeforeEach(func() {
+			hybridConfig.Global.Accounts = map[string]config.AccountConfig{"aws_test_1": {ID: "111111111111"}, "aws_test_2": {ID: "222222222222"}}
+			folder = mkdir("aws/accounts/aws_test_1/component/file1")
+		})
+
+		It("should process the folders of the active account", func() {
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{
+				ProviderFolder: providerRoot,
+				Caller:         &clientstest.FakeCaller{Account: "111111111111"},
+			})).To(Succeed())
+
+			Expect(filepath.Join(folder, "backend.tf")).To(BeAnExistingFile())
+		})
+
+		It("should refuse to write any folder when the active account differs", func() {
+			err := manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{
+				ProviderFolder: providerRoot,
+				Caller:         &clientstest.FakeCaller{Account: "222222222222"},
+			})
+			Expect(err).To(MatchError("refusing to continue, the active credentials act in account 222222222222 but account aws_test_1 is configured as 111111111111"))
+
+			Expect(filepath.Join(folder, "backend.tf")).NotTo(BeAnExistingFile())
+		})
+
+		It("should refuse when the active account cannot be determined", func() {
+			err := manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{
+				ProviderFolder: providerRoot,
+				Caller:         &clientstest.FakeCaller{Err: errors.New("no credentials")},
+			})
+			Expect(err).To(MatchError(ContainSubstring("error verifying the active account, use --no-verify-accounts to skip the check: no credentials")))
+		})
+
+		It("should leave accounts with a role to the role assumption", func() {
+			hybridConfig.Global.Accounts["aws_test_1"] = config.AccountConfig{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/terraform"}
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{
+				ProviderFolder: providerRoot,
+				Caller:         &clientstest.FakeCaller{Err: errors.New("no credentials")},
+			})).To(Succeed())
+		})
+
+		It("should not ask for the account when no accounts are configured", func() {
+			hybridConfig.Global.Accounts = nil
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{
+				ProviderFolder: providerRoot,
+				Caller:         &clientstest.FakeCaller{Err: errors.New("no credentials")},
+			})).To(Succeed())
+		})
+	})
+
+	Context("when no accounts are configured", func() {
+		It("should process every component folder", func() {
+			folder := mkdir("aws/accounts/aws_test_10/component/file1")
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot})).To(Succeed())
+
+			Expect(filepath.Join(folder, "backend.tf")).To(BeAnExistingFile())
+		})
+	})
+
+	Context("with an audit log", func() {
+		It("should record every written backend without naming the caller in the file", func() {
+			folder := mkdir("aws/accounts/aws_test_10/component/file1")
+			auditLog := audit.NewLog(filepath.Join(GinkgoT().TempDir(), "audit.log"), "alice")
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot, Audit: auditLog})).To(Succeed())
+
+			content, err := os.ReadFile(filepath.Join(folder, "backend.tf"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(HavePrefix("terraform {\n"))
+			events, err := os.ReadFile(auditLog.Path())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(events)).To(ContainSubstring(`"who":"alice","operation":"generate-backend","folder":"` + folder + `","detail":"local"`))
+		})
+
+		It("should name the caller in the header when asked to", func() {
+			folder := mkdir("aws/accounts/aws_test_10/component/file1")
+			auditLog := audit.NewLog(filepath.Join(GinkgoT().TempDir(), "audit.log"), "alice")
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{
+				ProviderFolder: providerRoot, Audit: auditLog, CallerHeader: true,
+			})).To(Succeed())
+
+			content, err := os.ReadFile(filepath.Join(folder, "backend.tf"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(HavePrefix("# Generated by terraform-hybrid, last written by alice\n"))
+		})
+
+		It("should keep the written backends when the audit log cannot be written", func() {
+			folder := mkdir("aws/accounts/aws_test_10/component/file1")
+			// A directory in place of the log file makes every record fail
+			logPath := filepath.Join(GinkgoT().TempDir(), "audit.log")
+			Expect(os.MkdirAll(logPath, 0755)).To(Succeed())
+			auditLog := audit.NewLog(logPath, "alice")
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{
+				ProviderFolder: providerRoot, Audit: auditLog, Atomic: true,
+			})).To(Succeed())
+			Expect(filepath.Join(folder, "backend.tf")).To(BeAnExistingFile())
+		})
+	})
+
+	It("should not load the config again when it is given", func() {
+		mkdir("aws/accounts/aws_test_10/component/file1")
+		loader := &fakeConfigLoader{config: hybridConfig}
+		manager = NewTerraformBackendManager(loader, utils.NewFolderFinder(), *NewBackendFactory())
+
+		Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot, Config: hybridConfig})).To(Succeed())
+		Expect(loader.loads).To(BeZero())
+	})
+
+	Context("when workspace names collide", func() {
+		It("should fail before writing any folder", func() {
+			first := mkdir("aws/accounts/prod/component/app_api/eu")
+			second := mkdir("aws/accounts/prod/component/app/api_eu")
+
+			err := manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot})
+			Expect(err).To(MatchError(ContainSubstring("workspace aws_accounts_prod_component_app_api_eu is used by both")))
+			Expect(filepath.Join(first, "backend.tf")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(second, "backend.tf")).NotTo(BeAnExistingFile())
+		})
+
+		It("should succeed with the hash strategy", func() {
+			hybridConfig.Workspace = config.WorkspaceConfig{Strategy: "hash"}
+			mkdir("aws/accounts/prod/component/app_api/eu")
+			mkdir("aws/accounts/prod/component/app/api_eu")
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot})).To(Succeed())
+		})
+	})
+
+	Context("when a custom layout is configured", func() {
+		It("should discover folders using the layout template and ignore globs", func() {
+			hybridConfig.Layout = config.LayoutConfig{
+				PathTemplate: "{provider}/envs/{account}/{component}/{stack}",
+				Ignore:       []string{"**/templates"},
+			}
+			hybridConfig.Global.Accounts = map[string]config.AccountConfig{"prod": {ID: "1"}}
+			stack := mkdir("aws/envs/prod/network/vpc")
+			ignored := mkdir("aws/envs/prod/network/templates")
+			shallow := mkdir("aws/envs/prod/network")
+			otherProvider := mkdir("gcp/envs/prod/network/vpc")
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot})).To(Succeed())
+
+			Expect(filepath.Join(stack, "backend.tf")).To(BeAnExistingFile())
+			Expect(filepath.Join(ignored, "backend.tf")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(shallow, "backend.tf")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(otherProvider, "backend.tf")).NotTo(BeAnExistingFile())
+
+			content, err := os.ReadFile(filepath.Join(stack, "backend.tf"))
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(ContainSubstring(LocalBackendPath + "/aws/envs/prod/network/vpc/terraform.tfstate"))
+		})
+
+		It("should compute keys relative to a custom root", func() {
+			providerRoot = filepath.Join(GinkgoT().TempDir(), "live")
+			hybridConfig.Layout = config.LayoutConfig{Root: "live", PathTemplate: "{provider}/{stack}"}
+			stack := mkdir("aws/vpc")
+
+			Expect(manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot})).To(Succeed())
+
+			content, err := os.ReadFile(filepath.Join(stack, "backend.tf"))
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(ContainSubstring(LocalBackendPath + "/aws/vpc/terraform.tfstate"))
+		})
+	})
+
+	Context("when a folder fails", func() {
+		var written, broken, previous string
+
+		BeforeEach(func() {
+			written = mkdir("aws/accounts/aws_test_1/component/file1")
+			previous = mkdir("aws/accounts/aws_test_1/component/file2")
+			broken = mkdir("aws/accounts/aws_test_1/component/file3")
+			Expect(os.WriteFile(filepath.Join(previous, BackendFileName), []byte("# previous backend"), 0644)).To(Succeed())
+			// A directory in place of backend.tf cannot be replaced
+			Expect(os.Mkdir(filepath.Join(broken, BackendFileName), 0755)).To(Succeed())
+		})
+
+		It("should roll every touched folder back in atomic mode", func() {
+			err := manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot, Atomic: true})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("1 of 3 folders failed"))
+			Expect(err.Error()).To(ContainSubstring("rolled back"))
+
+			Expect(filepath.Join(written, BackendFileName)).NotTo(BeAnExistingFile())
+			content, err := os.ReadFile(filepath.Join(previous, BackendFileName))
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(Equal("# previous backend"))
+		})
+
+		It("should keep the successful folders otherwise", func() {
+			err := manager.GenerateBackends(context.Background(), "aws.yaml", GenerateOptions{ProviderFolder: providerRoot})
+			Expect(err).To(HaveOccurred())
+
+			Expect(filepath.Join(written, BackendFileName)).To(BeAnExistingFile())
+			content, err := os.ReadFile(filepath.Join(previous, BackendFileName))
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(ContainSubstring(`backend "local"`))
+		})
+	})
+})
@@ -1,100 +1,159 @@
 package backend
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/terraform"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
 )
 
+// BackendFileName is the name of the generated backend configuration file
+const BackendFileName = "backend.tf"
+
 // Writer defines an interface for writing backend configuration
 type Writer interface {
-	WriteBackend(terraformConfig *config.TerraformHybridConfig, workspaceDir, callerName string) error
+	WriteBackend(ctx context.Context, terraformConfig *config.TerraformHybridConfig, workspaceDir, callerName string) error
 }
 
 // TerraformBackendWriter implements Writer for different backends
-type TerraformBackendWriter struct{}
+type TerraformBackendWriter struct {
+	// Tool is the terraform or OpenTofu binary the configuration is generated for.
+	// A nil Tool targets Terraform of an unknown version.
+	Tool *terraform.Tool
+}
+
+// WriteBackend writes the backend configuration to the specified file, naming callerName in its header when set.
+// The file is replaced atomically, so it is either fully written or left untouched.
+func (tbw *TerraformBackendWriter) WriteBackend(
+	ctx context.Context, terraformConfig *config.TerraformHybridConfig, workspaceDir, callerName string,
+) error {
+	layout, err := terraformConfig.Layout.Build()
+	if err != nil {
+		return err
+	}
 
-// WriteBackend writes the backend configuration to the specified file
-func (tbw *TerraformBackendWriter) WriteBackend(terraformConfig *config.TerraformHybridConfig, workspaceDir, callerName string) error {
-	// Get the relative path under "deploy/provider"
-	relativePath, err := tbw.getRelativePathUnderProvider(workspaceDir)
+	// Get the relative path under the layout root (e.g. "deploy/provider")
+	relativePath, err := tbw.getRelativePathUnderProvider(layout, workspaceDir)
 	if err != nil {
 		return fmt.Errorf("error determining relative path: %v", err)
 	}
 
-	backendFile := filepath.Join(workspaceDir, "backend.tf")
+	backendFile := filepath.Join(workspaceDir, BackendFileName)
 
-	content, err := tbw.generateBackendContent(terraformConfig.Global.Backend, terraformConfig.Global.BackendType, relativePath)
+	// Postgres keeps the state of every folder in one schema, separated by workspace
+	var workspace string
+	if terraformConfig.Global.BackendType == config.BackendTypePostgres {
+		if workspace, err = tbw.postgresWorkspace(terraformConfig, layout, workspaceDir); err != nil {
+			return err
+		}
+	}
+
+	content, err := tbw.generateBackendContent(terraformConfig, relativePath, workspace)
 	if err != nil {
 		return fmt.Errorf("error generating backend content: %v", err)
 	}
+	if callerName != "" {
+		content = fmt.Sprintf("# Generated by terraform-hybrid, last written by %s\n", callerName) + content
+	}
 
-	if err := os.WriteFile(backendFile, []byte(content), 0644); err != nil {
+	// Do not start writing once the run has been cancelled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := utils.WriteFileAtomic(backendFile, []byte(content), 0644); err != nil {
 		return fmt.Errorf("error writing backend file %s: %v", backendFile, err)
 	}
 
-	fmt.Printf("Successfully wrote backend configuration to %s\n", backendFile)
 	return nil
 }
 
-// getRelativePathUnderProvider calculates the relative path under "deploy/provider"
-func (tbw *TerraformBackendWriter) getRelativePathUnderProvider(workspaceDir string) (string, error) {
-	// Look for the "deploy/provider" folder in the absolute workspace path
-	providerRoot := filepath.Join("deploy", "provider")
-	absWorkspaceDir, err := filepath.Abs(workspaceDir)
+// getRelativePathUnderProvider calculates the relative path under the layout root
+func (tbw *TerraformBackendWriter) getRelativePathUnderProvider(layout *utils.Layout, workspaceDir string) (string, error) {
+	return layout.RelativePath(workspaceDir)
+}
+
+// postgresWorkspace names the workspace holding the state of a folder in the Postgres schema
+func (tbw *TerraformBackendWriter) postgresWorkspace(
+	terraformConfig *config.TerraformHybridConfig, layout *utils.Layout, workspaceDir string,
+) (string, error) {
+	namer, err := terraformConfig.Workspace.Build(layout)
+	if err != nil {
+		return "", err
+	}
+	if namer.Strategy == utils.WorkspaceStrategyDefault {
+		return "", fmt.Errorf("the pg backend separates folders by workspace, use a workspace strategy other than %s", namer.Strategy)
+	}
+	return namer.Name(workspaceDir)
+}
+
+// generateBackendContent generates the terraform block with the backend and, for OpenTofu, the encryption configuration
+func (tbw *TerraformBackendWriter) generateBackendContent(
+	terraformConfig *config.TerraformHybridConfig, relativePath, workspace string,
+) (string, error) {
+	backendBlock, err := tbw.generateBackendBlock(terraformConfig.Global.Backend, terraformConfig.Global.BackendType, relativePath, workspace)
 	if err != nil {
-		return "", fmt.Errorf("could not determine absolute path: %v", err)
+		return "", err
 	}
 
-	// Find the index of "deploy/provider" in the absolute path
-	index := strings.Index(absWorkspaceDir, providerRoot)
-	if index == -1 {
-		return "", fmt.Errorf("workspace directory does not seem to be under 'deploy/provider'")
+	encryptionBlock, err := tbw.generateEncryptionBlock(terraformConfig.Tool.Encryption)
+	if err != nil {
+		return "", err
 	}
 
-	// Return the relative path under "deploy/provider"
-	return absWorkspaceDir[index+len(providerRoot)+1:], nil
+	return fmt.Sprintf("terraform {\n%s%s}", backendBlock, encryptionBlock), nil
 }
 
-// generateBackendContent generates the backend configuration content based on the backend type
-func (tbw *TerraformBackendWriter) generateBackendContent(backend interface{}, backendType config.BackendType, relativePath string) (string, error) {
+// generateBackendBlock generates the backend block based on the backend type
+func (tbw *TerraformBackendWriter) generateBackendBlock(
+	backend interface{}, backendType config.BackendType, relativePath, workspace string,
+) (string, error) {
 	switch backendType {
 	case config.LocalBackendType:
 		return tbw.generateLocalBackendContent(backend.(*config.LocalBackendConfig), relativePath)
 	case config.BackendTypeCloudStorage:
 		return tbw.generateCloudStorageBackendContent(backend.(*config.CloudStorageBackendConfig), relativePath)
 	case config.BackendTypePostgres:
-		return tbw.generatePostgresBackendContent(backend.(*config.PostgresBackendConfig))
+		return tbw.generatePostgresBackendContent(backend.(*config.PostgresBackendConfig), workspace)
 	default:
 		return "", fmt.Errorf("unsupported backend type: %s", backendType)
 	}
 }
 
+// localStatePath returns the state file of a folder for the local backend
+func localStatePath(backend *config.LocalBackendConfig, relativePath string) string {
+	return fmt.Sprintf("%s/%s/terraform.tfstate", backend.Path, relativePath)
+}
+
+// cloudStorageStateKey returns the object key of a folder's state in the bucket
+func cloudStorageStateKey(relativePath string) string {
+	return fmt.Sprintf("%s/terraform.tfstate", relativePath)
+}
+
 // Local Backend
 func (tbw *TerraformBackendWriter) generateLocalBackendContent(backend *config.LocalBackendConfig, relativePath string) (string, error) {
 	// Use the relative path instead of subfolder name
-	backendPath := fmt.Sprintf("%s/%s/terraform.tfstate", backend.Path, relativePath)
-	return fmt.Sprintf(`terraform {
-  backend "local" {
+	backendPath := localStatePath(backend, relativePath)
+	return fmt.Sprintf(`  backend "local" {
     path = "%s"
   }
-}`, backendPath), nil
+`, backendPath), nil
 }
 
 // Cloud Storage Backend
 func (tbw *TerraformBackendWriter) generateCloudStorageBackendContent(backend *config.CloudStorageBackendConfig, relativePath string) (string, error) {
-	bucketKey := fmt.Sprintf("%s/terraform.tfstate", relativePath)
-	content := fmt.Sprintf(`terraform {
-  backend "%s" {
+	bucketKey := cloudStorageStateKey(relativePath)
+	content := fmt.Sprintf(`  backend "%s" {
     encrypt = "true"
     region  = "%s"
     bucket  = "%s"
-    key     = "%s"
-  }
-}`, backend.Type, backend.Region, backend.BucketName, bucketKey)
+    key     = "%s"`, backend.Type, backend.Region, backend.BucketName, bucketKey)
 
 	// Handle optional fields
 	if backend.Endpoint != "" {
@@ -110,16 +169,89 @@ func (tbw *TerraformBackendWriter) generateCloudStorageBackendContent(backend *c
     role_arn  = "%s"`, backend.RoleArn)
 	}
 
-	content += "\n}"
+	if backend.UseLockfile {
+		if backend.Type != "s3" {
+			return "", fmt.Errorf("use_lockfile is only supported by the s3 backend, not %s", backend.Type)
+		}
+		if !tbw.Tool.SupportsS3Lockfile() {
+			return "", tbw.unsupported("use_lockfile requires OpenTofu 1.8+ or Terraform 1.10+")
+		}
+		content += `
+    use_lockfile = true`
+	}
+
+	content += "\n  }\n"
 	return content, nil
 }
 
 // Postgres Backend
-func (tbw *TerraformBackendWriter) generatePostgresBackendContent(backend *config.PostgresBackendConfig) (string, error) {
-	return fmt.Sprintf(`terraform {
+func (tbw *TerraformBackendWriter) generatePostgresBackendContent(backend *config.PostgresBackendConfig, workspace string) (string, error) {
+	return fmt.Sprintf(`  # State is stored in workspace "%s"
   backend "pg" {
     conn_str     = "%s"
     schema_name  = "%s"
   }
-}`, backend.ConnectionString, backend.SchemaName), nil
+`, workspace, backend.ConnectionString, backend.SchemaName), nil
+}
+
+// generateEncryptionBlock generates the OpenTofu encryption block for state and plan files
+func (tbw *TerraformBackendWriter) generateEncryptionBlock(encryption *config.EncryptionConfig) (string, error) {
+	if encryption == nil {
+		return "", nil
+	}
+	if !tbw.Tool.SupportsStateEncryption() {
+		return "", tbw.unsupported("state encryption requires OpenTofu 1.7+")
+	}
+
+	method := encryption.Method
+	if method == "" {
+		method = "aes_gcm"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n  encryption {\n")
+	fmt.Fprintf(&sb, "    key_provider \"%s\" \"main\" {\n", encryption.KeyProvider)
+	sb.WriteString(formatAttributes(encryption.Options, "      "))
+	sb.WriteString("    }\n\n")
+	fmt.Fprintf(&sb, "    method \"%s\" \"main\" {\n", method)
+	fmt.Fprintf(&sb, "      keys = key_provider.%s.main\n", encryption.KeyProvider)
+	sb.WriteString("    }\n")
+	for _, target := range []string{"state", "plan"} {
+		fmt.Fprintf(&sb, "\n    %s {\n", target)
+		fmt.Fprintf(&sb, "      method   = method.%s.main\n", method)
+		fmt.Fprintf(&sb, "      enforced = %t\n", encryption.Enforced)
+		sb.WriteString("    }\n")
+	}
+	sb.WriteString("  }\n")
+	return sb.String(), nil
+}
+
+// formatAttributes formats HCL attributes with aligned equals signs in a stable order.
+// Values referencing variables or locals are written unquoted.
+func formatAttributes(attributes map[string]string, indent string) string {
+	names := make([]string, 0, len(attributes))
+	width := 0
+	for name := range attributes {
+		names = append(names, name)
+		width = max(width, len(name))
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		value := attributes[name]
+		if !strings.HasPrefix(value, "var.") && !strings.HasPrefix(value, "local.") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&sb, "%s%-*s = %s\n", indent, width, name, value)
+	}
+	return sb.String()
+}
+
+// unsupported reports a feature the target tool lacks, hinting at tool.version when the version is unknown
+func (tbw *TerraformBackendWriter) unsupported(feature string) error {
+	if !tbw.Tool.HasVersion() {
+		return fmt.Errorf("%s, but the version of %s is unknown: install it or set tool.version in the config", feature, tbw.Tool)
+	}
+	return fmt.Errorf("%s, found %s", feature, tbw.Tool)
 }
@@ -0,0 +1,157 @@
+package ali
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stsEndpoint is the Alibaba Cloud STS API
+const stsEndpoint = "https://sts.aliyuncs.com/"
+
+// RealAliCaller returns the caller from STS GetCallerIdentity
+type RealAliCaller struct {
+	AccessKeyID     string
+	AccessKeySecret string
+	// SecurityToken is set for temporary credentials
+	SecurityToken string
+	Endpoint      string
+	Client        *http.Client
+	// now returns the signing time
+	now func() time.Time
+}
+
+// NewAliCaller creates a RealAliCaller from the ALIBABA_CLOUD_* environment variables
+func NewAliCaller() *RealAliCaller {
+	return &RealAliCaller{
+		AccessKeyID:     os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_ID"),
+		AccessKeySecret: os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET"),
+		SecurityToken:   os.Getenv("ALIBABA_CLOUD_SECURITY_TOKEN"),
+		Endpoint:        stsEndpoint,
+		Client:          &http.Client{Timeout: 10 * time.Second},
+		now:             time.Now,
+	}
+}
+
+// callerIdentity is the response of GetCallerIdentity
+type callerIdentity struct {
+	Arn       string `json:"Arn"`
+	AccountID string `json:"AccountId"`
+	Code      string `json:"Code"`
+	Message   string `json:"Message"`
+}
+
+// GetCallerName returns the name of the Alibaba Cloud caller, the last segment of its ARN
+func (c *RealAliCaller) GetCallerName() (string, error) {
+	result, err := c.identity()
+	if err != nil {
+		return "", err
+	}
+	arnParts := strings.Split(result.Arn, "/")
+	return arnParts[len(arnParts)-1], nil
+}
+
+// GetAccountID returns the account the credentials act in
+func (c *RealAliCaller) GetAccountID() (string, error) {
+	result, err := c.identity()
+	if err != nil {
+		return "", err
+	}
+	return result.AccountID, nil
+}
+
+// identity calls STS GetCallerIdentity
+func (c *RealAliCaller) identity() (*callerIdentity, error) {
+	if c.AccessKeyID == "" || c.AccessKeySecret == "" {
+		return nil, fmt.Errorf("error getting Alibaba Cloud caller identity: ALIBABA_CLOUD_ACCESS_KEY_ID and ALIBABA_CLOUD_ACCESS_KEY_SECRET are not set")
+	}
+
+	query, err := c.signedQuery()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Client.Get(c.Endpoint + "?" + query)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Alibaba Cloud caller identity: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Alibaba Cloud caller identity: %v", err)
+	}
+
+	var result callerIdentity
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("error parsing Alibaba Cloud caller identity: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error getting Alibaba Cloud caller identity: %s: %s", result.Code, result.Message)
+	}
+	return &result, nil
+}
+
+// signedQuery builds the GetCallerIdentity query signed with signature version 1.0 of the RPC API
+func (c *RealAliCaller) signedQuery() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error signing Alibaba Cloud request: %v", err)
+	}
+
+	params := map[string]string{
+		"Action":           "GetCallerIdentity",
+		"Format":           "JSON",
+		"Version":          "2015-04-01",
+		"AccessKeyId":      c.AccessKeyID,
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureVersion": "1.0",
+		"SignatureNonce":   hex.EncodeToString(nonce),
+		"Timestamp":        c.now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if c.SecurityToken != "" {
+		params["SecurityToken"] = c.SecurityToken
+	}
+
+	query := canonicalQuery(params)
+	return query + "&Signature=" + percentEncode(sign(c.AccessKeySecret, query)), nil
+}
+
+// canonicalQuery joins the percent-encoded parameters in key order
+func canonicalQuery(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, percentEncode(key)+"="+percentEncode(params[key]))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sign returns the HMAC-SHA1 signature of a GET request with the canonical query
+func sign(secret, query string) string {
+	stringToSign := "GET&" + percentEncode("/") + "&" + percentEncode(query)
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// percentEncode encodes a value as the RPC API signature expects
+func percentEncode(value string) string {
+	encoded := url.QueryEscape(value)
+	return strings.NewReplacer("+", "%20", "*", "%2A", "%7E", "~").Replace(encoded)
+}
@@ -0,0 +1,87 @@
+package ali
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAli(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ali Suite")
+}
+
+var _ = Describe("RealAliCaller", func() {
+	It("should sign requests like the RPC API documentation example", func() {
+		query := canonicalQuery(map[string]string{
+			"AccessKeyId":      "testid",
+			"Action":           "DescribeRegions",
+			"Format":           "XML",
+			"SignatureMethod":  "HMAC-SHA1",
+			"SignatureNonce":   "3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf",
+			"SignatureVersion": "1.0",
+			"Timestamp":        "2016-02-23T12:46:24Z",
+			"Version":          "2014-05-26",
+		})
+		Expect(sign("testsecret", query)).To(Equal("OLeaidS1JvxuMvnyHOwuJ+uX5qY="))
+	})
+
+	Describe("GetCallerName", func() {
+		var (
+			query  url.Values
+			status int
+			body   string
+			caller *RealAliCaller
+		)
+
+		BeforeEach(func() {
+			status, body = http.StatusOK, `{"Arn": "acs:ram::1234567890123456:user/alice", "AccountId": "1234567890123456"}`
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(body))
+			}))
+			DeferCleanup(server.Close)
+
+			caller = NewAliCaller()
+			caller.AccessKeyID, caller.AccessKeySecret, caller.SecurityToken = "testid", "testsecret", ""
+			caller.Endpoint = server.URL + "/"
+			caller.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+		})
+
+		It("should return the last segment of the caller ARN", func() {
+			Expect(caller.GetCallerName()).To(Equal("alice"))
+			Expect(query.Get("Action")).To(Equal("GetCallerIdentity"))
+			Expect(query.Get("Timestamp")).To(Equal("2024-05-01T12:00:00Z"))
+			Expect(query.Get("Signature")).NotTo(BeEmpty())
+			Expect(query.Has("SecurityToken")).To(BeFalse())
+		})
+
+		It("should return the account ID", func() {
+			Expect(caller.GetAccountID()).To(Equal("1234567890123456"))
+		})
+
+		It("should send the security token of temporary credentials", func() {
+			caller.SecurityToken = "token"
+			Expect(caller.GetCallerName()).To(Equal("alice"))
+			Expect(query.Get("SecurityToken")).To(Equal("token"))
+		})
+
+		It("should return API errors", func() {
+			status, body = http.StatusBadRequest, `{"Code": "InvalidAccessKeyId.NotFound", "Message": "Specified access key is not found."}`
+			_, err := caller.GetCallerName()
+			Expect(err).To(MatchError(ContainSubstring("InvalidAccessKeyId.NotFound: Specified access key is not found.")))
+		})
+
+		It("should require credentials", func() {
+			caller.AccessKeyID = ""
+			_, err := caller.GetCallerName()
+			Expect(err).To(MatchError(ContainSubstring("ALIBABA_CLOUD_ACCESS_KEY_ID")))
+		})
+	})
+})
@@ -0,0 +1,176 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// DefaultSessionName names the role sessions of terraform-hybrid in CloudTrail
+const DefaultSessionName = "terraform-hybrid"
+
+// Account is how to act in an AWS account
+type Account struct {
+	ID         string
+	RoleArn    string
+	ExternalID string
+	Profile    string
+	Region     string
+}
+
+// DefaultRefreshWindow is how long before they expire the credentials of a role are assumed again,
+// leaving a terraform command started with them that long to finish
+const DefaultRefreshWindow = 15 * time.Minute
+
+// RoleAssumer assumes the roles of accounts, once per account until the credentials are about to expire
+type RoleAssumer struct {
+	// NewSTS creates the STS client of a profile and region, using the default credential chain without a profile
+	NewSTS func(profile, region string) (stsiface.STSAPI, error)
+	// SessionName names the role sessions
+	SessionName string
+	// RefreshWindow is how long before they expire the credentials are assumed again
+	RefreshWindow time.Duration
+
+	mu  sync.Mutex
+	env map[Account]accountEnv
+	// now returns the current time, time.Now when nil
+	now func() time.Time
+}
+
+// accountEnv is the environment of an account and when its credentials expire, zero when they do not
+type accountEnv struct {
+	env     []string
+	expires time.Time
+}
+
+// NewRoleAssumer creates a RoleAssumer using the shared AWS config
+func NewRoleAssumer() *RoleAssumer {
+	return &RoleAssumer{NewSTS: newSTS, SessionName: DefaultSessionName, RefreshWindow: DefaultRefreshWindow}
+}
+
+// newSTS creates an STS client from the shared config of a profile
+func newSTS(profile, region string) (stsiface.STSAPI, error) {
+	opts := session.Options{Profile: profile, SharedConfigState: session.SharedConfigEnable}
+	if region != "" {
+		opts.Config.Region = aws.String(region)
+	}
+
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %v", err)
+	}
+	return sts.New(sess), nil
+}
+
+// Env returns the environment variables making terraform and the AWS SDKs act in the account:
+// the credentials of its role, or its profile, and its region. Credentials of a role or profile are
+// refused when they act in another account than the configured ID. The role is assumed again once its
+// credentials expire within the refresh window.
+func (ra *RoleAssumer) Env(account Account) ([]string, error) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	now := time.Now
+	if ra.now != nil {
+		now = ra.now
+	}
+	if cached, ok := ra.env[account]; ok && (cached.expires.IsZero() || now().Add(ra.RefreshWindow).Before(cached.expires)) {
+		return cached.env, nil
+	}
+
+	var env []string
+	var expires time.Time
+	switch {
+	case account.RoleArn != "":
+		credentials, err := ra.assumeRole(account)
+		if err != nil {
+			return nil, err
+		}
+		expires = aws.TimeValue(credentials.Expiration)
+		env = append(env,
+			"AWS_ACCESS_KEY_ID="+aws.StringValue(credentials.AccessKeyId),
+			"AWS_SECRET_ACCESS_KEY="+aws.StringValue(credentials.SecretAccessKey),
+			"AWS_SESSION_TOKEN="+aws.StringValue(credentials.SessionToken),
+		)
+	case account.Profile != "":
+		if err := ra.verifyProfile(account); err != nil {
+			return nil, err
+		}
+		// Terraform inherits the environment, where static credentials would take precedence over the profile
+		env = append(env,
+			"AWS_ACCESS_KEY_ID=",
+			"AWS_SECRET_ACCESS_KEY=",
+			"AWS_SESSION_TOKEN=",
+			"AWS_PROFILE="+account.Profile,
+		)
+	}
+	if account.Region != "" {
+		env = append(env, "AWS_REGION="+account.Region, "AWS_DEFAULT_REGION="+account.Region)
+	}
+
+	if ra.env == nil {
+		ra.env = map[Account]accountEnv{}
+	}
+	ra.env[account] = accountEnv{env: env, expires: expires}
+	return env, nil
+}
+
+// assumeRole assumes the role of the account with its profile
+func (ra *RoleAssumer) assumeRole(account Account) (*sts.Credentials, error) {
+	client, err := ra.NewSTS(account.Profile, account.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(account.RoleArn),
+		RoleSessionName: aws.String(ra.SessionName),
+	}
+	if account.ExternalID != "" {
+		input.ExternalId = aws.String(account.ExternalID)
+	}
+	result, err := client.AssumeRole(input)
+	if err != nil {
+		return nil, fmt.Errorf("error assuming role %s: %v", account.RoleArn, err)
+	}
+
+	if result.AssumedRoleUser != nil {
+		if err := checkAccount(account, "role "+account.RoleArn, aws.StringValue(result.AssumedRoleUser.Arn)); err != nil {
+			return nil, err
+		}
+	}
+	return result.Credentials, nil
+}
+
+// verifyProfile checks that the profile acts in the configured account
+func (ra *RoleAssumer) verifyProfile(account Account) error {
+	if account.ID == "" {
+		return nil
+	}
+
+	client, err := ra.NewSTS(account.Profile, account.Region)
+	if err != nil {
+		return err
+	}
+	result, err := client.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("error getting AWS caller identity of profile %s: %v", account.Profile, err)
+	}
+	return checkAccount(account, "profile "+account.Profile, aws.StringValue(result.Arn))
+}
+
+// checkAccount refuses an ARN of another account than the configured ID
+func checkAccount(account Account, source, arn string) error {
+	// arn:partition:service:region:account-id:resource
+	arnParts := strings.Split(arn, ":")
+	if account.ID == "" || len(arnParts) < 5 || arnParts[4] == account.ID {
+		return nil
+	}
+	return fmt.Errorf("%s acts in account %s, not the configured %s", source, arnParts[4], account.ID)
+}
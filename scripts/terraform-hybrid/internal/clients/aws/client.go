@@ -4,35 +4,59 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 )
 
-// Caller defines an interface to get the AWS caller name
-type Caller interface {
-	GetCallerName() (string, error)
+// RealAWSCaller returns the caller from STS GetCallerIdentity
+type RealAWSCaller struct {
+	// STS is the client used, created from the default credential chain when nil
+	STS stsiface.STSAPI
 }
 
-// RealAWSCaller is the actual implementation of AWSCaller
-type RealAWSCaller struct{}
-
-func NewAWSCaller() Caller {
+// NewAWSCaller creates a RealAWSCaller
+func NewAWSCaller() *RealAWSCaller {
 	return &RealAWSCaller{}
 }
 
 // GetCallerName returns the name of the AWS caller
 func (c *RealAWSCaller) GetCallerName() (string, error) {
-	sess := session.Must(session.NewSession())
-	svc := sts.New(sess)
-
-	result, err := svc.GetCallerIdentity(nil)
+	result, err := c.identity()
 	if err != nil {
-		return "", fmt.Errorf("error getting AWS caller identity: %v", err)
+		return "", err
 	}
 
-	arnParts := strings.Split(*result.Arn, "/")
+	arnParts := strings.Split(aws.StringValue(result.Arn), "/")
 	if len(arnParts) > 1 {
 		return arnParts[1], nil
 	}
 	return "", nil
 }
+
+// GetAccountID returns the account the credentials act in
+func (c *RealAWSCaller) GetAccountID() (string, error) {
+	result, err := c.identity()
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(result.Account), nil
+}
+
+// identity calls STS GetCallerIdentity
+func (c *RealAWSCaller) identity() (*sts.GetCallerIdentityOutput, error) {
+	if c.STS == nil {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("error creating AWS session: %v", err)
+		}
+		c.STS = sts.New(sess)
+	}
+
+	result, err := c.STS.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting AWS caller identity: %v", err)
+	}
+	return result, nil
+}
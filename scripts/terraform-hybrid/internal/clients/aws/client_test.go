@@ -0,0 +1,154 @@
+package aws
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAWS(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "AWS Suite")
+}
+
+// fakeSTS returns a fixed caller identity and assumes roles of account 123456789012
+type fakeSTS struct {
+	stsiface.STSAPI
+	output  *sts.GetCallerIdentityOutput
+	err     error
+	expires *time.Time
+	assumed []*sts.AssumeRoleInput
+}
+
+func (f *fakeSTS) GetCallerIdentity(*sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	return f.output, f.err
+}
+
+func (f *fakeSTS) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.assumed = append(f.assumed, input)
+	return &sts.AssumeRoleOutput{
+		AssumedRoleUser: &sts.AssumedRoleUser{Arn: aws.String("arn:aws:sts::123456789012:assumed-role/terraform/" + aws.StringValue(input.RoleSessionName))},
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("ASIAEXAMPLE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      f.expires,
+		},
+	}, nil
+}
+
+var _ = Describe("RealAWSCaller", func() {
+	It("should return the caller name and account of the identity", func() {
+		caller := &RealAWSCaller{STS: &fakeSTS{output: &sts.GetCallerIdentityOutput{
+			Account: aws.String("123456789012"),
+			Arn:     aws.String("arn:aws:sts::123456789012:assumed-role/deploy/alice"),
+		}}}
+
+		Expect(caller.GetCallerName()).To(Equal("deploy"))
+		Expect(caller.GetAccountID()).To(Equal("123456789012"))
+	})
+
+	It("should return STS errors", func() {
+		caller := &RealAWSCaller{STS: &fakeSTS{err: errors.New("ExpiredToken")}}
+
+		_, err := caller.GetAccountID()
+		Expect(err).To(MatchError("error getting AWS caller identity: ExpiredToken"))
+	})
+})
+
+var _ = Describe("RoleAssumer", func() {
+	var (
+		client   *fakeSTS
+		profiles []string
+		assumer  *RoleAssumer
+	)
+
+	BeforeEach(func() {
+		client = &fakeSTS{output: &sts.GetCallerIdentityOutput{
+			Account: aws.String("123456789012"),
+			Arn:     aws.String("arn:aws:iam::123456789012:user/alice"),
+		}}
+		profiles = nil
+		assumer = NewRoleAssumer()
+		assumer.NewSTS = func(profile, region string) (stsiface.STSAPI, error) {
+			profiles = append(profiles, profile)
+			return client, nil
+		}
+	})
+
+	It("should pass the credentials of the assumed role once per account", func() {
+		account := Account{
+			ID:         "123456789012",
+			RoleArn:    "arn:aws:iam::123456789012:role/terraform",
+			ExternalID: "external",
+			Profile:    "root",
+			Region:     "eu-west-1",
+		}
+
+		for range 2 {
+			Expect(assumer.Env(account)).To(Equal([]string{
+				"AWS_ACCESS_KEY_ID=ASIAEXAMPLE",
+				"AWS_SECRET_ACCESS_KEY=secret",
+				"AWS_SESSION_TOKEN=token",
+				"AWS_REGION=eu-west-1",
+				"AWS_DEFAULT_REGION=eu-west-1",
+			}))
+		}
+		Expect(profiles).To(Equal([]string{"root"}))
+		Expect(client.assumed).To(HaveLen(1))
+		Expect(aws.StringValue(client.assumed[0].RoleArn)).To(Equal(account.RoleArn))
+		Expect(aws.StringValue(client.assumed[0].ExternalId)).To(Equal("external"))
+		Expect(aws.StringValue(client.assumed[0].RoleSessionName)).To(Equal(DefaultSessionName))
+	})
+
+	It("should assume the role again when its credentials are about to expire", func() {
+		now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+		expires := now.Add(time.Hour)
+		client.expires = &expires
+		assumer.now = func() time.Time { return now }
+		account := Account{RoleArn: "arn:aws:iam::123456789012:role/terraform"}
+
+		_, err := assumer.Env(account)
+		Expect(err).NotTo(HaveOccurred())
+		now = now.Add(30 * time.Minute)
+		_, err = assumer.Env(account)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.assumed).To(HaveLen(1))
+
+		now = now.Add(20 * time.Minute)
+		_, err = assumer.Env(account)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.assumed).To(HaveLen(2))
+	})
+
+	It("should refuse a role of another account", func() {
+		_, err := assumer.Env(Account{ID: "210987654321", RoleArn: "arn:aws:iam::210987654321:role/terraform"})
+		Expect(err).To(MatchError("role arn:aws:iam::210987654321:role/terraform acts in account 123456789012, not the configured 210987654321"))
+	})
+
+	It("should verify and pass the profile of an account without a role", func() {
+		Expect(assumer.Env(Account{ID: "123456789012", Profile: "dev"})).To(Equal([]string{
+			"AWS_ACCESS_KEY_ID=", "AWS_SECRET_ACCESS_KEY=", "AWS_SESSION_TOKEN=", "AWS_PROFILE=dev",
+		}))
+
+		_, err := assumer.Env(Account{ID: "210987654321", Profile: "prod"})
+		Expect(err).To(MatchError("profile prod acts in account 123456789012, not the configured 210987654321"))
+	})
+
+	It("should return STS errors", func() {
+		client.err = errors.New("AccessDenied")
+
+		_, err := assumer.Env(Account{RoleArn: "arn:aws:iam::123456789012:role/terraform"})
+		Expect(err).To(MatchError("error assuming role arn:aws:iam::123456789012:role/terraform: AccessDenied"))
+	})
+})
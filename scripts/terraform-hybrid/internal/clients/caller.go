@@ -0,0 +1,66 @@
+package clients
+
+import (
+	"fmt"
+	"io"
+	"os/user"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/ali"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/aws"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/gcp"
+)
+
+// Caller defines an interface to get the name of whoever runs the tool in a cloud
+// and the account its credentials act in
+type Caller interface {
+	GetCallerName() (string, error)
+	// GetAccountID returns the AWS account ID, GCP project ID or Alibaba Cloud account ID
+	GetAccountID() (string, error)
+}
+
+// NewCaller returns the Caller of a provider: aws, gcp or ali
+func NewCaller(provider string) (Caller, error) {
+	switch provider {
+	case "aws":
+		return aws.NewAWSCaller(), nil
+	case "gcp":
+		return gcp.NewGCPCaller(), nil
+	case "ali":
+		return ali.NewAliCaller(), nil
+	default:
+		return nil, fmt.Errorf("no caller identity for provider %q, expected aws, gcp or ali", provider)
+	}
+}
+
+// OSUserCaller returns the user running the process
+type OSUserCaller struct{}
+
+// GetCallerName returns the name of the OS user
+func (c *OSUserCaller) GetCallerName() (string, error) {
+	current, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("error getting OS user: %v", err)
+	}
+	return current.Username, nil
+}
+
+// GetAccountID fails since the OS user belongs to no cloud account
+func (c *OSUserCaller) GetAccountID() (string, error) {
+	return "", fmt.Errorf("the OS user has no cloud account")
+}
+
+// ResolveIdentity returns the caller name, falling back to the OS user with a warning when the
+// cloud identity is unavailable, e.g. without credentials
+func ResolveIdentity(caller Caller, out io.Writer) string {
+	name, err := caller.GetCallerName()
+	if err == nil && name != "" {
+		return name
+	}
+
+	name = "unknown"
+	if osUser, userErr := (&OSUserCaller{}).GetCallerName(); userErr == nil {
+		name = osUser
+	}
+	fmt.Fprintf(out, "Warning: could not resolve the caller identity (%v), recording OS user %s\n", err, name)
+	return name
+}
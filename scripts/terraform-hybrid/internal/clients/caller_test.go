@@ -0,0 +1,50 @@
+package clients
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/clients/clientstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestClients(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Clients Suite")
+}
+
+var _ = Describe("Caller", func() {
+	DescribeTable("should create the caller of a provider",
+		func(provider string) {
+			Expect(NewCaller(provider)).NotTo(BeNil())
+		},
+		Entry("aws", "aws"),
+		Entry("gcp", "gcp"),
+		Entry("ali", "ali"),
+	)
+
+	It("should reject unknown providers", func() {
+		_, err := NewCaller("azure")
+		Expect(err).To(MatchError(`no caller identity for provider "azure", expected aws, gcp or ali`))
+	})
+
+	Describe("ResolveIdentity", func() {
+		It("should return the caller name", func() {
+			out := &bytes.Buffer{}
+			Expect(ResolveIdentity(&clientstest.FakeCaller{Name: "alice"}, out)).To(Equal("alice"))
+			Expect(out.String()).To(BeEmpty())
+		})
+
+		It("should fall back to the OS user with a warning", func() {
+			out := &bytes.Buffer{}
+			osUser, err := (&OSUserCaller{}).GetCallerName()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ResolveIdentity(&clientstest.FakeCaller{Err: errors.New("no credentials")}, out)).To(Equal(osUser))
+			Expect(out.String()).To(Equal("Warning: could not resolve the caller identity (no credentials), recording OS user " + osUser + "\n"))
+		})
+	})
+})
@@ -0,0 +1,19 @@
+// Package clientstest provides a fake clients.Caller for tests
+package clientstest
+
+// FakeCaller returns a fixed caller identity, or Err for both the name and the account
+type FakeCaller struct {
+	Name    string
+	Account string
+	Err     error
+}
+
+// GetCallerName returns the fixed name
+func (fc *FakeCaller) GetCallerName() (string, error) {
+	return fc.Name, fc.Err
+}
+
+// GetAccountID returns the fixed account ID
+func (fc *FakeCaller) GetAccountID() (string, error) {
+	return fc.Account, fc.Err
+}
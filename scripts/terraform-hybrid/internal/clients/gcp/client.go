@@ -0,0 +1,109 @@
+package gcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// metadataURL is the metadata server of GCE, GKE and Cloud Build
+const metadataURL = "http://metadata.google.internal/computeMetadata/v1/"
+
+// RealGCPCaller returns the account and project of the application default credentials
+type RealGCPCaller struct {
+	// CredentialsFile is a service account key, from GOOGLE_APPLICATION_CREDENTIALS
+	CredentialsFile string
+	// MetadataURL is asked for the service account and project when there is no credentials file
+	MetadataURL string
+	Client      *http.Client
+}
+
+// NewGCPCaller creates a RealGCPCaller for the environment
+func NewGCPCaller() *RealGCPCaller {
+	return &RealGCPCaller{
+		CredentialsFile: os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"),
+		MetadataURL:     metadataURL,
+		Client:          &http.Client{Timeout: 3 * time.Second},
+	}
+}
+
+// serviceAccountKey holds the fields of a credentials file identifying the caller
+type serviceAccountKey struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	ProjectID   string `json:"project_id"`
+}
+
+// GetCallerName returns the email of the service account key or of the instance service account
+func (c *RealGCPCaller) GetCallerName() (string, error) {
+	if c.CredentialsFile == "" {
+		return c.metadata("instance/service-accounts/default/email")
+	}
+
+	key, err := c.credentials()
+	if err != nil {
+		return "", err
+	}
+	if key.ClientEmail == "" {
+		return "", fmt.Errorf("GCP credentials of type %s have no client_email", key.Type)
+	}
+	return key.ClientEmail, nil
+}
+
+// GetAccountID returns the project of the service account key or of the instance
+func (c *RealGCPCaller) GetAccountID() (string, error) {
+	if c.CredentialsFile == "" {
+		return c.metadata("project/project-id")
+	}
+
+	key, err := c.credentials()
+	if err != nil {
+		return "", err
+	}
+	if key.ProjectID == "" {
+		return "", fmt.Errorf("GCP credentials of type %s have no project_id", key.Type)
+	}
+	return key.ProjectID, nil
+}
+
+// credentials reads the credentials file
+func (c *RealGCPCaller) credentials() (*serviceAccountKey, error) {
+	data, err := os.ReadFile(c.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading GCP credentials: %v", err)
+	}
+
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("error parsing GCP credentials: %v", err)
+	}
+	return &key, nil
+}
+
+// metadata asks the metadata server for a value of the instance
+func (c *RealGCPCaller) metadata(path string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.MetadataURL, "/")+"/"+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("error getting GCP caller identity: %v", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error getting GCP caller identity: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error getting GCP caller identity: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error getting GCP caller identity: metadata server returned %s", resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
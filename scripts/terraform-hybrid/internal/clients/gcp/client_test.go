@@ -0,0 +1,74 @@
+package gcp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestGCP(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "GCP Suite")
+}
+
+var _ = Describe("RealGCPCaller", func() {
+	var caller *RealGCPCaller
+
+	BeforeEach(func() {
+		caller = &RealGCPCaller{Client: http.DefaultClient}
+	})
+
+	It("should return the client email of a service account key", func() {
+		caller.CredentialsFile = filepath.Join(GinkgoT().TempDir(), "key.json")
+		Expect(os.WriteFile(caller.CredentialsFile, []byte(`{
+  "type": "service_account",
+  "client_email": "terraform@project.iam.gserviceaccount.com",
+  "project_id": "project"
+}`), 0600)).To(Succeed())
+
+		Expect(caller.GetCallerName()).To(Equal("terraform@project.iam.gserviceaccount.com"))
+		Expect(caller.GetAccountID()).To(Equal("project"))
+	})
+
+	It("should fail for credentials without a client email", func() {
+		caller.CredentialsFile = filepath.Join(GinkgoT().TempDir(), "adc.json")
+		Expect(os.WriteFile(caller.CredentialsFile, []byte(`{"type": "authorized_user"}`), 0600)).To(Succeed())
+
+		_, err := caller.GetCallerName()
+		Expect(err).To(MatchError("GCP credentials of type authorized_user have no client_email"))
+	})
+
+	It("should ask the metadata server without a credentials file", func() {
+		values := map[string]string{
+			"/instance/service-accounts/default/email": "runner@project.iam.gserviceaccount.com\n",
+			"/project/project-id":                      "project",
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value, ok := values[r.URL.Path]
+			if r.Header.Get("Metadata-Flavor") != "Google" || !ok {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(value))
+		}))
+		DeferCleanup(server.Close)
+		caller.MetadataURL = server.URL
+
+		Expect(caller.GetCallerName()).To(Equal("runner@project.iam.gserviceaccount.com"))
+		Expect(caller.GetAccountID()).To(Equal("project"))
+	})
+
+	It("should fail when the metadata server refuses", func() {
+		server := httptest.NewServer(http.NotFoundHandler())
+		DeferCleanup(server.Close)
+		caller.MetadataURL = server.URL
+
+		_, err := caller.GetCallerName()
+		Expect(err).To(MatchError(ContainSubstring("metadata server returned 404 Not Found")))
+	})
+})
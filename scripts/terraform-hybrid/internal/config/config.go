@@ -3,11 +3,19 @@ package config
 import (
 	"fmt"
 
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+
 	"gopkg.in/yaml.v2"
 )
 
 var (
 	DefaultConfigName = "aws.yaml"
+
+	// DefaultLayoutRoot is the folder the provider trees live in
+	DefaultLayoutRoot = "deploy/provider"
+
+	// DefaultPathTemplate is the layout of root module folders below DefaultLayoutRoot
+	DefaultPathTemplate = "{provider}/accounts/{account}/component/{stack}/**"
 )
 
 type BackendType string
@@ -25,16 +33,18 @@ func (bt BackendType) String() string {
 
 // LocalBackendConfig represents the local backend configuration
 type LocalBackendConfig struct {
-	Path string `yaml:"path"`
+	Path string `yaml:"path" validate:"required"`
 }
 
 // CloudStorageBackendConfig represents the configuration for cloud storage
 type CloudStorageBackendConfig struct {
 	Region     string `yaml:"region"`
-	BucketName string `yaml:"bucket_name"`
-	Type       string `yaml:"type"`
+	BucketName string `yaml:"bucket_name" validate:"required"`
+	Type       string `yaml:"type" validate:"required"`
 	RoleArn    string `yaml:"role_arn"`
 	Endpoint   string `yaml:"endpoint"`
+	// UseLockfile enables S3 native state locking (OpenTofu 1.8+, Terraform 1.10+)
+	UseLockfile bool `yaml:"use_lockfile"`
 }
 
 // PostgresBackendConfig represents the configuration for Postgres
@@ -43,25 +53,136 @@ type PostgresBackendConfig struct {
 	SchemaName       string `yaml:"schema_name" validate:"required"`
 }
 
+// AccountConfig represents a cloud account and how to act in it.
+// It is either the plain account ID or an object with the ID and the AWS role to assume.
+type AccountConfig struct {
+	// ID is the AWS account ID, GCP project ID or Alibaba Cloud account ID
+	ID string `yaml:"id"`
+	// RoleArn is the AWS role assumed for the folders of the account
+	RoleArn string `yaml:"role_arn"`
+	// ExternalID is passed when assuming RoleArn
+	ExternalID string `yaml:"external_id"`
+	// Profile is the AWS profile of the account, or the profile assuming RoleArn
+	Profile string `yaml:"profile"`
+	// Region is the AWS region of the account
+	Region string `yaml:"region"`
+}
+
+// UnmarshalYAML unmarshals an account from its ID or an object
+func (ac *AccountConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var id string
+	if err := unmarshal(&id); err == nil {
+		*ac = AccountConfig{ID: id}
+		return nil
+	}
+
+	type plain AccountConfig
+	return unmarshal((*plain)(ac))
+}
+
 // GlobalConfig represents the global configuration
 type GlobalConfig struct {
-	BackendType BackendType       `yaml:"backend_type"`
-	Backend     interface{}       `yaml:"-"`
-	Accounts    map[string]string `yaml:"accounts"`
+	BackendType BackendType              `yaml:"backend_type"`
+	Backend     interface{}              `yaml:"-"`
+	Accounts    map[string]AccountConfig `yaml:"accounts"`
+}
+
+// LayoutConfig represents the layout of the provider folders
+type LayoutConfig struct {
+	Root         string   `yaml:"root"`
+	PathTemplate string   `yaml:"path_template"`
+	Ignore       []string `yaml:"ignore"`
+}
+
+// WorkspaceConfig represents how workspaces of root modules are named
+type WorkspaceConfig struct {
+	// Strategy is one of path, template, hash or default, path when empty
+	Strategy string `yaml:"strategy" enum:"path,template,hash,default"`
+	// Template is the workspace name for the template strategy, e.g. "{account}-{stack}",
+	// using the placeholders of the layout path template
+	Template string `yaml:"template"`
+}
+
+// EncryptionConfig represents OpenTofu client-side state and plan encryption
+type EncryptionConfig struct {
+	// KeyProvider is the OpenTofu key provider, e.g. pbkdf2, aws_kms, gcp_kms or openbao
+	KeyProvider string `yaml:"key_provider" validate:"required"`
+	// Options are the attributes of the key provider block, e.g. kms_key_id.
+	// Values starting with "var." or "local." are written as references.
+	Options map[string]string `yaml:"options"`
+	// Method is the encryption method, aes_gcm when empty
+	Method string `yaml:"method"`
+	// Enforced makes OpenTofu refuse to read or write unencrypted state and plans
+	Enforced bool `yaml:"enforced"`
+}
+
+// ToolConfig represents the terraform or OpenTofu binary the configuration targets
+type ToolConfig struct {
+	// Binary is the name or path of the binary, e.g. terraform or tofu
+	Binary string `yaml:"binary"`
+	// Version is the version to generate configuration for, detected from the binary when empty
+	Version    string            `yaml:"version"`
+	Encryption *EncryptionConfig `yaml:"encryption"`
+}
+
+// AuditConfig represents who state-changing operations are attributed to and where they are recorded
+type AuditConfig struct {
+	// Log is the file operations are appended to, .terraform-hybrid/audit.log when empty
+	Log string `yaml:"log"`
+	// Provider is the cloud whose caller identity is recorded, taken from the config file name when empty
+	Provider string `yaml:"provider" enum:"aws,gcp,ali"`
 }
 
 // TerraformHybridConfig represents the entire configuration
 type TerraformHybridConfig struct {
-	Global GlobalConfig `yaml:"global"`
+	Global    GlobalConfig    `yaml:"global"`
+	Layout    LayoutConfig    `yaml:"layout"`
+	Workspace WorkspaceConfig `yaml:"workspace"`
+	Tool      ToolConfig      `yaml:"tool"`
+	Audit     AuditConfig     `yaml:"audit"`
+}
+
+// RootOrDefault returns the configured layout root or DefaultLayoutRoot
+func (lc *LayoutConfig) RootOrDefault() string {
+	if lc.Root == "" {
+		return DefaultLayoutRoot
+	}
+	return lc.Root
+}
+
+// PathTemplateOrDefault returns the configured path template or DefaultPathTemplate
+func (lc *LayoutConfig) PathTemplateOrDefault() string {
+	if lc.PathTemplate == "" {
+		return DefaultPathTemplate
+	}
+	return lc.PathTemplate
+}
+
+// Build creates the Layout used for discovery, key computation and workspace naming
+func (lc *LayoutConfig) Build() (*utils.Layout, error) {
+	layout, err := utils.NewLayout(lc.RootOrDefault(), lc.PathTemplateOrDefault(), lc.Ignore)
+	if err != nil {
+		return nil, fmt.Errorf("invalid layout: %v", err)
+	}
+	return layout, nil
+}
+
+// Build creates the WorkspaceNamer naming the workspaces of the layout's root modules
+func (wc *WorkspaceConfig) Build(layout *utils.Layout) (*utils.WorkspaceNamer, error) {
+	namer, err := utils.NewWorkspaceNamer(layout, utils.WorkspaceStrategy(wc.Strategy), wc.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace config: %v", err)
+	}
+	return namer, nil
 }
 
 // UnmarshalYAML unmarshals the YAML configuration into the GlobalConfig struct
 func (gc *GlobalConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// Temporary struct to hold common fields
 	var temp struct {
-		BackendType BackendType            `yaml:"backend_type"`
-		Accounts    map[string]string      `yaml:"accounts"`
-		Backend     map[string]interface{} `yaml:"backend"`
+		BackendType BackendType              `yaml:"backend_type"`
+		Accounts    map[string]AccountConfig `yaml:"accounts"`
+		Backend     map[string]interface{}   `yaml:"backend"`
 	}
 
 	if err := unmarshal(&temp); err != nil {
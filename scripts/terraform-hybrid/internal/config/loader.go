@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -9,7 +10,7 @@ import (
 
 // Loader defines the interface for loading configuration
 type Loader interface {
-	LoadConfig(configFile string) (*TerraformHybridConfig, error)
+	LoadConfig(ctx context.Context, configFile string) (*TerraformHybridConfig, error)
 }
 
 // TerraformConfigLoader is the concrete implementation of ConfigLoader
@@ -19,7 +20,11 @@ func NewConfigLoader() Loader {
 	return &TerraformConfigLoader{}
 }
 
-func (tcl *TerraformConfigLoader) LoadConfig(configFile string) (*TerraformHybridConfig, error) {
+func (tcl *TerraformConfigLoader) LoadConfig(ctx context.Context, configFile string) (*TerraformHybridConfig, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	data, err := os.ReadFile(configFile)
 	if err != nil {
 		return nil, fmt.Errorf("error reading config file %s: %v", configFile, err)
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v2"
+)
+
+// SchemaID is the identifier of the JSON Schema describing the config format
+const SchemaID = "https://github.com/msharbaji/terraform-state-migration/terraform-hybrid/config.schema.json"
+
+// backendConfigTypes maps every BackendType to the struct describing its backend section
+var backendConfigTypes = map[BackendType]reflect.Type{
+	LocalBackendType:        reflect.TypeOf(LocalBackendConfig{}),
+	BackendTypeCloudStorage: reflect.TypeOf(CloudStorageBackendConfig{}),
+	BackendTypePostgres:     reflect.TypeOf(PostgresBackendConfig{}),
+}
+
+// BackendTypes returns all supported backend types in a stable order
+func BackendTypes() []BackendType {
+	types := make([]BackendType, 0, len(backendConfigTypes))
+	for backendType := range backendConfigTypes {
+		types = append(types, backendType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// schemaBuilder collects the definitions referenced while walking the config structs
+type schemaBuilder struct {
+	definitions map[string]interface{}
+}
+
+// GenerateSchema builds the JSON Schema for TerraformHybridConfig
+func GenerateSchema() ([]byte, error) {
+	sb := &schemaBuilder{definitions: map[string]interface{}{}}
+
+	root := sb.structSchema(reflect.TypeOf(TerraformHybridConfig{}))
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["$id"] = SchemaID
+	root["title"] = "TerraformHybridConfig"
+	root["definitions"] = sb.definitions
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// typeSchema returns the schema for a Go type, registering struct types as definitions
+func (sb *schemaBuilder) typeSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(BackendType("")) {
+		return map[string]interface{}{"$ref": sb.define(t, sb.backendTypeSchema)}
+	}
+	if t == reflect.TypeOf(AccountConfig{}) {
+		return map[string]interface{}{"$ref": sb.define(t, func() map[string]interface{} {
+			return map[string]interface{}{"oneOf": []interface{}{map[string]interface{}{"type": "string"}, sb.structSchema(t)}}
+		})}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return map[string]interface{}{"$ref": sb.define(t, func() map[string]interface{} { return sb.structSchema(t) })}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": sb.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": sb.typeSchema(t.Elem())}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// define registers a definition once and returns a reference to it
+func (sb *schemaBuilder) define(t reflect.Type, build func() map[string]interface{}) string {
+	name := t.Name()
+	if _, ok := sb.definitions[name]; !ok {
+		// Reserve the name first so recursive types terminate
+		sb.definitions[name] = map[string]interface{}{}
+		sb.definitions[name] = build()
+	}
+	return "#/definitions/" + name
+}
+
+// structSchema returns the object schema for a struct using its yaml and validate tags
+func (sb *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+
+		properties[name] = sb.typeSchema(field.Type)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			properties[name] = map[string]interface{}{"type": "string", "enum": strings.Split(enum, ",")}
+		}
+		if strings.Contains(field.Tag.Get("validate"), "required") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	if t == reflect.TypeOf(GlobalConfig{}) {
+		sb.addBackendDiscriminator(schema)
+	}
+
+	return schema
+}
+
+// backendTypeSchema returns the enum schema for BackendType
+func (sb *schemaBuilder) backendTypeSchema() map[string]interface{} {
+	var values []string
+	for _, backendType := range BackendTypes() {
+		values = append(values, backendType.String())
+	}
+	return map[string]interface{}{"type": "string", "enum": values}
+}
+
+// addBackendDiscriminator selects the backend section schema based on backend_type
+func (sb *schemaBuilder) addBackendDiscriminator(schema map[string]interface{}) {
+	properties := schema["properties"].(map[string]interface{})
+	properties["backend"] = map[string]interface{}{"type": "object"}
+	schema["required"] = append([]string{"backend_type", "backend"}, toStringSlice(schema["required"])...)
+
+	var rules []interface{}
+	for _, backendType := range BackendTypes() {
+		rules = append(rules, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"backend_type": map[string]interface{}{"const": backendType.String()},
+				},
+			},
+			"then": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"backend": sb.typeSchema(backendConfigTypes[backendType]),
+				},
+			},
+		})
+	}
+	schema["allOf"] = rules
+}
+
+func toStringSlice(v interface{}) []string {
+	values, _ := v.([]string)
+	return values
+}
+
+// SchemaValidator validates config files against the generated JSON Schema
+type SchemaValidator struct {
+	schema *jsonschema.Schema
+}
+
+// NewSchemaValidator compiles the generated JSON Schema
+func NewSchemaValidator() (*SchemaValidator, error) {
+	data, err := GenerateSchema()
+	if err != nil {
+		return nil, fmt.Errorf("error generating schema: %v", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(SchemaID, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("error adding schema resource: %v", err)
+	}
+
+	schema, err := compiler.Compile(SchemaID)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling schema: %v", err)
+	}
+
+	return &SchemaValidator{schema: schema}, nil
+}
+
+// Validate checks YAML config data against the schema and returns one message per violation
+func (sv *SchemaValidator) Validate(data []byte) ([]string, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing YAML: %v", err)
+	}
+
+	document, err := toJSONValue(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sv.schema.Validate(document)
+	if err == nil {
+		return nil, nil
+	}
+
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return nil, fmt.Errorf("error validating config: %v", err)
+	}
+
+	var violations []string
+	var collect func(*jsonschema.ValidationError)
+	collect = func(ve *jsonschema.ValidationError) {
+		if len(ve.Causes) == 0 {
+			location := ve.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			violations = append(violations, fmt.Sprintf("%s: %s", location, ve.Message))
+		}
+		for _, cause := range ve.Causes {
+			collect(cause)
+		}
+	}
+	collect(validationErr)
+
+	return violations, nil
+}
+
+// toJSONValue converts yaml.v2 values into the types produced by encoding/json
+func toJSONValue(v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			converted, err := toJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[fmt.Sprintf("%v", key)] = converted
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			converted, err := toJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = converted
+		}
+		return result, nil
+	case nil, bool, string, int, int64, uint64, float64:
+		return value, nil
+	default:
+		return nil, fmt.Errorf("unsupported YAML value of type %T", v)
+	}
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Config Suite")
+}
+
+var _ = Describe("Schema", func() {
+	var validator *SchemaValidator
+
+	BeforeEach(func() {
+		var err error
+		validator, err = NewSchemaValidator()
+		Expect(err).To(BeNil())
+	})
+
+	It("should generate a schema with the backend_type discriminator", func() {
+		data, err := GenerateSchema()
+		Expect(err).To(BeNil())
+
+		var schema map[string]interface{}
+		Expect(json.Unmarshal(data, &schema)).To(Succeed())
+
+		definitions := schema["definitions"].(map[string]interface{})
+		Expect(definitions).To(HaveKey("GlobalConfig"))
+		Expect(definitions).To(HaveKey("LocalBackendConfig"))
+		Expect(definitions).To(HaveKey("CloudStorageBackendConfig"))
+		Expect(definitions).To(HaveKey("PostgresBackendConfig"))
+		Expect(definitions["BackendType"]).To(HaveKeyWithValue("enum", ConsistOf("local", "cloud_storage", "postgres")))
+		Expect(definitions["GlobalConfig"]).To(HaveKeyWithValue("allOf", HaveLen(len(BackendTypes()))))
+	})
+
+	DescribeTable("should validate config files",
+		func(content string, expectedViolations []string) {
+			violations, err := validator.Validate([]byte(content))
+			Expect(err).To(BeNil())
+			if len(expectedViolations) == 0 {
+				Expect(violations).To(BeEmpty())
+				return
+			}
+			for _, expected := range expectedViolations {
+				Expect(violations).To(ContainElement(ContainSubstring(expected)))
+			}
+		},
+		Entry("valid local backend", `
+global:
+  backend_type: local
+  backend:
+    path: state
+  accounts:
+    aws_test_1: "1234567890123456"
+`, nil),
+		Entry("account with a role to assume", `
+global:
+  backend_type: local
+  backend:
+    path: state
+  accounts:
+    aws_test_1: "1234567890123456"
+    aws_test_2:
+      id: "210987654321"
+      role_arn: arn:aws:iam::210987654321:role/terraform
+      external_id: terraform-hybrid
+      region: eu-west-1
+`, nil),
+		Entry("unknown account field", `
+global:
+  backend_type: local
+  backend:
+    path: state
+  accounts:
+    aws_test_1:
+      role: terraform
+`, []string{"/global/accounts/aws_test_1"}),
+		Entry("valid postgres backend", `
+global:
+  backend_type: postgres
+  backend:
+    connection_string: postgres://localhost:5432/terraform_backend
+    schema_name: terraform_remote_state
+`, nil),
+		Entry("unknown backend type", `
+global:
+  backend_type: s3
+  backend:
+    path: state
+`, []string{"/global/backend_type"}),
+		Entry("missing required backend field", `
+global:
+  backend_type: postgres
+  backend:
+    connection_string: postgres://localhost:5432/terraform_backend
+`, []string{"/global/backend", "schema_name"}),
+		Entry("field of another backend type", `
+global:
+  backend_type: local
+  backend:
+    path: state
+    bucket_name: my-bucket
+`, []string{"bucket_name"}),
+		Entry("unknown top-level key", `
+global:
+  backend_type: local
+  backend:
+    path: state
+globals: {}
+`, []string{"globals"}),
+	)
+})
+
+var _ = Describe("AccountConfig", func() {
+	It("should unmarshal accounts given as an ID or an object", func() {
+		var global GlobalConfig
+		Expect(yaml.Unmarshal([]byte(`
+backend_type: local
+backend:
+  path: state
+accounts:
+  dev: "111111111111"
+  prod:
+    id: "222222222222"
+    role_arn: arn:aws:iam::222222222222:role/terraform
+    external_id: secret
+    profile: root
+    region: eu-west-1
+`), &global)).To(Succeed())
+
+		Expect(global.Accounts).To(Equal(map[string]AccountConfig{
+			"dev": {ID: "111111111111"},
+			"prod": {
+				ID:         "222222222222",
+				RoleArn:    "arn:aws:iam::222222222222:role/terraform",
+				ExternalID: "secret",
+				Profile:    "root",
+				Region:     "eu-west-1",
+			},
+		}))
+	})
+})
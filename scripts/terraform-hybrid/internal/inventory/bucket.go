@@ -0,0 +1,152 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+)
+
+// gcsEndpoint is the S3-compatible XML API of Google Cloud Storage
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// BucketStore lists the state objects of a bucket through the S3 API, which GCS and OSS also offer
+type BucketStore struct {
+	S3     s3iface.S3API
+	Bucket string
+	// Type is the backend type, s3, gcs or oss, which tells where the states of workspaces are kept; s3 when empty
+	Type string
+}
+
+// NewBucketStore creates a BucketStore for the bucket of a cloud_storage backend.
+// s3 uses the default AWS credential chain and the role_arn of the backend. gcs needs HMAC keys and
+// oss the ALIBABA_CLOUD_ACCESS_KEY_* credentials, as both are read through their S3-compatible API.
+func NewBucketStore(backend *config.CloudStorageBackendConfig) (*BucketStore, error) {
+	cfg := aws.NewConfig()
+	if backend.Region != "" {
+		cfg.WithRegion(backend.Region)
+	}
+
+	endpoint := backend.Endpoint
+	switch backend.Type {
+	case "s3":
+		// Custom endpoints are S3-compatible stores such as MinIO, which expect path-style requests
+		cfg.WithS3ForcePathStyle(endpoint != "")
+	case "gcs":
+		if endpoint == "" {
+			endpoint = gcsEndpoint
+		}
+		cfg.WithRegion("auto")
+	case "oss":
+		if endpoint == "" {
+			if backend.Region == "" {
+				return nil, fmt.Errorf("listing an oss bucket needs its region or endpoint")
+			}
+			endpoint = fmt.Sprintf("https://oss-%s.aliyuncs.com", backend.Region)
+		}
+		cfg.WithCredentials(credentials.NewStaticCredentials(
+			os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_ID"), os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET"), os.Getenv("ALIBABA_CLOUD_SECURITY_TOKEN")))
+	default:
+		return nil, fmt.Errorf("listing %s buckets is not supported", backend.Type)
+	}
+	if endpoint != "" {
+		cfg.WithEndpoint(endpoint)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{Config: *cfg, SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %v", err)
+	}
+	if backend.Type == "s3" && backend.RoleArn != "" {
+		return &BucketStore{S3: s3.New(sess, &aws.Config{Credentials: stscreds.NewCredentials(sess, backend.RoleArn)}), Bucket: backend.BucketName, Type: backend.Type}, nil
+	}
+	return &BucketStore{S3: s3.New(sess), Bucket: backend.BucketName, Type: backend.Type}, nil
+}
+
+// Objects reads every object of the bucket whose key ends in .tfstate, addressed by its key
+func (bs *BucketStore) Objects(ctx context.Context) ([]Object, error) {
+	var objects []Object
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bs.Bucket)}
+
+	var readErr error
+	err := bs.S3.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, item := range page.Contents {
+			key := aws.StringValue(item.Key)
+			if !strings.HasSuffix(key, ".tfstate") {
+				continue
+			}
+
+			data, err := bs.read(ctx, key)
+			if err != nil {
+				readErr = err
+				return false
+			}
+			objects = append(objects, Object{Address: key, Workspace: keyWorkspace(bs.Type, key), LastModified: aws.TimeValue(item.LastModified), Data: data})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing bucket %s: %v", bs.Bucket, err)
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Address < objects[j].Address })
+	return objects, nil
+}
+
+// keyWorkspace returns the workspace other than default whose state an object key holds. The gcs backend
+// keeps every workspace as <prefix>/<workspace>.tfstate, the s3 and oss backends keep the workspaces other
+// than default as env:/<workspace>/<key>.
+func keyWorkspace(backendType, key string) string {
+	if backendType == "gcs" {
+		workspace := strings.TrimSuffix(path.Base(key), ".tfstate")
+		if workspace == "default" {
+			return ""
+		}
+		return workspace
+	}
+
+	rest, ok := strings.CutPrefix(key, "env:/")
+	if !ok {
+		return ""
+	}
+	workspace, _, ok := strings.Cut(rest, "/")
+	if !ok {
+		return ""
+	}
+	return workspace
+}
+
+// read downloads an object of the bucket
+func (bs *BucketStore) read(ctx context.Context, key string) ([]byte, error) {
+	output, err := bs.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(bs.Bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s from bucket %s: %v", key, bs.Bucket, err)
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s from bucket %s: %v", key, bs.Bucket, err)
+	}
+	return data, nil
+}
+
+// Close does nothing for buckets
+func (bs *BucketStore) Close() error {
+	return nil
+}
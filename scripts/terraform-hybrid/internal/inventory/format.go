@@ -0,0 +1,211 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+)
+
+// Format is an output format of the inventory
+type Format string
+
+const (
+	FormatTable Format = "table"
+	FormatJSON  Format = "json"
+	FormatCSV   Format = "csv"
+)
+
+// Formats are the supported output formats
+var Formats = []Format{FormatTable, FormatJSON, FormatCSV}
+
+// columns are the headers of the table and CSV output
+var columns = []string{"PROVIDER", "BACKEND", "ADDRESS", "WORKSPACE", "SERIAL", "LINEAGE", "VERSION", "RESOURCES", "LAST MODIFIED", "ACCOUNT", "COMPONENT", "FOLDER"}
+
+// Write renders the states in the given format
+func Write(w io.Writer, states []State, format Format) error {
+	switch format {
+	case FormatTable:
+		return writeTable(w, states)
+	case FormatJSON:
+		return writeJSON(w, states)
+	case FormatCSV:
+		return writeCSV(w, states)
+	default:
+		return fmt.Errorf("unsupported inventory format: %s", format)
+	}
+}
+
+// writeTable renders a table of the states followed by the states that could not be parsed
+func writeTable(w io.Writer, states []State) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, column := range columns {
+		if i > 0 {
+			fmt.Fprint(tw, "\t")
+		}
+		fmt.Fprint(tw, column)
+	}
+	fmt.Fprintln(tw)
+	for _, state := range states {
+		for i, value := range state.row() {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, utils.OrDash(value))
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, state := range states {
+		if state.Error != "" {
+			fmt.Fprintf(w, "\n%s: %s\n", state.Address, state.Error)
+		}
+	}
+	return nil
+}
+
+// writeJSON renders the states for other tools
+func writeJSON(w io.Writer, states []State) error {
+	if states == nil {
+		states = []State{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(states)
+}
+
+// writeCSV renders the states for spreadsheets, with the error as last column
+func writeCSV(w io.Writer, states []State) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append(columns, "ERROR")); err != nil {
+		return err
+	}
+	for _, state := range states {
+		if err := writer.Write(append(state.row(), state.Error)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// row returns the values of the columns of a state
+func (s State) row() []string {
+	return []string{
+		s.Provider, s.Backend, s.Address, s.Workspace, strconv.FormatInt(s.Serial, 10), s.Lineage, s.TerraformVersion,
+		strconv.Itoa(s.Resources), s.lastModified(), s.Account, s.Component, s.Folder,
+	}
+}
+
+// lastModified returns the last modification in RFC 3339, empty when it is unknown
+func (s State) lastModified() string {
+	if s.LastModified == nil {
+		return ""
+	}
+	return s.LastModified.Format(time.RFC3339)
+}
+
+// orphanColumns are the headers of the CSV output of orphans
+var orphanColumns = []string{"KIND", "PROVIDER", "BACKEND", "ADDRESS", "RESOURCES", "SERIAL", "LAST MODIFIED", "ACCOUNT", "COMPONENT", "FOLDER"}
+
+// WriteOrphans renders orphaned states and folders without a state in the given format
+func WriteOrphans(w io.Writer, orphans *Orphans, format Format) error {
+	switch format {
+	case FormatTable:
+		return writeOrphansTable(w, orphans)
+	case FormatJSON:
+		return writeOrphansJSON(w, orphans)
+	case FormatCSV:
+		return writeOrphansCSV(w, orphans)
+	default:
+		return fmt.Errorf("unsupported inventory format: %s", format)
+	}
+}
+
+// writeOrphansTable renders a table of the orphaned states and one of the folders without a state
+func writeOrphansTable(w io.Writer, orphans *Orphans) error {
+	fmt.Fprintf(w, "Orphaned states: %d, tracking %d resources\n", len(orphans.States), orphans.Resources())
+	if len(orphans.States) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PROVIDER\tBACKEND\tADDRESS\tRESOURCES\tSERIAL\tLAST MODIFIED\tACCOUNT\tCOMPONENT")
+		for _, state := range orphans.States {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n", state.Provider, state.Backend, state.Address, state.Resources,
+				state.Serial, utils.OrDash(state.lastModified()), utils.OrDash(state.Account), utils.OrDash(state.Component))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "\nFolders without state: %d\n", len(orphans.Folders))
+	if len(orphans.Folders) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PROVIDER\tBACKEND\tACCOUNT\tCOMPONENT\tEXPECTED ADDRESS")
+		for _, folder := range orphans.Folders {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", folder.Provider, folder.Backend, utils.OrDash(folder.Account),
+				utils.OrDash(folder.Component), folder.Address)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	for _, state := range orphans.States {
+		if state.Error != "" {
+			fmt.Fprintf(w, "\n%s: %s\n", state.Address, state.Error)
+		}
+	}
+	return nil
+}
+
+// writeOrphansJSON renders the orphans for other tools
+func writeOrphansJSON(w io.Writer, orphans *Orphans) error {
+	output := struct {
+		Resources int            `json:"resources"`
+		States    []State        `json:"states"`
+		Folders   []MissingState `json:"folders"`
+	}{orphans.Resources(), orphans.States, orphans.Folders}
+	if output.States == nil {
+		output.States = []State{}
+	}
+	if output.Folders == nil {
+		output.Folders = []MissingState{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// writeOrphansCSV renders orphaned states and folders without a state as rows of one sheet
+func writeOrphansCSV(w io.Writer, orphans *Orphans) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(orphanColumns); err != nil {
+		return err
+	}
+	for _, state := range orphans.States {
+		if err := writer.Write([]string{
+			"orphaned state", state.Provider, state.Backend, state.Address, strconv.Itoa(state.Resources),
+			strconv.FormatInt(state.Serial, 10), state.lastModified(), state.Account, state.Component, "",
+		}); err != nil {
+			return err
+		}
+	}
+	for _, folder := range orphans.Folders {
+		if err := writer.Write([]string{
+			"folder without state", folder.Provider, folder.Backend, folder.Address, "", "", "", folder.Account, folder.Component, folder.Folder,
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,89 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/workspace"
+)
+
+// Object is a state as a backend stores it
+type Object struct {
+	// Address locates the state in the backend: the path for local, the object key for cloud storage
+	// and the workspace for Postgres
+	Address string
+	// Workspace is the workspace other than default whose state the address holds, where the address tells
+	Workspace string
+	// LastModified is when the state was last written, zero when the backend does not know
+	LastModified time.Time
+	Data         []byte
+}
+
+// Store lists the states kept by a backend
+type Store interface {
+	// Objects returns every state of the backend
+	Objects(ctx context.Context) ([]Object, error)
+	// Close releases the connections of the store
+	Close() error
+}
+
+// State describes one state of the inventory and the root module it belongs to
+type State struct {
+	// Provider is the provider of the config the state was found through, e.g. aws
+	Provider string `json:"provider"`
+	Backend  string `json:"backend"`
+	Address  string `json:"address"`
+	// Workspace is the workspace other than default the state belongs to, where the address tells
+	Workspace string `json:"workspace,omitempty"`
+	Serial    int64  `json:"serial"`
+	Lineage   string `json:"lineage,omitempty"`
+	// TerraformVersion is the version of terraform or OpenTofu that last wrote the state
+	TerraformVersion string     `json:"terraform_version,omitempty"`
+	Resources        int        `json:"resources"`
+	LastModified     *time.Time `json:"last_modified,omitempty"`
+	// Folder is the root module whose generated backend stores its state at Address, empty when none does
+	Folder  string `json:"folder,omitempty"`
+	Account string `json:"account,omitempty"`
+	// Component is the path relative to the layout root of Folder, or of the folder the address was generated for
+	Component string `json:"component,omitempty"`
+	// Error is set when the state could not be parsed
+	Error string `json:"error,omitempty"`
+}
+
+// stateHeader is the part of a terraform state file describing the state itself
+type stateHeader struct {
+	Serial           int64  `json:"serial"`
+	Lineage          string `json:"lineage"`
+	TerraformVersion string `json:"terraform_version"`
+}
+
+// ReadState reads the serial, lineage, terraform version and resource count of a stored state
+func ReadState(object Object) State {
+	state := State{Address: object.Address, Workspace: object.Workspace}
+	if !object.LastModified.IsZero() {
+		modified := object.LastModified.UTC()
+		state.LastModified = &modified
+	}
+	if len(object.Data) == 0 {
+		return state
+	}
+
+	var header stateHeader
+	if err := json.Unmarshal(object.Data, &header); err != nil {
+		state.Error = fmt.Sprintf("error parsing state: %v", err)
+		return state
+	}
+	state.Serial = header.Serial
+	state.Lineage = header.Lineage
+	state.TerraformVersion = header.TerraformVersion
+
+	resources, err := workspace.CountResources(object.Data)
+	if err != nil {
+		state.Error = err.Error()
+		return state
+	}
+	state.Resources = resources
+	return state
+}
@@ -0,0 +1,253 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestInventory(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Inventory Suite")
+}
+
+const stateJSON = `{
+  "version": 4,
+  "terraform_version": "1.9.5",
+  "serial": 7,
+  "lineage": "3f1c",
+  "resources": [
+    {"mode": "managed", "type": "aws_vpc", "name": "main", "instances": [{}]},
+    {"mode": "managed", "type": "aws_subnet", "name": "private", "instances": [{}, {}]},
+    {"mode": "data", "type": "aws_ami", "name": "latest", "instances": [{}]}
+  ]
+}`
+
+// fakeS3 serves a fixed set of objects in pages of one object
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string]string
+	keys    []string
+}
+
+func (f *fakeS3) ListObjectsV2PagesWithContext(
+	_ aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option,
+) error {
+	for i, key := range f.keys {
+		page := &s3.ListObjectsV2Output{Contents: []*s3.Object{{
+			Key:          aws.String(key),
+			LastModified: aws.Time(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)),
+		}}}
+		if !fn(page, i == len(f.keys)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeS3) GetObjectWithContext(_ aws.Context, input *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(f.objects[aws.StringValue(input.Key)]))}, nil
+}
+
+var _ = Describe("Inventory", func() {
+	Describe("ReadState", func() {
+		It("should read the header and count managed resource instances", func() {
+			state := ReadState(Object{Address: "aws/network/terraform.tfstate", Data: []byte(stateJSON)})
+			Expect(state.Serial).To(Equal(int64(7)))
+			Expect(state.Lineage).To(Equal("3f1c"))
+			Expect(state.TerraformVersion).To(Equal("1.9.5"))
+			Expect(state.Resources).To(Equal(3))
+			Expect(state.LastModified).To(BeNil())
+			Expect(state.Error).To(BeEmpty())
+		})
+
+		It("should report states that cannot be parsed", func() {
+			state := ReadState(Object{Address: "broken", Data: []byte("{")})
+			Expect(state.Error).To(ContainSubstring("error parsing state"))
+		})
+	})
+
+	Describe("LocalStore", func() {
+		It("should read the state files below every directory and skip missing ones", func() {
+			dir := GinkgoT().TempDir()
+			statePath := filepath.Join(dir, "aws", "network", "terraform.tfstate")
+			Expect(os.MkdirAll(filepath.Dir(statePath), 0755)).To(Succeed())
+			Expect(os.WriteFile(statePath, []byte(stateJSON), 0644)).To(Succeed())
+			Expect(os.WriteFile(statePath+".backup", []byte(stateJSON), 0644)).To(Succeed())
+
+			objects, err := NewLocalStore(dir, filepath.Join(dir, "missing"), dir).Objects(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(HaveLen(1))
+			Expect(objects[0].Address).To(Equal(statePath))
+			Expect(objects[0].LastModified.IsZero()).To(BeFalse())
+			Expect(string(objects[0].Data)).To(Equal(stateJSON))
+		})
+
+		It("should read the workspace of the states below terraform.tfstate.d", func() {
+			dir := GinkgoT().TempDir()
+			statePath := filepath.Join(dir, "terraform.tfstate.d", "aws_prod_network", "terraform.tfstate")
+			Expect(os.MkdirAll(filepath.Dir(statePath), 0755)).To(Succeed())
+			Expect(os.WriteFile(statePath, []byte(stateJSON), 0644)).To(Succeed())
+
+			objects, err := NewLocalStore(filepath.Join(dir, "terraform.tfstate.d")).Objects(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(HaveLen(1))
+			Expect(objects[0].Address).To(Equal(statePath))
+			Expect(objects[0].Workspace).To(Equal("aws_prod_network"))
+			Expect(ReadState(objects[0]).Workspace).To(Equal("aws_prod_network"))
+		})
+	})
+
+	Describe("BucketStore", func() {
+		It("should read the state objects of every page", func() {
+			store := &BucketStore{Bucket: "state", S3: &fakeS3{
+				keys:    []string{"aws/network/terraform.tfstate", "aws/network/plan.json", "aws/dns/terraform.tfstate"},
+				objects: map[string]string{"aws/network/terraform.tfstate": stateJSON, "aws/dns/terraform.tfstate": "{}"},
+			}}
+
+			objects, err := store.Objects(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(HaveLen(2))
+			Expect(objects[0].Address).To(Equal("aws/dns/terraform.tfstate"))
+			Expect(objects[1].Address).To(Equal("aws/network/terraform.tfstate"))
+			Expect(objects[1].LastModified).To(Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)))
+			Expect(string(objects[1].Data)).To(Equal(stateJSON))
+		})
+
+		It("should read the workspace of the objects below env:/", func() {
+			store := &BucketStore{Bucket: "state", S3: &fakeS3{
+				keys:    []string{"env:/aws_prod_network/aws/network/terraform.tfstate", "aws/network/terraform.tfstate"},
+				objects: map[string]string{"env:/aws_prod_network/aws/network/terraform.tfstate": stateJSON, "aws/network/terraform.tfstate": "{}"},
+			}}
+
+			objects, err := store.Objects(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(HaveLen(2))
+			Expect(objects[0].Workspace).To(BeEmpty())
+			Expect(objects[1].Address).To(Equal("env:/aws_prod_network/aws/network/terraform.tfstate"))
+			Expect(objects[1].Workspace).To(Equal("aws_prod_network"))
+		})
+
+		It("should read the workspace of gcs objects from their name", func() {
+			store := &BucketStore{Bucket: "state", Type: "gcs", S3: &fakeS3{
+				keys:    []string{"aws/network/default.tfstate", "aws/network/aws_prod_network.tfstate"},
+				objects: map[string]string{"aws/network/default.tfstate": "{}", "aws/network/aws_prod_network.tfstate": stateJSON},
+			}}
+
+			objects, err := store.Objects(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(HaveLen(2))
+			Expect(objects[0].Address).To(Equal("aws/network/aws_prod_network.tfstate"))
+			Expect(objects[0].Workspace).To(Equal("aws_prod_network"))
+			Expect(objects[1].Address).To(Equal("aws/network/default.tfstate"))
+			Expect(objects[1].Workspace).To(BeEmpty())
+		})
+	})
+
+	Describe("Write", func() {
+		var states []State
+
+		BeforeEach(func() {
+			modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			states = []State{
+				{
+					Provider: "aws", Backend: "cloud_storage", Address: "aws/accounts/prod/component/network/terraform.tfstate",
+					Serial: 7, Lineage: "3f1c", TerraformVersion: "1.9.5", Resources: 3, LastModified: &modified,
+					Folder: "deploy/provider/aws/accounts/prod/component/network", Account: "prod", Component: "aws/accounts/prod/component/network",
+				},
+				{Provider: "aws", Backend: "cloud_storage", Address: "old/terraform.tfstate", Error: "error parsing state: unexpected end of JSON input"},
+			}
+		})
+
+		It("should render a table followed by the states that could not be parsed", func() {
+			var out bytes.Buffer
+			Expect(Write(&out, states, FormatTable)).To(Succeed())
+			lines := strings.Split(out.String(), "\n")
+			Expect(lines[0]).To(MatchRegexp(`^PROVIDER\s+BACKEND\s+ADDRESS\s+WORKSPACE\s+SERIAL\s+LINEAGE\s+VERSION\s+RESOURCES\s+LAST MODIFIED\s+ACCOUNT\s+COMPONENT\s+FOLDER$`))
+			Expect(lines[1]).To(MatchRegexp(`^aws\s+cloud_storage\s+aws/accounts/prod/component/network/terraform.tfstate\s+-\s+7\s+3f1c\s+1.9.5\s+3\s+2024-05-01T12:00:00Z\s+prod\s+`))
+			Expect(lines[2]).To(MatchRegexp(`^aws\s+cloud_storage\s+old/terraform.tfstate\s+-\s+0\s+-\s+-\s+0\s+-\s+-\s+-\s+-$`))
+			Expect(out.String()).To(HaveSuffix("\nold/terraform.tfstate: error parsing state: unexpected end of JSON input\n"))
+		})
+
+		It("should render CSV with the error as last column", func() {
+			var out bytes.Buffer
+			Expect(Write(&out, states, FormatCSV)).To(Succeed())
+			Expect(out.String()).To(Equal(`PROVIDER,BACKEND,ADDRESS,WORKSPACE,SERIAL,LINEAGE,VERSION,RESOURCES,LAST MODIFIED,ACCOUNT,COMPONENT,FOLDER,ERROR
+aws,cloud_storage,aws/accounts/prod/component/network/terraform.tfstate,,7,3f1c,1.9.5,3,2024-05-01T12:00:00Z,prod,aws/accounts/prod/component/network,deploy/provider/aws/accounts/prod/component/network,
+aws,cloud_storage,old/terraform.tfstate,,0,,,0,,,,,error parsing state: unexpected end of JSON input
+`))
+		})
+
+		It("should render JSON", func() {
+			var out bytes.Buffer
+			Expect(Write(&out, states, FormatJSON)).To(Succeed())
+
+			var decoded []map[string]interface{}
+			Expect(json.Unmarshal(out.Bytes(), &decoded)).To(Succeed())
+			Expect(decoded).To(HaveLen(2))
+			Expect(decoded[0]).To(HaveKeyWithValue("last_modified", "2024-05-01T12:00:00Z"))
+			Expect(decoded[0]).To(HaveKeyWithValue("component", "aws/accounts/prod/component/network"))
+			Expect(decoded[1]).NotTo(HaveKey("folder"))
+		})
+
+		It("should reject unknown formats", func() {
+			Expect(Write(io.Discard, states, Format("xml"))).To(MatchError("unsupported inventory format: xml"))
+		})
+	})
+
+	Describe("WriteOrphans", func() {
+		var orphans *Orphans
+
+		BeforeEach(func() {
+			orphans = &Orphans{
+				States: []State{{
+					Provider: "aws", Backend: "cloud_storage", Address: "aws/accounts/prod/component/legacy/terraform.tfstate",
+					Serial: 12, Resources: 4, Account: "prod", Component: "aws/accounts/prod/component/legacy",
+				}},
+				Folders: []MissingState{{
+					Provider: "aws", Backend: "cloud_storage", Address: "aws/accounts/dev/component/dns/terraform.tfstate",
+					Account: "dev", Component: "aws/accounts/dev/component/dns", Folder: "deploy/provider/aws/accounts/dev/component/dns",
+				}},
+			}
+		})
+
+		It("should render the orphaned states with their resources and the folders without state", func() {
+			var out bytes.Buffer
+			Expect(WriteOrphans(&out, orphans, FormatTable)).To(Succeed())
+			lines := strings.Split(out.String(), "\n")
+			Expect(lines[0]).To(Equal("Orphaned states: 1, tracking 4 resources"))
+			Expect(lines[2]).To(MatchRegexp(`^aws\s+cloud_storage\s+aws/accounts/prod/component/legacy/terraform.tfstate\s+4\s+12\s+-\s+prod\s+aws/accounts/prod/component/legacy$`))
+			Expect(lines[4]).To(Equal("Folders without state: 1"))
+			Expect(lines[6]).To(MatchRegexp(`^aws\s+cloud_storage\s+dev\s+aws/accounts/dev/component/dns\s+aws/accounts/dev/component/dns/terraform.tfstate$`))
+		})
+
+		It("should render both kinds as CSV rows", func() {
+			var out bytes.Buffer
+			Expect(WriteOrphans(&out, orphans, FormatCSV)).To(Succeed())
+			Expect(out.String()).To(Equal(`KIND,PROVIDER,BACKEND,ADDRESS,RESOURCES,SERIAL,LAST MODIFIED,ACCOUNT,COMPONENT,FOLDER
+orphaned state,aws,cloud_storage,aws/accounts/prod/component/legacy/terraform.tfstate,4,12,,prod,aws/accounts/prod/component/legacy,
+folder without state,aws,cloud_storage,aws/accounts/dev/component/dns/terraform.tfstate,,,,dev,aws/accounts/dev/component/dns,deploy/provider/aws/accounts/dev/component/dns
+`))
+		})
+
+		It("should render empty lists as JSON", func() {
+			var out bytes.Buffer
+			Expect(WriteOrphans(&out, &Orphans{}, FormatJSON)).To(Succeed())
+			Expect(out.String()).To(MatchJSON(`{"resources": 0, "states": [], "folders": []}`))
+		})
+	})
+})
@@ -0,0 +1,88 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocalStore finds the state files of the local backend below its state directories
+type LocalStore struct {
+	// Dirs are the directories searched for *.tfstate files, such as the terraform.tfstate.d
+	// directories holding the states of the workspaces other than default
+	Dirs []string
+}
+
+// NewLocalStore creates a LocalStore searching the given directories
+func NewLocalStore(dirs ...string) *LocalStore {
+	return &LocalStore{Dirs: dirs}
+}
+
+// Objects reads every *.tfstate file below the directories, addressed by its absolute path.
+// Directories that do not exist hold no states.
+func (ls *LocalStore) Objects(ctx context.Context) ([]Object, error) {
+	seen := map[string]bool{}
+	var objects []Object
+	for _, dir := range ls.Dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return fs.SkipDir
+			}
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tfstate") {
+				return nil
+			}
+
+			address, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			if seen[address] {
+				return nil
+			}
+			seen[address] = true
+
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, Object{Address: address, Workspace: localWorkspace(address), LastModified: info.ModTime(), Data: data})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing states in %s: %v", dir, err)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Address < objects[j].Address })
+	return objects, nil
+}
+
+// localWorkspace returns the workspace of a state at terraform.tfstate.d/<workspace>/terraform.tfstate,
+// where the local backend keeps the states of the workspaces other than default
+func localWorkspace(path string) string {
+	dir := filepath.Dir(path)
+	if filepath.Base(path) != "terraform.tfstate" || filepath.Base(filepath.Dir(dir)) != "terraform.tfstate.d" {
+		return ""
+	}
+	return filepath.Base(dir)
+}
+
+// Close does nothing for local states
+func (ls *LocalStore) Close() error {
+	return nil
+}
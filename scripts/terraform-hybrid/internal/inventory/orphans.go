@@ -0,0 +1,40 @@
+package inventory
+
+// MissingState is a discovered folder without a state in the backend
+type MissingState struct {
+	Provider string `json:"provider"`
+	Backend  string `json:"backend"`
+	// Address is where the generated backend of the folder stores its state
+	Address   string `json:"address"`
+	Account   string `json:"account,omitempty"`
+	Component string `json:"component,omitempty"`
+	Folder    string `json:"folder"`
+}
+
+// Orphans are the states and folders of a backend that do not belong together
+type Orphans struct {
+	// States are the states no discovered folder writes
+	States []State `json:"states"`
+	// Folders are the discovered folders without a state
+	Folders []MissingState `json:"folders"`
+}
+
+// Add appends the orphans of another backend
+func (o *Orphans) Add(other *Orphans) {
+	o.States = append(o.States, other.States...)
+	o.Folders = append(o.Folders, other.Folders...)
+}
+
+// Empty reports whether every state belongs to a folder and every folder has a state
+func (o *Orphans) Empty() bool {
+	return len(o.States) == 0 && len(o.Folders) == 0
+}
+
+// Resources returns the number of resources the orphaned states still track
+func (o *Orphans) Resources() int {
+	resources := 0
+	for _, state := range o.States {
+		resources += state.Resources
+	}
+	return resources
+}
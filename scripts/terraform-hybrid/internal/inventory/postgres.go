@@ -0,0 +1,40 @@
+package inventory
+
+import (
+	"context"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/postgres"
+)
+
+// PostgresStore lists the workspaces of terraform's pg backend
+type PostgresStore struct {
+	Schema *postgres.Schema
+}
+
+// NewPostgresStore creates a PostgresStore for the schema
+func NewPostgresStore(schema *postgres.Schema) *PostgresStore {
+	return &PostgresStore{Schema: schema}
+}
+
+// Objects returns the state of every workspace, addressed by the workspace name
+func (ps *PostgresStore) Objects(ctx context.Context) ([]Object, error) {
+	states, err := ps.Schema.States(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]Object, 0, len(states))
+	for _, state := range states {
+		object := Object{Address: state.Workspace, Data: []byte(state.Data)}
+		if state.LastModified.Valid {
+			object.LastModified = state.LastModified.Time
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// Close closes the database connections
+func (ps *PostgresStore) Close() error {
+	return ps.Schema.Close()
+}
@@ -0,0 +1,262 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+)
+
+// Format is an output format of an Aggregate
+type Format string
+
+const (
+	FormatTable    Format = "table"
+	FormatMarkdown Format = "markdown"
+	FormatJSON     Format = "json"
+)
+
+// actionSymbols are the markers terraform uses for each action
+var actionSymbols = map[Action]string{
+	ActionCreate:  "+",
+	ActionUpdate:  "~",
+	ActionDelete:  "-",
+	ActionReplace: "-/+",
+}
+
+// ComponentReport is the plan outcome of one root module
+type ComponentReport struct {
+	Account string `json:"account,omitempty"`
+	// Component is the path of the root module relative to the layout root
+	Component string   `json:"component"`
+	Folder    string   `json:"folder"`
+	Summary   *Summary `json:"summary,omitempty"`
+	// Error is set when the component could not be planned or summarized
+	Error string `json:"error,omitempty"`
+	// NotPlanned is set when the component was skipped or not started, with the reason in Error
+	NotPlanned bool `json:"not_planned,omitempty"`
+}
+
+// Status describes the outcome of the component as "not planned", "failed", "changes" or "no changes"
+func (cr *ComponentReport) Status() string {
+	switch {
+	case cr.NotPlanned:
+		return "not planned"
+	case cr.Summary == nil:
+		return "failed"
+	case cr.Summary.HasChanges():
+		return "changes"
+	default:
+		return "no changes"
+	}
+}
+
+// Aggregate collects the plan outcomes of many components. It is safe for concurrent use.
+type Aggregate struct {
+	// Expected is the number of selected components, which must all be planned for the report to show no changes
+	Expected int
+
+	mu         sync.Mutex
+	components []ComponentReport
+}
+
+// Add records the outcome of a component
+func (r *Aggregate) Add(component ComponentReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.components = append(r.components, component)
+}
+
+// Components returns the outcomes ordered by account and component
+func (r *Aggregate) Components() []ComponentReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	components := append([]ComponentReport(nil), r.components...)
+	sort.Slice(components, func(i, j int) bool {
+		if components[i].Account != components[j].Account {
+			return components[i].Account < components[j].Account
+		}
+		return components[i].Component < components[j].Component
+	})
+	return components
+}
+
+// Has reports whether the outcome of the component in folder was recorded
+func (r *Aggregate) Has(folder string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, component := range r.components {
+		if component.Folder == folder {
+			return true
+		}
+	}
+	return false
+}
+
+// NoChanges reports whether every expected component was planned without changes,
+// the signal that a migration preserved the state of every component
+func (r *Aggregate) NoChanges() bool {
+	components := r.Components()
+	for _, component := range components {
+		if component.Status() != "no changes" {
+			return false
+		}
+	}
+	return len(components) > 0 && len(components) >= r.Expected
+}
+
+// totals sums the counts of every action and the number of components per status
+func (r *Aggregate) totals(components []ComponentReport) (map[Action]int, map[string]int) {
+	actions, statuses := map[Action]int{}, map[string]int{}
+	for _, component := range components {
+		statuses[component.Status()]++
+		if component.Summary == nil {
+			continue
+		}
+		for _, action := range Actions {
+			actions[action] += component.Summary.Count(action)
+		}
+	}
+	return actions, statuses
+}
+
+// verdict summarizes the report in one line
+func (r *Aggregate) verdict(components []ComponentReport) string {
+	_, statuses := r.totals(components)
+	if r.NoChanges() {
+		return fmt.Sprintf("No changes in any of the %d components", len(components))
+	}
+	verdict := fmt.Sprintf("%d of %d components have changes, %d failed", statuses["changes"], len(components), statuses["failed"])
+	if notPlanned := statuses["not planned"] + max(r.Expected-len(components), 0); notPlanned > 0 {
+		verdict += fmt.Sprintf(", %d not planned", notPlanned)
+	}
+	return verdict
+}
+
+// Write renders the report in the given format
+func (r *Aggregate) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatTable:
+		return r.writeTable(w)
+	case FormatMarkdown:
+		return r.writeMarkdown(w)
+	case FormatJSON:
+		return r.writeJSON(w)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeTable renders a table of counts followed by the changed addresses of every component
+func (r *Aggregate) writeTable(w io.Writer) error {
+	components := r.Components()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACCOUNT\tCOMPONENT\tCREATE\tUPDATE\tDELETE\tREPLACE\tSTATUS")
+	for _, component := range components {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", utils.OrDash(component.Account), component.Component,
+			strings.Join(counts(component.Summary), "\t"), component.Status())
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, component := range components {
+		if component.Error != "" {
+			fmt.Fprintf(w, "\n%s: %s\n", component.Component, component.Error)
+			continue
+		}
+		if component.Summary.HasChanges() {
+			fmt.Fprintf(w, "\n%s:\n", component.Component)
+			for _, line := range changeLines(component.Summary) {
+				fmt.Fprintf(w, "  %s\n", line)
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "\n%s\n", r.verdict(components))
+	return err
+}
+
+// writeMarkdown renders the report for a pull request comment
+func (r *Aggregate) writeMarkdown(w io.Writer) error {
+	components := r.Components()
+
+	var sb strings.Builder
+	sb.WriteString("## Plan summary\n\n")
+	if r.NoChanges() {
+		fmt.Fprintf(&sb, ":white_check_mark: %s\n\n", r.verdict(components))
+	} else {
+		fmt.Fprintf(&sb, ":warning: %s\n\n", r.verdict(components))
+	}
+
+	sb.WriteString("| Account | Component | Create | Update | Delete | Replace | Status |\n")
+	sb.WriteString("|---|---|---:|---:|---:|---:|---|\n")
+	for _, component := range components {
+		fmt.Fprintf(&sb, "| %s | `%s` | %s | %s |\n", utils.OrDash(component.Account), component.Component,
+			strings.Join(counts(component.Summary), " | "), component.Status())
+	}
+
+	for _, component := range components {
+		switch {
+		case component.Error != "":
+			fmt.Fprintf(&sb, "\n<details><summary><code>%s</code> %s</summary>\n\n```\n%s\n```\n</details>\n",
+				component.Component, component.Status(), component.Error)
+		case component.Summary.HasChanges():
+			fmt.Fprintf(&sb, "\n<details><summary><code>%s</code></summary>\n\n```diff\n%s\n```\n</details>\n",
+				component.Component, strings.Join(changeLines(component.Summary), "\n"))
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeJSON renders the report for other tools
+func (r *Aggregate) writeJSON(w io.Writer) error {
+	components := r.Components()
+	actions, statuses := r.totals(components)
+
+	output := struct {
+		NoChanges  bool              `json:"no_changes"`
+		Totals     map[Action]int    `json:"totals"`
+		Statuses   map[string]int    `json:"statuses"`
+		Components []ComponentReport `json:"components"`
+	}{r.NoChanges(), actions, statuses, components}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// counts returns the number of changes per action, or dashes when the component has no summary
+func counts(summary *Summary) []string {
+	values := make([]string, len(Actions))
+	for i, action := range Actions {
+		if summary == nil {
+			values[i] = "-"
+		} else {
+			values[i] = fmt.Sprint(summary.Count(action))
+		}
+	}
+	return values
+}
+
+// changeLines lists the changed addresses prefixed with the symbol of their action
+func changeLines(summary *Summary) []string {
+	var lines []string
+	for _, action := range Actions {
+		for _, address := range summary.Changes[action] {
+			lines = append(lines, fmt.Sprintf("%s %s", actionSymbols[action], address))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,147 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPlan(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Plan Suite")
+}
+
+const showJSON = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {"address": "aws_vpc.main", "change": {"actions": ["no-op"]}},
+    {"address": "aws_subnet.b", "change": {"actions": ["create"]}},
+    {"address": "aws_subnet.a", "change": {"actions": ["create"]}},
+    {"address": "aws_route.default", "change": {"actions": ["update"]}},
+    {"address": "aws_eip.old", "change": {"actions": ["delete"]}},
+    {"address": "aws_instance.web", "change": {"actions": ["delete", "create"]}},
+    {"address": "aws_instance.api", "change": {"actions": ["create", "delete"]}},
+    {"address": "data.aws_ami.latest", "change": {"actions": ["read"]}}
+  ]
+}`
+
+var _ = Describe("ParseShowJSON", func() {
+	It("should group the changed addresses by action", func() {
+		summary, err := ParseShowJSON([]byte(showJSON))
+		Expect(err).To(BeNil())
+		Expect(summary.Changes).To(Equal(map[Action][]string{
+			ActionCreate:  {"aws_subnet.a", "aws_subnet.b"},
+			ActionUpdate:  {"aws_route.default"},
+			ActionDelete:  {"aws_eip.old"},
+			ActionReplace: {"aws_instance.api", "aws_instance.web"},
+		}))
+		Expect(summary.HasChanges()).To(BeTrue())
+	})
+
+	It("should treat a plan of no-ops as no changes", func() {
+		summary, err := ParseShowJSON([]byte(`{"resource_changes": [{"address": "a.b", "change": {"actions": ["no-op"]}}]}`))
+		Expect(err).To(BeNil())
+		Expect(summary.HasChanges()).To(BeFalse())
+	})
+
+	It("should fail on invalid JSON", func() {
+		_, err := ParseShowJSON([]byte("Error: no plan"))
+		Expect(err).To(MatchError(ContainSubstring("error parsing plan JSON")))
+	})
+})
+
+var _ = Describe("Report", func() {
+	var report *Aggregate
+
+	BeforeEach(func() {
+		changed, err := ParseShowJSON([]byte(showJSON))
+		Expect(err).To(BeNil())
+
+		report = &Aggregate{}
+		report.Add(ComponentReport{Account: "prod", Component: "aws/prod/network", Summary: changed})
+		report.Add(ComponentReport{Account: "dev", Component: "aws/dev/network", Summary: &Summary{Changes: map[Action][]string{}}})
+	})
+
+	It("should order components by account and component", func() {
+		components := report.Components()
+		Expect(components[0].Component).To(Equal("aws/dev/network"))
+		Expect(components[1].Component).To(Equal("aws/prod/network"))
+	})
+
+	It("should render a table with counts and changed addresses", func() {
+		var out bytes.Buffer
+		Expect(report.Write(&out, FormatTable)).To(Succeed())
+		Expect(out.String()).To(Equal(`ACCOUNT  COMPONENT         CREATE  UPDATE  DELETE  REPLACE  STATUS
+dev      aws/dev/network   0       0       0       0        no changes
+prod     aws/prod/network  2       1       1       2        changes
+
+aws/prod/network:
+  + aws_subnet.a
+  + aws_subnet.b
+  ~ aws_route.default
+  - aws_eip.old
+  -/+ aws_instance.api
+  -/+ aws_instance.web
+
+1 of 2 components have changes, 0 failed
+`))
+	})
+
+	It("should render Markdown for pull request comments", func() {
+		var out bytes.Buffer
+		Expect(report.Write(&out, FormatMarkdown)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring(":warning: 1 of 2 components have changes"))
+		Expect(out.String()).To(ContainSubstring("| prod | `aws/prod/network` | 2 | 1 | 1 | 2 | changes |"))
+		Expect(out.String()).To(ContainSubstring("```diff\n+ aws_subnet.a\n"))
+	})
+
+	It("should render JSON", func() {
+		var out bytes.Buffer
+		Expect(report.Write(&out, FormatJSON)).To(Succeed())
+
+		var decoded struct {
+			NoChanges bool           `json:"no_changes"`
+			Totals    map[string]int `json:"totals"`
+		}
+		Expect(json.Unmarshal(out.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded.NoChanges).To(BeFalse())
+		Expect(decoded.Totals).To(HaveKeyWithValue("replace", 2))
+	})
+
+	It("should flag a report without changes as success", func() {
+		report = &Aggregate{}
+		report.Add(ComponentReport{Component: "aws/dev/network", Summary: &Summary{Changes: map[Action][]string{}}})
+		Expect(report.NoChanges()).To(BeTrue())
+
+		var out bytes.Buffer
+		Expect(report.Write(&out, FormatMarkdown)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring(":white_check_mark: No changes in any of the 1 components"))
+	})
+
+	It("should not flag a report with failed components as success", func() {
+		report = &Aggregate{}
+		report.Add(ComponentReport{Component: "aws/dev/network", Summary: &Summary{Changes: map[Action][]string{}}})
+		report.Add(ComponentReport{Component: "aws/dev/app", Error: "terraform plan failed: exit status 1"})
+		Expect(report.NoChanges()).To(BeFalse())
+
+		var out bytes.Buffer
+		Expect(report.Write(&out, FormatTable)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("aws/dev/app: terraform plan failed: exit status 1"))
+		Expect(out.String()).To(ContainSubstring("0 of 2 components have changes, 1 failed"))
+	})
+
+	It("should not flag a report missing selected components as success", func() {
+		report = &Aggregate{Expected: 3}
+		report.Add(ComponentReport{Component: "aws/dev/network", Summary: &Summary{Changes: map[Action][]string{}}})
+		report.Add(ComponentReport{Component: "aws/dev/app", NotPlanned: true, Error: "not started because aws/dev/network failed"})
+		Expect(report.Components()[0].Status()).To(Equal("not planned"))
+		Expect(report.NoChanges()).To(BeFalse())
+
+		var out bytes.Buffer
+		Expect(report.Write(&out, FormatTable)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("0 of 2 components have changes, 0 failed, 2 not planned"))
+	})
+})
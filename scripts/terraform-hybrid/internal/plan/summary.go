@@ -0,0 +1,90 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Action is the change planned for a resource
+type Action string
+
+const (
+	ActionCreate  Action = "create"
+	ActionUpdate  Action = "update"
+	ActionDelete  Action = "delete"
+	ActionReplace Action = "replace"
+)
+
+// Actions lists the actions in report order
+var Actions = []Action{ActionCreate, ActionUpdate, ActionDelete, ActionReplace}
+
+// showOutput is the part of `terraform show -json <planfile>` the summary needs
+type showOutput struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Change  struct {
+			Actions []string `json:"actions"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// Summary holds the resource addresses changed by the plan of one component, by action
+type Summary struct {
+	Changes map[Action][]string `json:"changes"`
+}
+
+// ParseShowJSON summarizes the output of `terraform show -json <planfile>`.
+// No-op and read actions are not changes.
+func ParseShowJSON(data []byte) (*Summary, error) {
+	var output showOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("error parsing plan JSON: %v", err)
+	}
+
+	summary := &Summary{Changes: map[Action][]string{}}
+	for _, change := range output.ResourceChanges {
+		action, ok := actionOf(change.Change.Actions)
+		if !ok {
+			continue
+		}
+		summary.Changes[action] = append(summary.Changes[action], change.Address)
+	}
+
+	for _, addresses := range summary.Changes {
+		sort.Strings(addresses)
+	}
+	return summary, nil
+}
+
+// actionOf maps the actions of a resource change to a single Action
+func actionOf(actions []string) (Action, bool) {
+	switch {
+	case slices.Equal(actions, []string{"create"}):
+		return ActionCreate, true
+	case slices.Equal(actions, []string{"update"}):
+		return ActionUpdate, true
+	case slices.Equal(actions, []string{"delete"}):
+		return ActionDelete, true
+	case slices.Equal(actions, []string{"delete", "create"}), slices.Equal(actions, []string{"create", "delete"}):
+		return ActionReplace, true
+	default:
+		return "", false
+	}
+}
+
+// Count returns the number of resources planned for an action
+func (s *Summary) Count(action Action) int {
+	return len(s.Changes[action])
+}
+
+// HasChanges reports whether the plan changes any resource
+func (s *Summary) HasChanges() bool {
+	for _, addresses := range s.Changes {
+		if len(addresses) > 0 {
+			return true
+		}
+	}
+	return false
+}
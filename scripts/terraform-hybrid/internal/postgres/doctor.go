@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Check is the outcome of checking one expectation of terraform's pg backend
+type Check struct {
+	Name string
+	// Problem describes what is wrong, empty when the check passed
+	Problem string
+}
+
+// Failed returns the number of failed checks
+func Failed(checks []Check) int {
+	failed := 0
+	for _, check := range checks {
+		if check.Problem != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// expectedColumns are the columns of the states table and their types
+var expectedColumns = []struct {
+	name     string
+	dataType string
+}{
+	{"id", "bigint"},
+	{"name", "text"},
+	{"data", "text"},
+}
+
+// Doctor checks that the database has the schema, sequence, states table and index terraform's pg backend
+// expects and that the connected user may use them, as needed with skip_*_creation = true.
+// The error is only set when the checks themselves fail to run.
+func (s *Schema) Doctor(ctx context.Context) ([]Check, error) {
+	var checks []Check
+
+	var schemas int
+	if err := s.db.QueryRowContext(ctx, "SELECT count(1) FROM information_schema.schemata WHERE schema_name = $1", s.name).Scan(&schemas); err != nil {
+		return nil, fmt.Errorf("error checking schema %s: %v", s.name, err)
+	}
+	schemaCheck := Check{Name: "schema " + s.name + " exists"}
+	if schemas == 0 {
+		schemaCheck.Problem = "run pg bootstrap or create it"
+	}
+	checks = append(checks, schemaCheck)
+
+	var sequence bool
+	if err := s.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", SequenceName).Scan(&sequence); err != nil {
+		return nil, fmt.Errorf("error checking sequence %s: %v", SequenceName, err)
+	}
+	sequenceCheck := Check{Name: "sequence " + SequenceName + " exists"}
+	if !sequence {
+		sequenceCheck.Problem = "the id column of the states table draws from it, run pg bootstrap or create it"
+	}
+	checks = append(checks, sequenceCheck)
+
+	tableCheck, err := s.checkTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	checks = append(checks, tableCheck)
+
+	var indexes int
+	query := "SELECT count(1) FROM pg_indexes WHERE schemaname = $1 AND tablename = $2 AND indexname = $3"
+	if err := s.db.QueryRowContext(ctx, query, s.name, TableName, IndexName).Scan(&indexes); err != nil {
+		return nil, fmt.Errorf("error checking index %s: %v", IndexName, err)
+	}
+	indexCheck := Check{Name: "index " + IndexName + " exists"}
+	if indexes == 0 {
+		indexCheck.Problem = "run pg bootstrap or create a unique index on the name column"
+	}
+	checks = append(checks, indexCheck)
+
+	// Privileges cannot be checked on missing objects
+	if schemaCheck.Problem != "" || sequenceCheck.Problem != "" || tableCheck.Problem != "" {
+		return checks, nil
+	}
+	privileges, err := s.checkPrivileges(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(checks, privileges...), nil
+}
+
+// checkTable checks the columns of the states table
+func (s *Schema) checkTable(ctx context.Context) (Check, error) {
+	check := Check{Name: "table " + s.name + "." + TableName + " has the id, name and data columns"}
+
+	query := "SELECT column_name, data_type, COALESCE(column_default, '') FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2"
+	rows, err := s.db.QueryContext(ctx, query, s.name, TableName)
+	if err != nil {
+		return check, fmt.Errorf("error checking table %s: %v", TableName, err)
+	}
+	defer rows.Close()
+
+	columns := map[string]string{}
+	var idDefault string
+	for rows.Next() {
+		var name, dataType, columnDefault string
+		if err := rows.Scan(&name, &dataType, &columnDefault); err != nil {
+			return check, fmt.Errorf("error checking table %s: %v", TableName, err)
+		}
+		columns[name] = dataType
+		if name == "id" {
+			idDefault = columnDefault
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return check, fmt.Errorf("error checking table %s: %v", TableName, err)
+	}
+
+	if len(columns) == 0 {
+		check.Problem = "the table does not exist, run pg bootstrap or create it"
+		return check, nil
+	}
+
+	var problems []string
+	for _, expected := range expectedColumns {
+		dataType, ok := columns[expected.name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("column %s is missing", expected.name))
+		case dataType != expected.dataType:
+			problems = append(problems, fmt.Sprintf("column %s is %s instead of %s", expected.name, dataType, expected.dataType))
+		}
+	}
+	if _, ok := columns["id"]; ok && !strings.Contains(idDefault, "global_states_id_seq") {
+		problems = append(problems, "column id does not default to nextval('"+SequenceName+"')")
+	}
+	check.Problem = strings.Join(problems, ", ")
+	return check, nil
+}
+
+// checkPrivileges checks that the connected user may read and write states and draw new state IDs
+func (s *Schema) checkPrivileges(ctx context.Context) ([]Check, error) {
+	var usage bool
+	if err := s.db.QueryRowContext(ctx, "SELECT has_schema_privilege($1, 'USAGE')", s.name).Scan(&usage); err != nil {
+		return nil, fmt.Errorf("error checking privileges on schema %s: %v", s.name, err)
+	}
+	schemaCheck := Check{Name: "USAGE privilege on schema " + s.name}
+	if !usage {
+		schemaCheck.Problem = "the connected user cannot use the schema"
+	}
+
+	tablePrivileges := []string{"SELECT", "INSERT", "UPDATE", "DELETE"}
+	granted := make([]bool, len(tablePrivileges))
+	query := "SELECT has_table_privilege($1, 'SELECT'), has_table_privilege($1, 'INSERT'), has_table_privilege($1, 'UPDATE'), has_table_privilege($1, 'DELETE')"
+	if err := s.db.QueryRowContext(ctx, query, s.table()).Scan(&granted[0], &granted[1], &granted[2], &granted[3]); err != nil {
+		return nil, fmt.Errorf("error checking privileges on table %s: %v", TableName, err)
+	}
+	tableCheck := Check{Name: strings.Join(tablePrivileges, ", ") + " privileges on table " + s.name + "." + TableName}
+	var missing []string
+	for i, privilege := range tablePrivileges {
+		if !granted[i] {
+			missing = append(missing, privilege)
+		}
+	}
+	if len(missing) > 0 {
+		tableCheck.Problem = "the connected user lacks " + strings.Join(missing, ", ")
+	}
+
+	var nextval bool
+	query = "SELECT has_sequence_privilege($1, 'USAGE') OR has_sequence_privilege($1, 'UPDATE')"
+	if err := s.db.QueryRowContext(ctx, query, SequenceName).Scan(&nextval); err != nil {
+		return nil, fmt.Errorf("error checking privileges on sequence %s: %v", SequenceName, err)
+	}
+	sequenceCheck := Check{Name: "USAGE privilege on sequence " + SequenceName}
+	if !nextval {
+		sequenceCheck.Problem = "the connected user cannot create workspaces"
+	}
+
+	return []Check{schemaCheck, tableCheck, sequenceCheck}, nil
+}
@@ -0,0 +1,275 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// HistoryTableName is the table keeping every version of the states written to the states table
+	HistoryTableName = "states_history"
+	// historyFunctionName is the trigger function copying written states to the history table
+	historyFunctionName = "record_state_history"
+)
+
+// ErrNoVersion is returned when a workspace has no recorded version matching the request
+var ErrNoVersion = errors.New("no recorded version")
+
+// Version is a recorded version of the state of a workspace
+type Version struct {
+	// ID identifies the version in the history table
+	ID         int64
+	Workspace  string
+	Serial     sql.NullInt64
+	Lineage    string
+	RecordedAt time.Time
+	// Size is the length of the state in bytes
+	Size int
+}
+
+// VersionQuery selects the version of a workspace by serial or by point in time
+type VersionQuery struct {
+	Workspace string
+	// Serial selects the latest version with this serial
+	Serial int64
+	// At selects the version that was current at this time when Serial is not set
+	At time.Time
+}
+
+// String describes the query in messages
+func (vq VersionQuery) String() string {
+	if vq.Serial != 0 {
+		return fmt.Sprintf("serial %d of workspace %s", vq.Serial, vq.Workspace)
+	}
+	if !vq.At.IsZero() {
+		return fmt.Sprintf("workspace %s at %s", vq.Workspace, vq.At.Format(time.RFC3339))
+	}
+	return "latest version of workspace " + vq.Workspace
+}
+
+// historyTable returns the quoted name of the history table
+func (s *Schema) historyTable() string {
+	return pq.QuoteIdentifier(s.name) + "." + HistoryTableName
+}
+
+// historyStatements create the history table and the trigger recording every state written to the states table.
+// The trigger never fails the write of terraform: states that are no JSON are recorded without serial and lineage.
+// Its function runs as the user bootstrapping the history, so that the users of terraform need no privileges
+// on the history table and its sequence; a function created before without SECURITY DEFINER is replaced.
+func (s *Schema) historyStatements() []statement {
+	function := pq.QuoteIdentifier(s.name) + "." + historyFunctionName
+	return []statement{
+		{
+			object: "table " + s.name + "." + HistoryTableName,
+			exists: "SELECT to_regclass($1) IS NOT NULL",
+			name:   s.historyTable(),
+			query: fmt.Sprintf(`CREATE TABLE %s (
+	id bigserial PRIMARY KEY,
+	state_id bigint NOT NULL,
+	name text NOT NULL,
+	serial bigint,
+	lineage text,
+	data text,
+	recorded_at timestamptz NOT NULL DEFAULT now()
+)`, s.historyTable()),
+		},
+		{
+			object: "index states_history_by_name",
+			exists: "SELECT to_regclass($1) IS NOT NULL",
+			name:   pq.QuoteIdentifier(s.name) + ".states_history_by_name",
+			query:  fmt.Sprintf("CREATE INDEX states_history_by_name ON %s (name, recorded_at)", s.historyTable()),
+		},
+		{
+			object: "function " + s.name + "." + historyFunctionName,
+			exists: "SELECT COALESCE((SELECT prosecdef FROM pg_proc WHERE oid = to_regproc($1)), false)",
+			name:   function,
+			query: fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger AS $$
+DECLARE
+	state_serial bigint;
+	state_lineage text;
+BEGIN
+	IF TG_OP = 'UPDATE' AND OLD.data IS NOT DISTINCT FROM NEW.data THEN
+		RETURN NEW;
+	END IF;
+	BEGIN
+		state_serial := (NEW.data::jsonb ->> 'serial')::bigint;
+		state_lineage := NEW.data::jsonb ->> 'lineage';
+	EXCEPTION WHEN others THEN
+		state_serial := NULL;
+		state_lineage := NULL;
+	END;
+	INSERT INTO %s (state_id, name, serial, lineage, data) VALUES (NEW.id, NEW.name, state_serial, state_lineage, NEW.data);
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = %s, pg_temp`, function, s.historyTable(), pq.QuoteIdentifier(s.name)),
+		},
+		{
+			object: "trigger states_history",
+			exists: "SELECT EXISTS (SELECT 1 FROM pg_trigger WHERE tgrelid = to_regclass($1) AND tgname = 'states_history')",
+			name:   s.table(),
+			query:  fmt.Sprintf("CREATE TRIGGER states_history AFTER INSERT OR UPDATE ON %s FOR EACH ROW EXECUTE FUNCTION %s()", s.table(), function),
+		},
+	}
+}
+
+// History returns the recorded versions of a workspace, oldest first
+func (s *Schema) History(ctx context.Context, workspace string) ([]Version, error) {
+	query := fmt.Sprintf(`SELECT id, name, serial, COALESCE(lineage, ''), recorded_at, COALESCE(length(data), 0)
+FROM %s WHERE name = $1 ORDER BY recorded_at, id`, s.historyTable())
+	rows, err := s.db.QueryContext(ctx, query, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("error listing history of workspace %s: %v", workspace, err)
+	}
+	defer rows.Close()
+
+	var versions []Version
+	for rows.Next() {
+		var version Version
+		if err := rows.Scan(&version.ID, &version.Workspace, &version.Serial, &version.Lineage, &version.RecordedAt, &version.Size); err != nil {
+			return nil, fmt.Errorf("error listing history of workspace %s: %v", workspace, err)
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing history of workspace %s: %v", workspace, err)
+	}
+	return versions, nil
+}
+
+// Version returns the recorded version matching the query and its state
+func (s *Schema) Version(ctx context.Context, query VersionQuery) (*Version, []byte, error) {
+	sqlQuery := fmt.Sprintf(`SELECT id, name, serial, COALESCE(lineage, ''), recorded_at, COALESCE(data, '')
+FROM %s WHERE name = $1`, s.historyTable())
+	args := []interface{}{query.Workspace}
+	switch {
+	case query.Serial != 0:
+		sqlQuery += " AND serial = $2"
+		args = append(args, query.Serial)
+	case !query.At.IsZero():
+		sqlQuery += " AND recorded_at <= $2"
+		args = append(args, query.At)
+	}
+	sqlQuery += " ORDER BY recorded_at DESC, id DESC LIMIT 1"
+
+	var version Version
+	var data string
+	err := s.db.QueryRowContext(ctx, sqlQuery, args...).Scan(
+		&version.ID, &version.Workspace, &version.Serial, &version.Lineage, &version.RecordedAt, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("%w for %s", ErrNoVersion, query)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading %s: %v", query, err)
+	}
+	version.Size = len(data)
+	return &version, []byte(data), nil
+}
+
+// Restore makes a recorded version the current state of its workspace while holding the workspace lock.
+// A deleted workspace is created again while holding the creation lock.
+// A deleted workspace is created again.
+func (s *Schema) Restore(ctx context.Context, query VersionQuery, out io.Writer) (*Version, error) {
+	version, data, err := s.Version(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error restoring %s: %v", query, err)
+	}
+	defer conn.Close()
+
+	var (
+		id      int64
+		locked  bool
+		current sql.NullString
+	)
+	err = conn.QueryRowContext(ctx, fmt.Sprintf("SELECT id, pg_try_advisory_lock(id), data FROM %s WHERE name = $1", s.table()), query.Workspace).
+		Scan(&id, &locked, &current)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if err := s.recreate(ctx, query, data); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(out, "Workspace %s did not exist and was created again\n", query.Workspace)
+		return version, nil
+	case err != nil:
+		return nil, fmt.Errorf("error locking workspace %s: %v", query.Workspace, err)
+	case !locked:
+		return nil, fmt.Errorf("workspace %s is locked by a running operation, restore it once the lock is released", query.Workspace)
+	}
+	defer func() { _, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", id) }()
+
+	restored, err := withSerial(data, stateSerial([]byte(current.String)))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET data = $1 WHERE id = $2", s.table()), string(restored), id); err != nil {
+		return nil, fmt.Errorf("error restoring %s: %v", query, err)
+	}
+	return version, nil
+}
+
+// recreate inserts a deleted workspace again while holding the creation lock, the way terraform's
+// pg backend creates workspaces, so that it cannot race a terraform creating the same workspace
+func (s *Schema) recreate(ctx context.Context, query VersionQuery, data []byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error restoring %s: %v", query, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", CreationLockKey); err != nil {
+		return fmt.Errorf("error taking the creation lock: %v", err)
+	}
+	var exists bool
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE name = $1)", s.table()), query.Workspace).Scan(&exists); err != nil {
+		return fmt.Errorf("error restoring %s: %v", query, err)
+	}
+	if exists {
+		return fmt.Errorf("workspace %s was created while restoring it, run the restore again", query.Workspace)
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (name, data) VALUES ($1, $2)", s.table()), query.Workspace, string(data)); err != nil {
+		return fmt.Errorf("error restoring %s: %v", query, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error restoring %s: %v", query, err)
+	}
+	return nil
+}
+
+// stateSerial returns the serial of a state, 0 when it has none
+func stateSerial(state []byte) int64 {
+	var header struct {
+		Serial int64 `json:"serial"`
+	}
+	if err := json.Unmarshal(state, &header); err != nil {
+		return 0
+	}
+	return header.Serial
+}
+
+// withSerial returns the state with the serial following current, unchanged when its serial is already higher
+func withSerial(state []byte, current int64) ([]byte, error) {
+	if stateSerial(state) > current {
+		return state, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(state))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("error parsing recorded state: %v", err)
+	}
+	fields["serial"] = current + 1
+	return json.MarshalIndent(fields, "", "  ")
+}
@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("History", func() {
+	const (
+		versionQuery = `SELECT id, name, serial, COALESCE(lineage, ''), recorded_at, COALESCE(data, '')
+FROM "terraform_remote_state".states_history WHERE name = $1`
+		lockQuery   = `SELECT id, pg_try_advisory_lock(id), data FROM "terraform_remote_state".states WHERE name = $1`
+		existsQuery = `SELECT EXISTS (SELECT 1 FROM "terraform_remote_state".states WHERE name = $1)`
+	)
+
+	var (
+		ctx        context.Context
+		mock       sqlmock.Sqlmock
+		schema     *Schema
+		recordedAt time.Time
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		Expect(err).NotTo(HaveOccurred())
+		mock = sqlMock
+		schema = NewSchema(db, "terraform_remote_state")
+		recordedAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	AfterEach(func() {
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+	})
+
+	// versionRows returns a recorded version with serial 3
+	versionRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "serial", "lineage", "recorded_at", "data"}).
+			AddRow(7, "aws_dev_network", 3, "lineage", recordedAt, `{"version": 4, "serial": 3, "lineage": "lineage"}`)
+	}
+
+	It("should install the history table and trigger with bootstrap", func() {
+		mock.ExpectBegin()
+		for _, statement := range append(schema.schemaStatements(), schema.historyStatements()...) {
+			mock.ExpectQuery(statement.exists).WithArgs(statement.name).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			mock.ExpectExec(statement.query).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectCommit()
+		mock.ExpectQuery(`SELECT has_schema_privilege($1, 'USAGE')`).WillReturnRows(sqlmock.NewRows([]string{"usage"}).AddRow(true))
+		mock.ExpectQuery(`SELECT has_table_privilege($1, 'SELECT'), has_table_privilege($1, 'INSERT'), has_table_privilege($1, 'UPDATE'), has_table_privilege($1, 'DELETE')`).
+			WillReturnRows(sqlmock.NewRows([]string{"select", "insert", "update", "delete"}).AddRow(true, true, true, true))
+		mock.ExpectQuery(`SELECT has_sequence_privilege($1, 'USAGE') OR has_sequence_privilege($1, 'UPDATE')`).
+			WillReturnRows(sqlmock.NewRows([]string{"usage"}).AddRow(true))
+
+		out := &bytes.Buffer{}
+		_, err := schema.Bootstrap(ctx, true, out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.String()).To(HaveSuffix(`Created table terraform_remote_state.states_history
+Created index states_history_by_name
+Created function terraform_remote_state.record_state_history
+Created trigger states_history
+`))
+	})
+
+	It("should record the history as the bootstrapping user", func() {
+		statements := schema.historyStatements()
+		function := statements[2]
+		Expect(function.exists).To(ContainSubstring("prosecdef"))
+		Expect(function.query).To(HavePrefix(`CREATE OR REPLACE FUNCTION "terraform_remote_state".record_state_history()`))
+		Expect(function.query).To(HaveSuffix(`$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = "terraform_remote_state", pg_temp`))
+	})
+
+	It("should list the versions of a workspace", func() {
+		mock.ExpectQuery(`SELECT id, name, serial, COALESCE(lineage, ''), recorded_at, COALESCE(length(data), 0)
+FROM "terraform_remote_state".states_history WHERE name = $1 ORDER BY recorded_at, id`).
+			WithArgs("aws_dev_network").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "serial", "lineage", "recorded_at", "size"}).
+				AddRow(6, "aws_dev_network", nil, "", recordedAt.Add(-time.Hour), 0).
+				AddRow(7, "aws_dev_network", 3, "lineage", recordedAt, 52))
+
+		versions, err := schema.History(ctx, "aws_dev_network")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions).To(HaveLen(2))
+		Expect(versions[0].Serial.Valid).To(BeFalse())
+		Expect(versions[1].Serial.Int64).To(Equal(int64(3)))
+		Expect(versions[1].Size).To(Equal(52))
+	})
+
+	It("should select a version by serial or point in time", func() {
+		mock.ExpectQuery(versionQuery+" AND serial = $2 ORDER BY recorded_at DESC, id DESC LIMIT 1").
+			WithArgs("aws_dev_network", int64(3)).
+			WillReturnRows(versionRows())
+		mock.ExpectQuery(versionQuery+" AND recorded_at <= $2 ORDER BY recorded_at DESC, id DESC LIMIT 1").
+			WithArgs("aws_dev_network", recordedAt).
+			WillReturnRows(versionRows())
+
+		version, state, err := schema.Version(ctx, VersionQuery{Workspace: "aws_dev_network", Serial: 3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version.ID).To(Equal(int64(7)))
+		Expect(string(state)).To(Equal(`{"version": 4, "serial": 3, "lineage": "lineage"}`))
+
+		_, _, err = schema.Version(ctx, VersionQuery{Workspace: "aws_dev_network", At: recordedAt})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should fail for versions that were not recorded", func() {
+		mock.ExpectQuery(versionQuery + " AND serial = $2 ORDER BY recorded_at DESC, id DESC LIMIT 1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "serial", "lineage", "recorded_at", "data"}))
+
+		_, _, err := schema.Version(ctx, VersionQuery{Workspace: "aws_dev_network", Serial: 9})
+		Expect(err).To(MatchError(ErrNoVersion))
+		Expect(err).To(MatchError("no recorded version for serial 9 of workspace aws_dev_network"))
+	})
+
+	Describe("Restore", func() {
+		BeforeEach(func() {
+			mock.ExpectQuery(versionQuery+" AND serial = $2 ORDER BY recorded_at DESC, id DESC LIMIT 1").
+				WithArgs("aws_dev_network", int64(3)).
+				WillReturnRows(versionRows())
+		})
+
+		It("should write the version with the next serial while holding the workspace lock", func() {
+			mock.ExpectQuery(lockQuery).
+				WithArgs("aws_dev_network").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "locked", "data"}).AddRow(42, true, `{"version": 4, "serial": 5}`))
+			mock.ExpectExec(`UPDATE "terraform_remote_state".states SET data = $1 WHERE id = $2`).
+				WithArgs("{\n  \"lineage\": \"lineage\",\n  \"serial\": 6,\n  \"version\": 4\n}", int64(42)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`SELECT pg_advisory_unlock($1)`).WithArgs(int64(42)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			version, err := schema.Restore(ctx, VersionQuery{Workspace: "aws_dev_network", Serial: 3}, &bytes.Buffer{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version.Serial.Int64).To(Equal(int64(3)))
+		})
+
+		It("should refuse to restore a locked workspace", func() {
+			mock.ExpectQuery(lockQuery).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "locked", "data"}).AddRow(42, false, `{"serial": 5}`))
+
+			_, err := schema.Restore(ctx, VersionQuery{Workspace: "aws_dev_network", Serial: 3}, &bytes.Buffer{})
+			Expect(err).To(MatchError("workspace aws_dev_network is locked by a running operation, restore it once the lock is released"))
+		})
+
+		It("should create a deleted workspace again", func() {
+			mock.ExpectQuery(lockQuery).WillReturnRows(sqlmock.NewRows([]string{"id", "locked", "data"}))
+			mock.ExpectBegin()
+			mock.ExpectExec(`SELECT pg_advisory_xact_lock($1)`).WithArgs(CreationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(existsQuery).WithArgs("aws_dev_network").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			mock.ExpectExec(`INSERT INTO "terraform_remote_state".states (name, data) VALUES ($1, $2)`).
+				WithArgs("aws_dev_network", `{"version": 4, "serial": 3, "lineage": "lineage"}`).
+				WillReturnResult(sqlmock.NewResult(43, 1))
+			mock.ExpectCommit()
+
+			out := &bytes.Buffer{}
+			_, err := schema.Restore(ctx, VersionQuery{Workspace: "aws_dev_network", Serial: 3}, out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.String()).To(Equal("Workspace aws_dev_network did not exist and was created again\n"))
+		})
+
+		It("should not create a workspace terraform created while waiting for the creation lock", func() {
+			mock.ExpectQuery(lockQuery).WillReturnRows(sqlmock.NewRows([]string{"id", "locked", "data"}))
+			mock.ExpectBegin()
+			mock.ExpectExec(`SELECT pg_advisory_xact_lock($1)`).WithArgs(CreationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(existsQuery).WithArgs("aws_dev_network").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			mock.ExpectRollback()
+
+			_, err := schema.Restore(ctx, VersionQuery{Workspace: "aws_dev_network", Serial: 3}, &bytes.Buffer{})
+			Expect(err).To(MatchError("workspace aws_dev_network was created while restoring it, run the restore again"))
+		})
+	})
+})
@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// CreationLockKey is the advisory lock terraform's pg backend takes while it creates a workspace
+const CreationLockKey = -1
+
+// Lock is an advisory lock of the pg backend and the database session holding it.
+// Advisory locks belong to their session, so only terminating the session releases them from outside.
+type Lock struct {
+	// Workspace is the locked workspace, empty for the creation lock
+	Workspace string
+	// Key is the lock key, the ID of the workspace in the states table
+	Key             int64
+	PID             int
+	User            string
+	ApplicationName string
+	ClientAddr      string
+	// State is the activity of the session, e.g. idle while terraform plans with the lock held
+	State        string
+	BackendStart sql.NullTime
+	StateChange  sql.NullTime
+}
+
+// Locks returns the advisory locks held on the workspaces of the schema and the creation lock
+func (s *Schema) Locks(ctx context.Context) ([]Lock, error) {
+	query := fmt.Sprintf(`SELECT COALESCE(s.name, ''), l.key, l.pid, COALESCE(a.usename, ''), COALESCE(a.application_name, ''),
+	COALESCE(host(a.client_addr), ''), COALESCE(a.state, ''), a.backend_start, a.state_change
+FROM (
+	SELECT pid, (classid::bigint << 32) | objid::bigint AS key FROM pg_locks
+	WHERE locktype = 'advisory' AND granted AND objsubid = 1
+		AND database = (SELECT oid FROM pg_database WHERE datname = current_database())
+) l
+LEFT JOIN %s s ON s.id = l.key
+LEFT JOIN pg_stat_activity a ON a.pid = l.pid
+WHERE s.id IS NOT NULL OR l.key = %d
+ORDER BY COALESCE(s.name, ''), l.pid`, s.table(), CreationLockKey)
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing locks: %v", err)
+	}
+	defer rows.Close()
+
+	var locks []Lock
+	for rows.Next() {
+		var lock Lock
+		if err := rows.Scan(&lock.Workspace, &lock.Key, &lock.PID, &lock.User, &lock.ApplicationName,
+			&lock.ClientAddr, &lock.State, &lock.BackendStart, &lock.StateChange); err != nil {
+			return nil, fmt.Errorf("error listing locks: %v", err)
+		}
+		locks = append(locks, lock)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing locks: %v", err)
+	}
+	return locks, nil
+}
+
+// String names what the lock protects in messages
+func (l Lock) String() string {
+	if l.Key == CreationLockKey {
+		return "the creation lock"
+	}
+	return "the lock of workspace " + l.Workspace
+}
+
+// WorkspaceLocks returns the locks held on a workspace
+func (s *Schema) WorkspaceLocks(ctx context.Context, workspace string) ([]Lock, error) {
+	held, err := s.heldLocks(ctx, func(lock Lock) bool { return lock.Key != CreationLockKey && lock.Workspace == workspace })
+	if err != nil {
+		return nil, err
+	}
+	if len(held) == 0 {
+		return nil, fmt.Errorf("workspace %s is not locked", workspace)
+	}
+	return held, nil
+}
+
+// CreationLocks returns the creation lock, held while terraform creates a workspace of any schema
+func (s *Schema) CreationLocks(ctx context.Context) ([]Lock, error) {
+	held, err := s.heldLocks(ctx, func(lock Lock) bool { return lock.Key == CreationLockKey })
+	if err != nil {
+		return nil, err
+	}
+	if len(held) == 0 {
+		return nil, fmt.Errorf("the creation lock is not held")
+	}
+	return held, nil
+}
+
+// heldLocks returns the locks matching a filter
+func (s *Schema) heldLocks(ctx context.Context, match func(Lock) bool) ([]Lock, error) {
+	locks, err := s.Locks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var held []Lock
+	for _, lock := range locks {
+		if match(lock) {
+			held = append(held, lock)
+		}
+	}
+	return held, nil
+}
+
+// Terminate ends the session holding a lock, which releases every lock of the session
+// and aborts its running transaction. The session is only terminated while it still holds the lock,
+// so that a PID reused by another session after the lock was listed is left alone.
+func (s *Schema) Terminate(ctx context.Context, lock Lock) error {
+	var terminated bool
+	err := s.db.QueryRowContext(ctx, `SELECT pg_terminate_backend(pid) FROM pg_locks
+WHERE pid = $1 AND locktype = 'advisory' AND granted AND objsubid = 1
+	AND database = (SELECT oid FROM pg_database WHERE datname = current_database())
+	AND ((classid::bigint << 32) | objid::bigint) = $2`, lock.PID, lock.Key).Scan(&terminated)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("backend PID %d no longer holds %s, it may have released it already", lock.PID, lock)
+	}
+	if err != nil {
+		return fmt.Errorf("error terminating backend PID %d: %v", lock.PID, err)
+	}
+	if !terminated {
+		return fmt.Errorf("backend PID %d holding %s was not terminated, it may have ended already", lock.PID, lock)
+	}
+	return nil
+}
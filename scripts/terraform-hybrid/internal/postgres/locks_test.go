@@ -0,0 +1,210 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("Locks", func() {
+	const locksQuery = `SELECT COALESCE(s.name, ''), l.key, l.pid, COALESCE(a.usename, ''), COALESCE(a.application_name, ''),
+	COALESCE(host(a.client_addr), ''), COALESCE(a.state, ''), a.backend_start, a.state_change
+FROM (
+	SELECT pid, (classid::bigint << 32) | objid::bigint AS key FROM pg_locks
+	WHERE locktype = 'advisory' AND granted AND objsubid = 1
+		AND database = (SELECT oid FROM pg_database WHERE datname = current_database())
+) l
+LEFT JOIN "terraform_remote_state".states s ON s.id = l.key
+LEFT JOIN pg_stat_activity a ON a.pid = l.pid
+WHERE s.id IS NOT NULL OR l.key = -1
+ORDER BY COALESCE(s.name, ''), l.pid`
+	const terminateQuery = `SELECT pg_terminate_backend(pid) FROM pg_locks
+WHERE pid = $1 AND locktype = 'advisory' AND granted AND objsubid = 1
+	AND database = (SELECT oid FROM pg_database WHERE datname = current_database())
+	AND ((classid::bigint << 32) | objid::bigint) = $2`
+
+	var (
+		ctx    context.Context
+		mock   sqlmock.Sqlmock
+		schema *Schema
+		since  time.Time
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		Expect(err).NotTo(HaveOccurred())
+		mock = sqlMock
+		schema = NewSchema(db, "terraform_remote_state")
+		since = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+		mock.ExpectQuery(locksQuery).WillReturnRows(sqlmock.NewRows([]string{
+			"name", "key", "pid", "usename", "application_name", "client_addr", "state", "backend_start", "state_change",
+		}).
+			AddRow("", -1, 4711, "ci", "", "10.0.0.7", "idle", since, since).
+			AddRow("aws_dev_network", 3, 4242, "ci", "terraform-hybrid: workspace delete by alice", "10.0.0.8", "idle", since, since.Add(time.Minute)))
+	})
+
+	AfterEach(func() {
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+	})
+
+	It("should map advisory locks to workspaces and their sessions", func() {
+		locks, err := schema.Locks(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locks).To(HaveLen(2))
+		Expect(locks[0].Workspace).To(BeEmpty())
+		Expect(locks[0].Key).To(Equal(int64(CreationLockKey)))
+		Expect(locks[1]).To(MatchFields(IgnoreExtras, Fields{
+			"Workspace":       Equal("aws_dev_network"),
+			"Key":             Equal(int64(3)),
+			"PID":             Equal(4242),
+			"ApplicationName": Equal("terraform-hybrid: workspace delete by alice"),
+			"ClientAddr":      Equal("10.0.0.8"),
+		}))
+	})
+
+	It("should find the locks of a workspace", func() {
+		locks, err := schema.WorkspaceLocks(ctx, "aws_dev_network")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locks).To(HaveLen(1))
+		Expect(locks[0].PID).To(Equal(4242))
+	})
+
+	It("should fail for a workspace that is not locked", func() {
+		_, err := schema.WorkspaceLocks(ctx, "aws_prod_network")
+		Expect(err).To(MatchError("workspace aws_prod_network is not locked"))
+	})
+
+	It("should terminate the session while it holds the lock", func() {
+		locks, err := schema.WorkspaceLocks(ctx, "aws_dev_network")
+		Expect(err).NotTo(HaveOccurred())
+		mock.ExpectQuery(terminateQuery).WithArgs(4242, int64(3)).WillReturnRows(sqlmock.NewRows([]string{"terminated"}).AddRow(true))
+
+		Expect(schema.Terminate(ctx, locks[0])).To(Succeed())
+	})
+
+	It("should leave the PID alone once it no longer holds the lock", func() {
+		locks, err := schema.WorkspaceLocks(ctx, "aws_dev_network")
+		Expect(err).NotTo(HaveOccurred())
+		mock.ExpectQuery(terminateQuery).WithArgs(4242, int64(3)).WillReturnRows(sqlmock.NewRows([]string{"terminated"}))
+
+		Expect(schema.Terminate(ctx, locks[0])).To(MatchError("backend PID 4242 no longer holds the lock of workspace aws_dev_network, it may have released it already"))
+	})
+
+	It("should fail when the session was not terminated", func() {
+		locks, err := schema.WorkspaceLocks(ctx, "aws_dev_network")
+		Expect(err).NotTo(HaveOccurred())
+		mock.ExpectQuery(terminateQuery).WithArgs(4242, int64(3)).WillReturnRows(sqlmock.NewRows([]string{"terminated"}).AddRow(false))
+
+		Expect(schema.Terminate(ctx, locks[0])).To(MatchError(ContainSubstring("backend PID 4242 holding the lock of workspace aws_dev_network was not terminated")))
+	})
+
+	It("should find the creation lock", func() {
+		locks, err := schema.CreationLocks(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locks).To(HaveLen(1))
+		Expect(locks[0].PID).To(Equal(4711))
+		Expect(locks[0].String()).To(Equal("the creation lock"))
+	})
+})
+
+// The locks against a real database, e.g. TF_HYBRID_TEST_POSTGRES=postgres://postgres@localhost/postgres?sslmode=disable
+var _ = Describe("Locks in Postgres", func() {
+	var (
+		ctx    context.Context
+		schema *Schema
+		name   string
+	)
+
+	BeforeEach(func() {
+		connectionString := os.Getenv("TF_HYBRID_TEST_POSTGRES")
+		if connectionString == "" {
+			Skip("TF_HYBRID_TEST_POSTGRES is not set")
+		}
+		ctx = context.Background()
+		name = fmt.Sprintf("terraform_hybrid_test_%d", time.Now().UnixNano())
+		var err error
+		schema, err = Open(connectionString, name)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			_, err := schema.db.ExecContext(ctx, "DROP SCHEMA "+pq.QuoteIdentifier(name)+" CASCADE")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schema.Close()).To(Succeed())
+		})
+		_, err = schema.Bootstrap(ctx, false, io.Discard)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = schema.db.ExecContext(ctx, "INSERT INTO "+schema.table()+" (name, data) VALUES ('network', '{}')")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// session opens a session of its own and returns its PID
+	session := func() (*sql.Conn, int) {
+		conn, err := schema.db.Conn(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() { _ = conn.Close() })
+		var pid int
+		Expect(conn.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&pid)).To(Succeed())
+		return conn, pid
+	}
+
+	// alive reports whether the session of another connection still exists
+	alive := func(pid int) bool {
+		var count int
+		Expect(schema.db.QueryRowContext(ctx, "SELECT count(1) FROM pg_stat_activity WHERE pid = $1", pid).Scan(&count)).To(Succeed())
+		return count == 1
+	}
+
+	It("should terminate the session holding the lock of a workspace", func() {
+		conn, pid := session()
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(id) FROM "+schema.table()+" WHERE name = 'network'")
+		Expect(err).NotTo(HaveOccurred())
+
+		locks, err := schema.WorkspaceLocks(ctx, "network")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locks).To(HaveLen(1))
+		Expect(locks[0].PID).To(Equal(pid))
+
+		Expect(schema.Terminate(ctx, locks[0])).To(Succeed())
+		Eventually(func() bool { return alive(pid) }).Should(BeFalse())
+		_, err = schema.WorkspaceLocks(ctx, "network")
+		Expect(err).To(MatchError("workspace network is not locked"))
+	})
+
+	It("should leave a session alone that does not hold the lock", func() {
+		conn, pid := session()
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(id) FROM "+schema.table()+" WHERE name = 'network'")
+		Expect(err).NotTo(HaveOccurred())
+		locks, err := schema.WorkspaceLocks(ctx, "network")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_unlock_all()")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(schema.Terminate(ctx, locks[0])).To(MatchError(ContainSubstring("no longer holds the lock of workspace network")))
+		Expect(alive(pid)).To(BeTrue())
+	})
+
+	It("should terminate the session holding the creation lock", func() {
+		conn, pid := session()
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("SELECT pg_advisory_lock(%d)", CreationLockKey))
+		Expect(err).NotTo(HaveOccurred())
+
+		locks, err := schema.CreationLocks(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locks).To(HaveLen(1))
+		Expect(locks[0].PID).To(Equal(pid))
+
+		Expect(schema.Terminate(ctx, locks[0])).To(Succeed())
+		Eventually(func() bool { return alive(pid) }).Should(BeFalse())
+	})
+})
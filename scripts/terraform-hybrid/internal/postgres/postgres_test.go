@@ -0,0 +1,186 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPostgres(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Postgres Suite")
+}
+
+var _ = Describe("Schema", func() {
+	var (
+		ctx    context.Context
+		mock   sqlmock.Sqlmock
+		schema *Schema
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		Expect(err).NotTo(HaveOccurred())
+		mock = sqlMock
+		schema = NewSchema(db, "terraform_remote_state")
+	})
+
+	AfterEach(func() {
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+	})
+
+	// expectPrivileges expects the privilege checks with their outcomes
+	expectPrivileges := func(schemaUsage, delete, sequenceUsage bool) {
+		mock.ExpectQuery(`SELECT has_schema_privilege($1, 'USAGE')`).
+			WithArgs("terraform_remote_state").
+			WillReturnRows(sqlmock.NewRows([]string{"usage"}).AddRow(schemaUsage))
+		mock.ExpectQuery(`SELECT has_table_privilege($1, 'SELECT'), has_table_privilege($1, 'INSERT'), has_table_privilege($1, 'UPDATE'), has_table_privilege($1, 'DELETE')`).
+			WithArgs(`"terraform_remote_state".states`).
+			WillReturnRows(sqlmock.NewRows([]string{"select", "insert", "update", "delete"}).AddRow(true, true, true, delete))
+		mock.ExpectQuery(`SELECT has_sequence_privilege($1, 'USAGE') OR has_sequence_privilege($1, 'UPDATE')`).
+			WithArgs(SequenceName).
+			WillReturnRows(sqlmock.NewRows([]string{"usage"}).AddRow(sequenceUsage))
+	}
+
+	Describe("Bootstrap", func() {
+		// expectLookup expects the catalog lookup of an object
+		expectLookup := func(query, name string, exists bool) {
+			mock.ExpectQuery(query).WithArgs(name).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(exists))
+		}
+
+		It("should create the missing objects in a transaction and check the privileges", func() {
+			mock.ExpectBegin()
+			expectLookup(`SELECT to_regnamespace($1) IS NOT NULL`, `"terraform_remote_state"`, false)
+			mock.ExpectExec(`CREATE SCHEMA "terraform_remote_state"`).WillReturnResult(sqlmock.NewResult(0, 0))
+			expectLookup(`SELECT to_regclass($1) IS NOT NULL`, SequenceName, true)
+			expectLookup(`SELECT to_regclass($1) IS NOT NULL`, `"terraform_remote_state".states`, false)
+			mock.ExpectExec(`CREATE TABLE "terraform_remote_state".states (
+	id bigint NOT NULL DEFAULT nextval('public.global_states_id_seq') PRIMARY KEY,
+	name text UNIQUE,
+	data text
+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+			expectLookup(`SELECT to_regclass($1) IS NOT NULL`, `"terraform_remote_state".states_by_name`, false)
+			mock.ExpectExec(`CREATE UNIQUE INDEX states_by_name ON "terraform_remote_state".states (name)`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+			expectPrivileges(true, true, true)
+
+			out := &bytes.Buffer{}
+			checks, err := schema.Bootstrap(ctx, false, out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Failed(checks)).To(BeZero())
+			Expect(out.String()).To(Equal(`Created schema terraform_remote_state
+Found sequence public.global_states_id_seq
+Created table terraform_remote_state.states
+Created index states_by_name
+`))
+		})
+
+		It("should not create anything when the catalog lists every object", func() {
+			mock.ExpectBegin()
+			expectLookup(`SELECT to_regnamespace($1) IS NOT NULL`, `"terraform_remote_state"`, true)
+			expectLookup(`SELECT to_regclass($1) IS NOT NULL`, SequenceName, true)
+			expectLookup(`SELECT to_regclass($1) IS NOT NULL`, `"terraform_remote_state".states`, true)
+			expectLookup(`SELECT to_regclass($1) IS NOT NULL`, `"terraform_remote_state".states_by_name`, true)
+			mock.ExpectCommit()
+			expectPrivileges(true, true, true)
+
+			out := &bytes.Buffer{}
+			_, err := schema.Bootstrap(ctx, false, out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.String()).NotTo(ContainSubstring("Created"))
+		})
+
+		It("should roll back when an object cannot be created", func() {
+			mock.ExpectBegin()
+			expectLookup(`SELECT to_regnamespace($1) IS NOT NULL`, `"terraform_remote_state"`, false)
+			mock.ExpectExec(`CREATE SCHEMA "terraform_remote_state"`).WillReturnError(errPermissionDenied)
+			mock.ExpectRollback()
+
+			_, err := schema.Bootstrap(ctx, false, &bytes.Buffer{})
+			Expect(err).To(MatchError("error creating schema terraform_remote_state: permission denied for database terraform_backend"))
+		})
+	})
+
+	Describe("Doctor", func() {
+		// expectObjects expects the existence checks of the schema, sequence, table columns and index
+		expectObjects := func(schemas int, sequence bool, columns *sqlmock.Rows, indexes int) {
+			mock.ExpectQuery(`SELECT count(1) FROM information_schema.schemata WHERE schema_name = $1`).
+				WithArgs("terraform_remote_state").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(schemas))
+			mock.ExpectQuery(`SELECT to_regclass($1) IS NOT NULL`).
+				WithArgs(SequenceName).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(sequence))
+			mock.ExpectQuery(`SELECT column_name, data_type, COALESCE(column_default, '') FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2`).
+				WithArgs("terraform_remote_state", TableName).
+				WillReturnRows(columns)
+			mock.ExpectQuery(`SELECT count(1) FROM pg_indexes WHERE schemaname = $1 AND tablename = $2 AND indexname = $3`).
+				WithArgs("terraform_remote_state", TableName, IndexName).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(indexes))
+		}
+
+		// terraformColumns are the columns of a states table created by terraform
+		terraformColumns := func() *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"column_name", "data_type", "column_default"}).
+				AddRow("id", "bigint", "nextval('global_states_id_seq'::regclass)").
+				AddRow("name", "text", "").
+				AddRow("data", "text", "")
+		}
+
+		It("should pass for a database bootstrapped like terraform does", func() {
+			expectObjects(1, true, terraformColumns(), 1)
+			expectPrivileges(true, true, true)
+
+			checks, err := schema.Doctor(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checks).To(HaveLen(7))
+			Expect(Failed(checks)).To(BeZero())
+		})
+
+		It("should report the missing sequence of the hand-run table.sql without checking privileges", func() {
+			expectObjects(1, false, sqlmock.NewRows([]string{"column_name", "data_type", "column_default"}), 0)
+
+			checks, err := schema.Doctor(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checks).To(Equal([]Check{
+				{Name: "schema terraform_remote_state exists"},
+				{Name: "sequence public.global_states_id_seq exists", Problem: "the id column of the states table draws from it, run pg bootstrap or create it"},
+				{Name: "table terraform_remote_state.states has the id, name and data columns", Problem: "the table does not exist, run pg bootstrap or create it"},
+				{Name: "index states_by_name exists", Problem: "run pg bootstrap or create a unique index on the name column"},
+			}))
+		})
+
+		It("should report columns that differ from terraform's", func() {
+			expectObjects(1, true, sqlmock.NewRows([]string{"column_name", "data_type", "column_default"}).
+				AddRow("id", "integer", "").
+				AddRow("name", "text", ""), 1)
+
+			checks, err := schema.Doctor(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checks[2].Problem).To(Equal("column id is integer instead of bigint, column data is missing, column id does not default to nextval('public.global_states_id_seq')"))
+		})
+
+		It("should report missing privileges", func() {
+			expectObjects(1, true, terraformColumns(), 1)
+			expectPrivileges(true, false, false)
+
+			checks, err := schema.Doctor(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Failed(checks)).To(Equal(2))
+			Expect(checks[5]).To(Equal(Check{
+				Name:    "SELECT, INSERT, UPDATE, DELETE privileges on table terraform_remote_state.states",
+				Problem: "the connected user lacks DELETE",
+			}))
+			Expect(checks[6].Problem).To(Equal("the connected user cannot create workspaces"))
+		})
+	})
+})
+
+// errPermissionDenied is the error of a user without the CREATE privilege
+var errPermissionDenied = errors.New("permission denied for database terraform_backend")
@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// SequenceName is the sequence terraform's pg backend draws state IDs from, shared by every schema
+	// so that IDs, which are also the advisory lock keys, are unique across the database
+	SequenceName = "public.global_states_id_seq"
+	// TableName is the table holding one state per workspace
+	TableName = "states"
+	// IndexName is the unique index on the workspace names
+	IndexName = "states_by_name"
+)
+
+// Schema is the schema of terraform's pg backend in a database
+type Schema struct {
+	db   *sql.DB
+	name string
+}
+
+// Open connects to the database of the pg backend
+func Open(connectionString, schema string) (*Schema, error) {
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to postgres: %v", err)
+	}
+	return NewSchema(db, schema), nil
+}
+
+// NewSchema creates a Schema using an open database
+func NewSchema(db *sql.DB, name string) *Schema {
+	return &Schema{db: db, name: name}
+}
+
+// Name returns the name of the schema
+func (s *Schema) Name() string {
+	return s.name
+}
+
+// Close closes the database connections
+func (s *Schema) Close() error {
+	return s.db.Close()
+}
+
+// table returns the quoted name of the states table
+func (s *Schema) table() string {
+	return pq.QuoteIdentifier(s.name) + "." + TableName
+}
+
+// statement creates an object of the schema when the catalog does not list it yet
+type statement struct {
+	object string
+	// exists queries the catalog for the object named by name
+	exists string
+	name   string
+	query  string
+}
+
+// schemaStatements create the schema, sequence, states table and index the way terraform's pg backend does
+func (s *Schema) schemaStatements() []statement {
+	return []statement{
+		{
+			object: "schema " + s.name,
+			exists: "SELECT to_regnamespace($1) IS NOT NULL",
+			name:   pq.QuoteIdentifier(s.name),
+			query:  "CREATE SCHEMA " + pq.QuoteIdentifier(s.name),
+		},
+		{
+			object: "sequence " + SequenceName,
+			exists: "SELECT to_regclass($1) IS NOT NULL",
+			name:   SequenceName,
+			query:  "CREATE SEQUENCE " + SequenceName + " AS bigint",
+		},
+		{
+			object: "table " + s.name + "." + TableName,
+			exists: "SELECT to_regclass($1) IS NOT NULL",
+			name:   s.table(),
+			query: fmt.Sprintf(`CREATE TABLE %s (
+	id bigint NOT NULL DEFAULT nextval('%s') PRIMARY KEY,
+	name text UNIQUE,
+	data text
+)`, s.table(), SequenceName),
+		},
+		{
+			object: "index " + IndexName,
+			exists: "SELECT to_regclass($1) IS NOT NULL",
+			name:   pq.QuoteIdentifier(s.name) + "." + IndexName,
+			query:  fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (name)", IndexName, s.table()),
+		},
+	}
+}
+
+// Bootstrap creates the schema, sequence, states table and index the way terraform's pg backend does
+// and then checks the privileges of the connected user on them.
+// Objects the catalog already lists are left untouched, so that a user without the CREATE privilege
+// on the database can bootstrap a schema an administrator created.
+// With history, the history table and the trigger recording every written state are installed as well.
+func (s *Schema) Bootstrap(ctx context.Context, history bool, out io.Writer) ([]Check, error) {
+	statements := s.schemaStatements()
+	if history {
+		statements = append(statements, s.historyStatements()...)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error bootstrapping schema %s: %v", s.name, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, statement := range statements {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, statement.exists, statement.name).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("error looking up %s: %v", statement.object, err)
+		}
+		if exists {
+			fmt.Fprintf(out, "Found %s\n", statement.object)
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, statement.query); err != nil {
+			return nil, fmt.Errorf("error creating %s: %v", statement.object, err)
+		}
+		fmt.Fprintf(out, "Created %s\n", statement.object)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error bootstrapping schema %s: %v", s.name, err)
+	}
+
+	return s.checkPrivileges(ctx)
+}
@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// StoredState is the state of a workspace in the states table
+type StoredState struct {
+	Workspace string
+	Data      string
+	// LastModified is when the state was last recorded in the history table, unknown without one
+	LastModified sql.NullTime
+}
+
+// States returns the state of every workspace in the schema, with the time it was last written
+// when the history table installed by pg bootstrap --history exists
+func (s *Schema) States(ctx context.Context) ([]StoredState, error) {
+	var history bool
+	if err := s.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", s.historyTable()).Scan(&history); err != nil {
+		return nil, fmt.Errorf("error checking history table: %v", err)
+	}
+
+	query := fmt.Sprintf("SELECT s.name, COALESCE(s.data, ''), NULL::timestamptz FROM %s s ORDER BY s.name", s.table())
+	if history {
+		query = fmt.Sprintf(`SELECT s.name, COALESCE(s.data, ''), (SELECT max(h.recorded_at) FROM %s h WHERE h.name = s.name)
+FROM %s s ORDER BY s.name`, s.historyTable(), s.table())
+	}
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing states: %v", err)
+	}
+	defer rows.Close()
+
+	var states []StoredState
+	for rows.Next() {
+		var state StoredState
+		if err := rows.Scan(&state.Workspace, &state.Data, &state.LastModified); err != nil {
+			return nil, fmt.Errorf("error listing states: %v", err)
+		}
+		states = append(states, state)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing states: %v", err)
+	}
+	return states, nil
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("States", func() {
+	var (
+		mock   sqlmock.Sqlmock
+		schema *Schema
+	)
+
+	BeforeEach(func() {
+		db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		Expect(err).NotTo(HaveOccurred())
+		mock = sqlMock
+		schema = NewSchema(db, "terraform_remote_state")
+	})
+
+	AfterEach(func() {
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+	})
+
+	It("should list the states without modification times when there is no history", func() {
+		mock.ExpectQuery(`SELECT to_regclass($1) IS NOT NULL`).WithArgs(`"terraform_remote_state".states_history`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(`SELECT s.name, COALESCE(s.data, ''), NULL::timestamptz FROM "terraform_remote_state".states s ORDER BY s.name`).
+			WillReturnRows(sqlmock.NewRows([]string{"name", "data", "recorded_at"}).AddRow("aws_dev_network", `{"serial": 3}`, nil))
+
+		states, err := schema.States(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(states).To(Equal([]StoredState{{Workspace: "aws_dev_network", Data: `{"serial": 3}`}}))
+	})
+
+	It("should take the modification times from the history", func() {
+		recordedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(`SELECT to_regclass($1) IS NOT NULL`).WithArgs(`"terraform_remote_state".states_history`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(`SELECT s.name, COALESCE(s.data, ''), (SELECT max(h.recorded_at) FROM "terraform_remote_state".states_history h WHERE h.name = s.name)
+FROM "terraform_remote_state".states s ORDER BY s.name`).
+			WillReturnRows(sqlmock.NewRows([]string{"name", "data", "recorded_at"}).AddRow("aws_dev_network", `{"serial": 3}`, recordedAt))
+
+		states, err := schema.States(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(states).To(HaveLen(1))
+		Expect(states[0].LastModified.Valid).To(BeTrue())
+		Expect(states[0].LastModified.Time).To(Equal(recordedAt))
+	})
+})
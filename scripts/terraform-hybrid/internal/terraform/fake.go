@@ -0,0 +1,96 @@
+package terraform
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+)
+
+// FakeResponse is the scripted outcome of a command run by FakeRunner
+type FakeResponse struct {
+	Stdout string
+	Stderr string
+	Err    error
+}
+
+// FakeRunner is a scriptable Runner for tests. It records every command and answers
+// with the response registered for the longest matching argument prefix, preferring
+// responses registered for the directory the command runs in.
+type FakeRunner struct {
+	mu        sync.Mutex
+	responses map[string]FakeResponse
+	calls     []Command
+}
+
+// NewFakeRunner creates a FakeRunner that succeeds without output for unscripted commands
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{responses: map[string]FakeResponse{}}
+}
+
+// On registers the response for commands starting with args
+func (fr *FakeRunner) On(response FakeResponse, args ...string) *FakeRunner {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.responses[strings.Join(args, " ")] = response
+	return fr
+}
+
+// OnIn registers the response for commands starting with args that run in dir
+func (fr *FakeRunner) OnIn(dir string, response FakeResponse, args ...string) *FakeRunner {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.responses[dir+"\x00"+strings.Join(args, " ")] = response
+	return fr
+}
+
+// Calls returns the commands run so far
+func (fr *FakeRunner) Calls() []Command {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	return append([]Command(nil), fr.calls...)
+}
+
+// Args returns the arguments of every command run so far
+func (fr *FakeRunner) Args() [][]string {
+	var args [][]string
+	for _, call := range fr.Calls() {
+		args = append(args, call.Args)
+	}
+	return args
+}
+
+// Run records the command and writes the scripted output
+func (fr *FakeRunner) Run(ctx context.Context, cmd Command) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	fr.mu.Lock()
+	fr.calls = append(fr.calls, cmd)
+	response := fr.match(cmd.Dir, cmd.Args)
+	fr.mu.Unlock()
+
+	if cmd.Stdout != nil {
+		_, _ = io.WriteString(cmd.Stdout, response.Stdout)
+	}
+	if cmd.Stderr != nil {
+		_, _ = io.WriteString(cmd.Stderr, response.Stderr)
+	}
+	return response.Err
+}
+
+// match returns the response registered for the longest prefix of args, in dir or anywhere
+func (fr *FakeRunner) match(dir string, args []string) FakeResponse {
+	for _, prefix := range []string{dir + "\x00", ""} {
+		for n := len(args); n >= 0; n-- {
+			if response, ok := fr.responses[prefix+strings.Join(args[:n], " ")]; ok {
+				return response
+			}
+		}
+	}
+	return FakeResponse{}
+}
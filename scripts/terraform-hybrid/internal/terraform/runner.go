@@ -0,0 +1,108 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BinaryEnvVar is the environment variable choosing the terraform or tofu binary
+const BinaryEnvVar = "TERRAFORM_BINARY"
+
+// DefaultBinary is the binary used when no other binary is chosen
+const DefaultBinary = "terraform"
+
+// InterruptGracePeriod is how long terraform may take to stop after being interrupted
+const InterruptGracePeriod = time.Minute
+
+// Command describes a single terraform invocation
+type Command struct {
+	// Binary is the terraform or tofu binary shown in messages, DefaultBinary when empty
+	Binary string
+	// Args are the terraform arguments, e.g. "workspace", "list"
+	Args []string
+	// Dir is the working directory, the current directory when empty
+	Dir string
+	// Env holds KEY=VALUE pairs added to the environment of the current process
+	Env []string
+	// Stdin, Stdout and Stderr are connected to the process; output is streamed as it is produced
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// String returns the command line of the command
+func (c Command) String() string {
+	binary := DefaultBinary
+	if c.Binary != "" {
+		binary = filepath.Base(c.Binary)
+	}
+	return strings.Join(append([]string{binary}, c.Args...), " ")
+}
+
+// Runner runs terraform commands
+type Runner interface {
+	Run(ctx context.Context, cmd Command) error
+}
+
+// ExecRunner runs commands with a terraform binary
+type ExecRunner struct {
+	Binary string
+}
+
+// NewRunner creates an ExecRunner for the binary chosen by ResolveBinaryName
+func NewRunner(flagBinary, configBinary string) (Runner, error) {
+	binary, err := LookupBinary(flagBinary, configBinary)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecRunner{Binary: binary}, nil
+}
+
+// ResolveBinaryName chooses the binary from, in order of precedence, the command line flag,
+// BinaryEnvVar, the config file and DefaultBinary
+func ResolveBinaryName(flagBinary, configBinary string) string {
+	for _, name := range []string{flagBinary, os.Getenv(BinaryEnvVar), configBinary} {
+		if name != "" {
+			return name
+		}
+	}
+	return DefaultBinary
+}
+
+// LookupBinary returns the path of the binary chosen by ResolveBinaryName
+func LookupBinary(flagBinary, configBinary string) (string, error) {
+	name := ResolveBinaryName(flagBinary, configBinary)
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("terraform binary %q not found, install it or set --binary or %s: %v", name, BinaryEnvVar, err)
+	}
+	return path, nil
+}
+
+// Run runs the command and interrupts it when ctx is cancelled.
+// Terraform receives SIGINT rather than being killed, so it can finish writing state and release locks.
+func (er *ExecRunner) Run(ctx context.Context, command Command) error {
+	command.Binary = er.Binary
+	cmd := exec.CommandContext(ctx, er.Binary, command.Args...)
+	cmd.Dir = command.Dir
+	cmd.Env = append(os.Environ(), command.Env...)
+	cmd.Stdin = command.Stdin
+	cmd.Stdout = command.Stdout
+	cmd.Stderr = command.Stderr
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = InterruptGracePeriod
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error executing %s: %v", command, err)
+	}
+	return nil
+}
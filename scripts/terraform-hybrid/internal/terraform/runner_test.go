@@ -0,0 +1,121 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTerraform(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Terraform Suite")
+}
+
+var _ = Describe("ExecRunner", func() {
+	var binDir string
+
+	// writeBinary creates an executable script acting as the terraform binary
+	writeBinary := func(name, script string) string {
+		path := filepath.Join(binDir, name)
+		Expect(os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		binDir = GinkgoT().TempDir()
+	})
+
+	Describe("LookupBinary", func() {
+		It("should prefer the binary named by TERRAFORM_BINARY", func() {
+			binary := writeBinary("my-terraform", "exit 0\n")
+			GinkgoT().Setenv(BinaryEnvVar, binary)
+
+			path, err := LookupBinary("", "")
+			Expect(err).To(BeNil())
+			Expect(path).To(Equal(binary))
+		})
+
+		It("should look terraform up on PATH", func() {
+			binary := writeBinary("terraform", "exit 0\n")
+			GinkgoT().Setenv(BinaryEnvVar, "")
+			GinkgoT().Setenv("PATH", binDir)
+
+			path, err := LookupBinary("", "")
+			Expect(err).To(BeNil())
+			Expect(path).To(Equal(binary))
+		})
+
+		It("should explain how to configure a missing binary", func() {
+			GinkgoT().Setenv(BinaryEnvVar, filepath.Join(binDir, "missing"))
+
+			_, err := LookupBinary("", "")
+			Expect(err).To(MatchError(ContainSubstring(BinaryEnvVar)))
+		})
+	})
+
+	It("should pass arguments, working directory, environment and stdin", func() {
+		binary := writeBinary("terraform", `echo "args=$*"; echo "dir=$(pwd)"; echo "env=$TF_WORKSPACE"; cat; echo oops >&2`)
+		workDir := GinkgoT().TempDir()
+		var stdout, stderr bytes.Buffer
+
+		runner := &ExecRunner{Binary: binary}
+		err := runner.Run(context.Background(), Command{
+			Args:   []string{"workspace", "show"},
+			Dir:    workDir,
+			Env:    []string{"TF_WORKSPACE=dev"},
+			Stdin:  strings.NewReader("from-stdin\n"),
+			Stdout: &stdout,
+			Stderr: &stderr,
+		})
+		Expect(err).To(BeNil())
+
+		resolvedDir, err := filepath.EvalSymlinks(workDir)
+		Expect(err).To(BeNil())
+		Expect(stdout.String()).To(Equal("args=workspace show\ndir=" + resolvedDir + "\nenv=dev\nfrom-stdin\n"))
+		Expect(stderr.String()).To(Equal("oops\n"))
+	})
+
+	It("should report failing commands", func() {
+		binary := writeBinary("terraform", "exit 3\n")
+
+		err := (&ExecRunner{Binary: binary}).Run(context.Background(), Command{Args: []string{"plan"}})
+		Expect(err).To(MatchError(ContainSubstring("terraform plan")))
+		Expect(err).To(MatchError(ContainSubstring("exit status 3")))
+	})
+
+	It("should name the binary it runs when reporting failing commands", func() {
+		binary := writeBinary("tofu", "exit 1\n")
+
+		err := (&ExecRunner{Binary: binary}).Run(context.Background(), Command{Args: []string{"plan"}})
+		Expect(err).To(MatchError(ContainSubstring("error executing tofu plan")))
+	})
+})
+
+var _ = Describe("Command", func() {
+	It("should show terraform unless another binary is set", func() {
+		Expect(Command{Args: []string{"plan"}}.String()).To(Equal("terraform plan"))
+		Expect(Command{Binary: "/usr/local/bin/tofu", Args: []string{"plan"}}.String()).To(Equal("tofu plan"))
+	})
+})
+
+var _ = Describe("FakeRunner", func() {
+	It("should answer with the response of the longest matching prefix", func() {
+		runner := NewFakeRunner().
+			On(FakeResponse{Stdout: "workspace"}, "workspace").
+			On(FakeResponse{Stdout: "list"}, "workspace", "list")
+
+		var stdout bytes.Buffer
+		Expect(runner.Run(context.Background(), Command{Args: []string{"workspace", "list"}, Stdout: &stdout})).To(Succeed())
+		Expect(runner.Run(context.Background(), Command{Args: []string{"workspace", "show"}, Stdout: &stdout})).To(Succeed())
+		Expect(runner.Run(context.Background(), Command{Args: []string{"plan"}, Stdout: &stdout})).To(Succeed())
+
+		Expect(stdout.String()).To(Equal("listworkspace"))
+		Expect(runner.Args()).To(HaveLen(3))
+	})
+})
@@ -0,0 +1,170 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Flavor is the distribution of the terraform binary
+type Flavor string
+
+const (
+	FlavorTerraform Flavor = "terraform"
+	FlavorOpenTofu  Flavor = "tofu"
+)
+
+// String returns the display name of the flavor
+func (f Flavor) String() string {
+	if f == FlavorOpenTofu {
+		return "OpenTofu"
+	}
+	return "Terraform"
+}
+
+// Version is a semantic version of terraform or OpenTofu
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// versionPattern matches versions such as "1.8.0", "v1.10.0-beta1"
+var versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion parses a version such as "1.8.0" or "v1.10.0-rc1"
+func ParseVersion(version string) (Version, error) {
+	matches := versionPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if matches == nil {
+		return Version{}, fmt.Errorf("invalid version %q", version)
+	}
+
+	var v Version
+	v.Major, _ = strconv.Atoi(matches[1])
+	v.Minor, _ = strconv.Atoi(matches[2])
+	if matches[3] != "" {
+		v.Patch, _ = strconv.Atoi(matches[3])
+	}
+	return v, nil
+}
+
+// String returns the version as major.minor.patch
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether the version is at least major.minor
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// Tool describes the terraform or OpenTofu binary the generated configuration targets
+type Tool struct {
+	Flavor Flavor
+	Binary string
+	// Version is nil when it is neither configured nor detectable
+	Version *Version
+}
+
+// String describes the tool, e.g. "OpenTofu 1.8.0"
+func (t *Tool) String() string {
+	if t == nil {
+		return fmt.Sprintf("%s (unknown version)", FlavorTerraform)
+	}
+	if t.Version == nil {
+		return fmt.Sprintf("%s (unknown version)", t.Flavor)
+	}
+	return fmt.Sprintf("%s %s", t.Flavor, t.Version)
+}
+
+// IsOpenTofu reports whether the tool is OpenTofu
+func (t *Tool) IsOpenTofu() bool {
+	return t != nil && t.Flavor == FlavorOpenTofu
+}
+
+// HasVersion reports whether the version of the tool is known
+func (t *Tool) HasVersion() bool {
+	return t != nil && t.Version != nil
+}
+
+// SupportsStateEncryption reports whether the tool supports the encryption block (OpenTofu 1.7+).
+// An unknown version is not supported.
+func (t *Tool) SupportsStateEncryption() bool {
+	return t.IsOpenTofu() && t.HasVersion() && t.Version.AtLeast(1, 7)
+}
+
+// SupportsS3Lockfile reports whether the s3 backend supports use_lockfile
+// (OpenTofu 1.8+, Terraform 1.10+). An unknown version is not supported.
+func (t *Tool) SupportsS3Lockfile() bool {
+	if !t.HasVersion() {
+		return false
+	}
+	if t.IsOpenTofu() {
+		return t.Version.AtLeast(1, 8)
+	}
+	return t.Version.AtLeast(1, 10)
+}
+
+// FlavorOf guesses the flavor from a binary name or path such as "/usr/local/bin/tofu"
+func FlavorOf(binary string) Flavor {
+	if strings.HasPrefix(filepath.Base(binary), string(FlavorOpenTofu)) {
+		return FlavorOpenTofu
+	}
+	return FlavorTerraform
+}
+
+// versionOutputPattern matches the first line of `terraform version` and `tofu version`
+var versionOutputPattern = regexp.MustCompile(`(?m)^(Terraform|OpenTofu) (v\S+)`)
+
+// DetectTool runs `version` with the runner and reports the flavor and version of the binary
+func DetectTool(ctx context.Context, runner Runner, binary string) (*Tool, error) {
+	var stdout bytes.Buffer
+	if err := runner.Run(ctx, Command{Args: []string{"version"}, Stdout: &stdout}); err != nil {
+		return nil, fmt.Errorf("error detecting version of %s: %v", binary, err)
+	}
+
+	matches := versionOutputPattern.FindStringSubmatch(stdout.String())
+	if matches == nil {
+		return nil, fmt.Errorf("unrecognized version output of %s: %q", binary, strings.TrimSpace(stdout.String()))
+	}
+
+	version, err := ParseVersion(matches[2])
+	if err != nil {
+		return nil, err
+	}
+
+	flavor := FlavorTerraform
+	if matches[1] == "OpenTofu" {
+		flavor = FlavorOpenTofu
+	}
+	return &Tool{Flavor: flavor, Binary: binary, Version: &version}, nil
+}
+
+// ResolveTool determines the tool to generate configuration for.
+// The binary is chosen as described by ResolveBinaryName. A configured version is trusted as is,
+// otherwise the version is detected from the installed binary; when the binary is not
+// installed the version is left unknown.
+func ResolveTool(ctx context.Context, flagBinary, configBinary, configVersion string) (*Tool, error) {
+	name := ResolveBinaryName(flagBinary, configBinary)
+	tool := &Tool{Flavor: FlavorOf(name), Binary: name}
+
+	if configVersion != "" {
+		version, err := ParseVersion(configVersion)
+		if err != nil {
+			return nil, err
+		}
+		tool.Version = &version
+		return tool, nil
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return tool, nil
+	}
+	return DetectTool(ctx, &ExecRunner{Binary: path}, path)
+}
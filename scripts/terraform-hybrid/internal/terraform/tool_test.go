@@ -0,0 +1,104 @@
+package terraform
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tool", func() {
+	version := func(v string) *Version {
+		parsed, err := ParseVersion(v)
+		Expect(err).To(BeNil())
+		return &parsed
+	}
+
+	DescribeTable("ParseVersion",
+		func(input string, expected Version) {
+			Expect(ParseVersion(input)).To(Equal(expected))
+		},
+		Entry("plain version", "1.8.2", Version{Major: 1, Minor: 8, Patch: 2}),
+		Entry("v prefix", "v1.10.0", Version{Major: 1, Minor: 10}),
+		Entry("prerelease suffix", "1.9.0-beta1", Version{Major: 1, Minor: 9}),
+	)
+
+	It("should reject malformed versions", func() {
+		_, err := ParseVersion("latest")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should guess the flavor from the binary name", func() {
+		Expect(FlavorOf("/usr/local/bin/tofu")).To(Equal(FlavorOpenTofu))
+		Expect(FlavorOf("terraform")).To(Equal(FlavorTerraform))
+	})
+
+	DescribeTable("feature support",
+		func(tool *Tool, encryption, lockfile bool) {
+			Expect(tool.SupportsStateEncryption()).To(Equal(encryption))
+			Expect(tool.SupportsS3Lockfile()).To(Equal(lockfile))
+		},
+		Entry("unknown tool", nil, false, false),
+		Entry("OpenTofu 1.6", &Tool{Flavor: FlavorOpenTofu, Version: version("1.6.2")}, false, false),
+		Entry("OpenTofu 1.7", &Tool{Flavor: FlavorOpenTofu, Version: version("1.7.0")}, true, false),
+		Entry("OpenTofu 1.8", &Tool{Flavor: FlavorOpenTofu, Version: version("1.8.0")}, true, true),
+		Entry("OpenTofu of unknown version", &Tool{Flavor: FlavorOpenTofu}, false, false),
+		Entry("Terraform 1.9", &Tool{Flavor: FlavorTerraform, Version: version("1.9.8")}, false, false),
+		Entry("Terraform 1.10", &Tool{Flavor: FlavorTerraform, Version: version("1.10.0")}, false, true),
+	)
+
+	Describe("DetectTool", func() {
+		It("should detect OpenTofu from its version output", func() {
+			runner := NewFakeRunner()
+			runner.On(FakeResponse{Stdout: "OpenTofu v1.8.3\non linux_amd64\n"}, "version")
+
+			tool, err := DetectTool(context.Background(), runner, "tofu")
+			Expect(err).To(BeNil())
+			Expect(tool.IsOpenTofu()).To(BeTrue())
+			Expect(tool.String()).To(Equal("OpenTofu 1.8.3"))
+		})
+
+		It("should detect Terraform from its version output", func() {
+			runner := NewFakeRunner()
+			runner.On(FakeResponse{Stdout: "Terraform v1.5.7\non darwin_arm64\n"}, "version")
+
+			tool, err := DetectTool(context.Background(), runner, "terraform")
+			Expect(err).To(BeNil())
+			Expect(tool.Flavor).To(Equal(FlavorTerraform))
+			Expect(tool.Version).To(Equal(version("1.5.7")))
+		})
+
+		It("should fail on unrecognized output", func() {
+			runner := NewFakeRunner()
+			runner.On(FakeResponse{Stdout: "something else\n"}, "version")
+
+			_, err := DetectTool(context.Background(), runner, "terraform")
+			Expect(err).To(MatchError(ContainSubstring("unrecognized version output")))
+		})
+
+		It("should fail when the binary fails", func() {
+			runner := NewFakeRunner()
+			runner.On(FakeResponse{Err: errors.New("exit status 1")}, "version")
+
+			_, err := DetectTool(context.Background(), runner, "terraform")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ResolveTool", func() {
+		It("should trust the configured version", func() {
+			GinkgoT().Setenv(BinaryEnvVar, "")
+			tool, err := ResolveTool(context.Background(), "", "tofu", "1.7.1")
+			Expect(err).To(BeNil())
+			Expect(tool.String()).To(Equal("OpenTofu 1.7.1"))
+		})
+
+		It("should leave the version unknown when the binary is not installed", func() {
+			tool, err := ResolveTool(context.Background(), "tofu-does-not-exist", "", "")
+			Expect(err).To(BeNil())
+			Expect(tool.IsOpenTofu()).To(BeTrue())
+			Expect(tool.Version).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it into place,
+// so readers and interrupted runs only ever see the old or the new content.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file for %s: %v", path, err)
+	}
+	tmpName := tmp.Name()
+
+	// Remove the temporary file unless it was renamed into place
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = os.Remove(tmpName)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing temporary file %s: %v", tmpName, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error syncing temporary file %s: %v", tmpName, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing temporary file %s: %v", tmpName, err)
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return fmt.Errorf("error setting permissions on %s: %v", tmpName, err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("error renaming %s to %s: %v", tmpName, path, err)
+	}
+
+	renamed = true
+	return nil
+}
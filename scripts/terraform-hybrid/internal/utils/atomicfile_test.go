@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WriteFileAtomic", func() {
+	It("should replace the file and leave no temporary files behind", func() {
+		dir := GinkgoT().TempDir()
+		path := filepath.Join(dir, "backend.tf")
+		Expect(os.WriteFile(path, []byte("old"), 0600)).To(Succeed())
+
+		Expect(WriteFileAtomic(path, []byte("new"), 0644)).To(Succeed())
+
+		content, err := os.ReadFile(path)
+		Expect(err).To(BeNil())
+		Expect(string(content)).To(Equal("new"))
+
+		info, err := os.Stat(path)
+		Expect(err).To(BeNil())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+
+		entries, err := os.ReadDir(dir)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(1))
+	})
+})
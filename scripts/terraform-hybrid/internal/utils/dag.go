@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Graph is a directed graph of folders and the folders they depend on
+type Graph struct {
+	nodes        map[string]bool
+	dependencies map[string]map[string]bool
+}
+
+// NewGraph creates an empty Graph
+func NewGraph() *Graph {
+	return &Graph{nodes: map[string]bool{}, dependencies: map[string]map[string]bool{}}
+}
+
+// AddNode adds a node without dependencies
+func (g *Graph) AddNode(node string) {
+	g.nodes[node] = true
+}
+
+// AddDependency records that node depends on dependency, adding both nodes
+func (g *Graph) AddDependency(node, dependency string) {
+	g.AddNode(node)
+	g.AddNode(dependency)
+	if g.dependencies[node] == nil {
+		g.dependencies[node] = map[string]bool{}
+	}
+	g.dependencies[node][dependency] = true
+}
+
+// Nodes returns every node in sorted order
+func (g *Graph) Nodes() []string {
+	return sortedKeys(g.nodes)
+}
+
+// Dependencies returns the nodes a node directly depends on in sorted order
+func (g *Graph) Dependencies(node string) []string {
+	return sortedKeys(g.dependencies[node])
+}
+
+// Dependents returns the nodes directly depending on a node in sorted order
+func (g *Graph) Dependents(node string) []string {
+	var dependents []string
+	for _, other := range g.Nodes() {
+		if g.dependencies[other][node] {
+			dependents = append(dependents, other)
+		}
+	}
+	return dependents
+}
+
+// Reachable returns every node a node depends on, directly or not.
+// With reverse it returns every node depending on the node instead.
+func (g *Graph) Reachable(node string, reverse bool) map[string]bool {
+	next := g.Dependencies
+	if reverse {
+		next = g.Dependents
+	}
+
+	reachable := map[string]bool{}
+	stack := next(node)
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reachable[current] {
+			continue
+		}
+		reachable[current] = true
+		stack = append(stack, next(current)...)
+	}
+	return reachable
+}
+
+// CycleError reports nodes depending on each other
+type CycleError struct {
+	Cycle []string
+}
+
+// Error lists the nodes of the cycle, ending with the node it started at
+func (ce *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(append(ce.Cycle, ce.Cycle[0]), " -> "))
+}
+
+// Levels groups the nodes so that every node comes after all its dependencies.
+// Nodes of the same level do not depend on each other and are sorted.
+// It returns a *CycleError when the nodes cannot be ordered.
+func (g *Graph) Levels() ([][]string, error) {
+	remaining := map[string]int{}
+	for node := range g.nodes {
+		remaining[node] = len(g.dependencies[node])
+	}
+
+	var levels [][]string
+	for len(remaining) > 0 {
+		var level []string
+		for node, count := range remaining {
+			if count == 0 {
+				level = append(level, node)
+			}
+		}
+		if len(level) == 0 {
+			return nil, &CycleError{Cycle: g.findCycle(remaining)}
+		}
+
+		sort.Strings(level)
+		for _, node := range level {
+			delete(remaining, node)
+			for _, dependent := range g.Dependents(node) {
+				remaining[dependent]--
+			}
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// findCycle follows dependencies among the unordered nodes until a node repeats
+func (g *Graph) findCycle(remaining map[string]int) []string {
+	node := sortedKeys(remaining)[0]
+	var path []string
+	seen := map[string]int{}
+	for {
+		if index, ok := seen[node]; ok {
+			return path[index:]
+		}
+		seen[node] = len(path)
+		path = append(path, node)
+		for _, dependency := range g.Dependencies(node) {
+			if _, ok := remaining[dependency]; ok {
+				node = dependency
+				break
+			}
+		}
+	}
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
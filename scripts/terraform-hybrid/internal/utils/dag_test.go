@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Graph", func() {
+	var graph *Graph
+
+	BeforeEach(func() {
+		// network <- database <- app, network <- app, dns stands alone
+		graph = NewGraph()
+		graph.AddNode("dns")
+		graph.AddDependency("database", "network")
+		graph.AddDependency("app", "database")
+		graph.AddDependency("app", "network")
+	})
+
+	It("should order nodes after their dependencies", func() {
+		levels, err := graph.Levels()
+		Expect(err).To(BeNil())
+		Expect(levels).To(Equal([][]string{{"dns", "network"}, {"database"}, {"app"}}))
+	})
+
+	It("should report cycles", func() {
+		graph.AddDependency("network", "app")
+		_, err := graph.Levels()
+
+		var cycleErr *CycleError
+		Expect(errors.As(err, &cycleErr)).To(BeTrue())
+		Expect(err.Error()).To(Equal("dependency cycle: app -> database -> network -> app"))
+	})
+
+	It("should find transitive dependencies and dependents", func() {
+		Expect(graph.Reachable("app", false)).To(Equal(map[string]bool{"database": true, "network": true}))
+		Expect(graph.Reachable("network", true)).To(Equal(map[string]bool{"database": true, "app": true}))
+		Expect(graph.Reachable("dns", false)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("ProcessFoldersInOrder", func() {
+	var (
+		graph *Graph
+		mu    sync.Mutex
+		order []string
+	)
+
+	record := func(fail ...string) FolderTask {
+		return func(_ context.Context, folder string, out io.Writer) error {
+			mu.Lock()
+			order = append(order, folder)
+			mu.Unlock()
+			fmt.Fprintf(out, "ran %s\n", folder)
+			for _, failing := range fail {
+				if folder == failing {
+					return errors.New("boom")
+				}
+			}
+			return nil
+		}
+	}
+
+	BeforeEach(func() {
+		order = nil
+		graph = NewGraph()
+		graph.AddDependency("database", "network")
+		graph.AddDependency("app", "database")
+		graph.AddNode("dns")
+	})
+
+	It("should run folders after their dependencies", func() {
+		err := ProcessFoldersInOrder(context.Background(), graph, graph.Nodes(), false, 4, io.Discard, record())
+		Expect(err).To(BeNil())
+		Expect(order).To(HaveLen(4))
+		Expect(order[2:]).To(Equal([]string{"database", "app"}))
+	})
+
+	It("should run folders before their dependencies in reverse", func() {
+		err := ProcessFoldersInOrder(context.Background(), graph, graph.Nodes(), true, 1, io.Discard, record())
+		Expect(err).To(BeNil())
+		Expect(order).To(Equal([]string{"app", "database", "dns", "network"}))
+	})
+
+	It("should not start folders depending on a failed folder, even through unselected folders", func() {
+		var out bytes.Buffer
+		err := ProcessFoldersInOrder(context.Background(), graph, []string{"app", "dns", "network"}, false, 1, &out, record("network"))
+
+		var folderErrors *FolderErrors
+		Expect(errors.As(err, &folderErrors)).To(BeTrue())
+		Expect(folderErrors.Total).To(Equal(3))
+		Expect(folderErrors.Errors).To(HaveLen(2))
+		Expect(folderErrors.Errors[1].Error()).To(Equal("app: not started because network failed"))
+		Expect(order).To(Equal([]string{"dns", "network"}))
+		Expect(out.String()).To(ContainSubstring("Skipping folder app: network failed"))
+	})
+
+	It("should refuse to run a cyclic graph", func() {
+		graph.AddDependency("network", "app")
+		err := ProcessFoldersInOrder(context.Background(), graph, graph.Nodes(), false, 1, io.Discard, record())
+		Expect(err).To(MatchError(ContainSubstring("dependency cycle")))
+		Expect(order).To(BeEmpty())
+	})
+})
+
+var _ = Describe("InspectModule remote states", func() {
+	It("should read the literal attributes of terraform_remote_state data sources", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`
+data "terraform_remote_state" "network" {
+  backend = "s3"
+  config = {
+    bucket = "state"
+    key    = "aws/accounts/prod/component/network/terraform.tfstate"
+    region = var.region
+  }
+}
+
+data "terraform_remote_state" "dns" {
+  backend   = "pg"
+  workspace = "aws_accounts_prod_component_dns"
+  config    = local.pg_config
+}
+
+data "aws_caller_identity" "current" {}
+`), 0644)).To(Succeed())
+
+		info, err := InspectModule(dir)
+		Expect(err).To(BeNil())
+		Expect(info.RemoteStates).To(HaveLen(2))
+
+		network := info.RemoteStates[0]
+		Expect(network.Name).To(Equal("network"))
+		Expect(network.Backend).To(Equal("s3"))
+		Expect(network.Config).To(Equal(map[string]string{
+			"bucket": "state",
+			"key":    "aws/accounts/prod/component/network/terraform.tfstate",
+		}))
+		Expect(network.Dynamic).To(Equal([]string{"config.region"}))
+
+		dns := info.RemoteStates[1]
+		Expect(dns.Workspace).To(Equal("aws_accounts_prod_component_dns"))
+		Expect(dns.Dynamic).To(Equal([]string{"config"}))
+	})
+})
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// FolderFilter narrows discovered root modules down to a subset, e.g. for a staged migration
+type FolderFilter struct {
+	// Accounts keeps only folders whose {account} segment is one of these
+	Accounts []string
+	// Include keeps only folders whose path relative to the layout root matches one of these globs
+	Include []string
+	// Exclude drops folders whose path relative to the layout root matches one of these globs
+	Exclude []string
+	// ChangedSince keeps only folders with files changed since this git ref
+	ChangedSince string
+}
+
+// IsEmpty reports whether the filter keeps every folder
+func (ff *FolderFilter) IsEmpty() bool {
+	return len(ff.Accounts) == 0 && len(ff.Include) == 0 && len(ff.Exclude) == 0 && ff.ChangedSince == ""
+}
+
+// Validate checks the globs and that accounts can be matched with the layout
+func (ff *FolderFilter) Validate(layout *Layout) error {
+	if len(ff.Accounts) > 0 && !layout.HasPlaceholder("account") {
+		return fmt.Errorf("layout path template %s has no {account} placeholder to filter accounts by", layout.Template)
+	}
+
+	for _, pattern := range append(slices.Clone(ff.Include), ff.Exclude...) {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("invalid glob %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Apply returns the folders kept by the filter and a decision for every folder it dropped
+func (ff *FolderFilter) Apply(ctx context.Context, layout *Layout, rootPath string, folders []string) ([]string, []FolderDecision, error) {
+	if ff.IsEmpty() {
+		return folders, nil, nil
+	}
+
+	if err := ff.Validate(layout); err != nil {
+		return nil, nil, err
+	}
+
+	var changedFiles []string
+	if ff.ChangedSince != "" {
+		var err error
+		changedFiles, err = GitChangedFiles(ctx, rootPath, ff.ChangedSince)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var selected []string
+	var skipped []FolderDecision
+	for _, folder := range folders {
+		reason, err := ff.skipReason(layout, rootPath, folder, changedFiles)
+		if err != nil {
+			return nil, nil, err
+		}
+		if reason != "" {
+			skipped = append(skipped, FolderDecision{Path: folder, Reason: reason})
+			continue
+		}
+		selected = append(selected, folder)
+	}
+
+	return selected, skipped, nil
+}
+
+// skipReason returns why the filter drops a folder, or an empty string when it is kept
+func (ff *FolderFilter) skipReason(layout *Layout, rootPath, folder string, changedFiles []string) (string, error) {
+	relativePath, err := filepath.Rel(rootPath, folder)
+	if err != nil {
+		return "", fmt.Errorf("error calculating relative path of %s: %v", folder, err)
+	}
+	slashPath := filepath.ToSlash(relativePath)
+
+	if len(ff.Accounts) > 0 {
+		values, _ := layout.Match(relativePath)
+		if !slices.Contains(ff.Accounts, values["account"]) {
+			return fmt.Sprintf("account is not one of %s", strings.Join(ff.Accounts, ", ")), nil
+		}
+	}
+
+	if len(ff.Include) > 0 && !matchesAny(ff.Include, slashPath) {
+		return "does not match any --include glob", nil
+	}
+
+	if matchesAny(ff.Exclude, slashPath) {
+		return "matches an --exclude glob", nil
+	}
+
+	if ff.ChangedSince != "" {
+		dirs, err := sourceDirs(folder)
+		if err != nil {
+			return "", err
+		}
+		if !containsChangedFile(dirs, changedFiles) {
+			return fmt.Sprintf("has no changes since %s", ff.ChangedSince), nil
+		}
+	}
+
+	return "", nil
+}
+
+// matchesAny reports whether a slash-separated path matches one of the globs
+func matchesAny(patterns []string, slashPath string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := doublestar.Match(pattern, slashPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceDirs returns the folder and the local module sources it uses, directly or through other local
+// modules, as absolute paths with symlinks resolved the way git reports them
+func sourceDirs(folder string) ([]string, error) {
+	var dirs []string
+	seen := map[string]bool{}
+	queue := []string{folder}
+	for len(queue) > 0 {
+		dir, err := filepath.Abs(queue[0])
+		queue = queue[1:]
+		if err != nil {
+			return nil, fmt.Errorf("could not determine absolute path: %v", err)
+		}
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		// A module source that no longer exists was deleted, which is a change of the folder too
+		if _, err := os.Stat(dir); err != nil {
+			dirs = append(dirs, dir)
+			continue
+		}
+		info, err := InspectModule(dir)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, info.LocalModuleSources...)
+
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// containsChangedFile reports whether any changed file lives in one of the folders or below it
+func containsChangedFile(dirs []string, changedFiles []string) bool {
+	for _, file := range changedFiles {
+		for _, dir := range dirs {
+			if relativePath, err := filepath.Rel(dir, file); err == nil && relativePath != ".." &&
+				!strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GitChangedFiles returns the absolute paths of files changed since ref in the repository containing dir,
+// including uncommitted and untracked files
+func GitChangedFiles(ctx context.Context, dir, ref string) ([]string, error) {
+	topLevel, err := runGit(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	topLevel = strings.TrimSpace(topLevel)
+
+	changed, err := runGit(ctx, topLevel, "diff", "--name-only", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := runGit(ctx, topLevel, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, line := range strings.Split(changed+"\n"+untracked, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, filepath.Join(topLevel, filepath.FromSlash(line)))
+		}
+	}
+	return files, nil
+}
+
+// runGit runs a git command in dir and returns its standard output
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("error running git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("error running git %s: %v", strings.Join(args, " "), err)
+	}
+	return string(output), nil
+}
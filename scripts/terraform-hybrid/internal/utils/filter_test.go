@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FolderFilter", func() {
+	var (
+		root    string
+		layout  *Layout
+		folders []string
+	)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", root}, args...)...)
+		output, err := cmd.CombinedOutput()
+		Expect(err).To(BeNil(), string(output))
+	}
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+
+		var err error
+		layout, err = NewLayout("deploy/provider", "{provider}/accounts/{account}/component/{stack}", nil)
+		Expect(err).To(BeNil())
+
+		folders = nil
+		for _, relativePath := range []string{
+			"aws/accounts/prod/component/vpc",
+			"aws/accounts/prod/component/dns",
+			"aws/accounts/dev/component/vpc",
+		} {
+			folder := filepath.Join(root, relativePath)
+			Expect(os.MkdirAll(folder, 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(folder, "main.tf"), []byte("# "+relativePath), 0644)).To(Succeed())
+			folders = append(folders, folder)
+		}
+	})
+
+	It("should keep every folder when empty", func() {
+		filter := FolderFilter{}
+		selected, skipped, err := filter.Apply(context.Background(), layout, root, folders)
+		Expect(err).To(BeNil())
+		Expect(selected).To(Equal(folders))
+		Expect(skipped).To(BeEmpty())
+	})
+
+	DescribeTable("should select folders",
+		func(filter FolderFilter, expected ...string) {
+			selected, skipped, err := filter.Apply(context.Background(), layout, root, folders)
+			Expect(err).To(BeNil())
+
+			var expectedFolders []string
+			for _, relativePath := range expected {
+				expectedFolders = append(expectedFolders, filepath.Join(root, relativePath))
+			}
+			Expect(selected).To(ConsistOf(expectedFolders))
+			Expect(skipped).To(HaveLen(len(folders) - len(expected)))
+		},
+		Entry("by account", FolderFilter{Accounts: []string{"dev"}}, "aws/accounts/dev/component/vpc"),
+		Entry("by include glob", FolderFilter{Include: []string{"**/vpc"}},
+			"aws/accounts/prod/component/vpc", "aws/accounts/dev/component/vpc"),
+		Entry("by exclude glob", FolderFilter{Exclude: []string{"aws/accounts/prod/**"}}, "aws/accounts/dev/component/vpc"),
+		Entry("by account and exclude glob", FolderFilter{Accounts: []string{"prod"}, Exclude: []string{"**/dns"}},
+			"aws/accounts/prod/component/vpc"),
+	)
+
+	It("should reject invalid globs", func() {
+		filter := FolderFilter{Include: []string{"[a-"}}
+		_, _, err := filter.Apply(context.Background(), layout, root, folders)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("invalid glob"))
+	})
+
+	It("should select folders changed since a git ref", func() {
+		git("init", "-q")
+		git("-c", "user.name=test", "-c", "user.email=test@example.com", "add", "-A")
+		git("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial")
+
+		Expect(os.WriteFile(filepath.Join(folders[1], "main.tf"), []byte("# changed"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(folders[2], "outputs.tf"), []byte("# new"), 0644)).To(Succeed())
+
+		filter := FolderFilter{ChangedSince: "HEAD"}
+		selected, skipped, err := filter.Apply(context.Background(), layout, root, folders)
+		Expect(err).To(BeNil())
+		Expect(selected).To(ConsistOf(folders[1], folders[2]))
+		Expect(skipped).To(ConsistOf(HaveField("Reason", ContainSubstring("no changes since HEAD"))))
+	})
+
+	It("should select folders with changes in subfolders and in their local module sources", func() {
+		module := filepath.Join(root, "modules", "network")
+		Expect(os.MkdirAll(module, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(module, "main.tf"), []byte("# module"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(folders[0], "main.tf"), []byte(`module "network" {
+  source = "../../../../../modules/network"
+}`), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(folders[2], "templates"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(folders[2], "templates", "user_data.tpl"), []byte("#!/bin/sh"), 0644)).To(Succeed())
+
+		git("init", "-q")
+		git("-c", "user.name=test", "-c", "user.email=test@example.com", "add", "-A")
+		git("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial")
+
+		Expect(os.WriteFile(filepath.Join(module, "main.tf"), []byte("# changed"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(folders[2], "templates", "user_data.tpl"), []byte("#!/bin/bash"), 0644)).To(Succeed())
+
+		filter := FolderFilter{ChangedSince: "HEAD"}
+		selected, _, err := filter.Apply(context.Background(), layout, root, folders)
+		Expect(err).To(BeNil())
+		Expect(selected).To(ConsistOf(folders[0], folders[2]))
+	})
+})
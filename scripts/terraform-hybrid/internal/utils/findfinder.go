@@ -1,13 +1,43 @@
 package utils
 
 import (
+	"bufio"
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
 )
 
+// IgnoreFileName is the name of the file excluding folders from discovery.
+// An empty file excludes its own folder and everything below it, otherwise each
+// line is a glob relative to the folder the file is in.
+const IgnoreFileName = ".tfhybridignore"
+
 // FolderFinder defines the interface for finding component provider folders
 type FolderFinder interface {
-	FindComponentProviderFolders(providerFolderPath string) ([]string, error)
+	FindComponentProviderFolders(ctx context.Context, rootPath, provider string, layout *Layout) ([]FolderDecision, error)
+}
+
+// FolderDecision records whether a folder was selected as a root module and why
+type FolderDecision struct {
+	Path     string
+	Included bool
+	Reason   string
+}
+
+// IncludedFolders returns the paths of the included folders
+func IncludedFolders(decisions []FolderDecision) []string {
+	var folders []string
+	for _, decision := range decisions {
+		if decision.Included {
+			folders = append(folders, decision.Path)
+		}
+	}
+	return folders
 }
 
 // TerraformFolderFinder is the concrete implementation for finding folders
@@ -18,23 +48,184 @@ func NewFolderFinder() FolderFinder {
 	return &TerraformFolderFinder{}
 }
 
-// FindComponentProviderFolders finds all subfolders within a specified provider folder
-func (tff *TerraformFolderFinder) FindComponentProviderFolders(providerFolderPath string) ([]string, error) {
-	var componentFolders []string
+// ignoreRules holds the patterns of a .tfhybridignore file
+type ignoreRules struct {
+	dir      string
+	patterns []string
+}
+
+// FindComponentProviderFolders finds the root modules under the root path that match the layout for a provider.
+// When the layout has no {provider} placeholder every matching folder is considered.
+// A matching folder is a root module when it contains Terraform configuration and is not used
+// as a local module source by another candidate. Folders with files that cannot be parsed are skipped.
+func (tff *TerraformFolderFinder) FindComponentProviderFolders(
+	ctx context.Context, rootPath, provider string, layout *Layout,
+) ([]FolderDecision, error) {
+	var decisions []FolderDecision
+	var candidates []*ModuleInfo
+	var rules []ignoreRules
+	filterProvider := layout.HasPlaceholder("provider")
+
+	// The walk skips the root itself, so its ignore file is read up front
+	rootRules, ignoreAll, err := readIgnoreFile(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	if ignoreAll {
+		return []FolderDecision{{Path: rootPath, Reason: fmt.Sprintf("excluded by its %s", IgnoreFileName)}}, nil
+	}
+	if rootRules != nil {
+		rules = append(rules, *rootRules)
+	}
 
-	// Walk through the provider folder path and find all subdirectories
-	err := filepath.Walk(providerFolderPath, func(path string, info os.FileInfo, err error) error {
+	// Walk through the root path and find all folders matching the layout
+	err = filepath.WalkDir(rootPath, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Check if it's a component folder or deeper (e.g., has Terraform files)
-		if info.IsDir() && filepath.Base(path) == "component" {
-			componentFolders = append(componentFolders, path)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !d.IsDir() || path == rootPath {
+			return nil
+		}
+
+		// Skip Terraform's own working directories
+		if d.Name() == ".terraform" || d.Name() == "terraform.tfstate.d" {
+			return filepath.SkipDir
+		}
+
+		relativePath, err := filepath.Rel(rootPath, path)
+		if err != nil {
+			return err
+		}
+
+		// Do not descend into other providers when the layout starts with the provider
+		if filterProvider && layout.Template.segments[0] == "{provider}" && relativePath == d.Name() && d.Name() != provider {
+			return filepath.SkipDir
+		}
+
+		if layout.IsIgnored(relativePath) {
+			decisions = append(decisions, FolderDecision{Path: path, Reason: "matches a layout ignore glob"})
+			return filepath.SkipDir
+		}
+
+		folderRules, ignoreAll, err := readIgnoreFile(path)
+		if err != nil {
+			return err
+		}
+		if ignoreAll {
+			decisions = append(decisions, FolderDecision{Path: path, Reason: fmt.Sprintf("excluded by its %s", IgnoreFileName)})
+			return filepath.SkipDir
+		}
+		if ignoredBy, ok := matchIgnoreRules(rules, path); ok {
+			decisions = append(decisions, FolderDecision{Path: path, Reason: fmt.Sprintf("excluded by %s", ignoredBy)})
+			return filepath.SkipDir
+		}
+		if folderRules != nil {
+			rules = append(rules, *folderRules)
+		}
+
+		values, ok := layout.Match(relativePath)
+		if !ok || (filterProvider && values["provider"] != provider) {
+			return nil
+		}
+
+		// A folder whose files cannot be parsed is skipped rather than failing the discovery of the whole tree
+		info, err := InspectModule(path)
+		switch {
+		case err != nil:
+			decisions = append(decisions, FolderDecision{Path: path, Reason: err.Error()})
+		case len(info.Files) == 0:
+			decisions = append(decisions, FolderDecision{Path: path, Reason: "contains no .tf or .tf.json files"})
+		case !info.HasConfiguration():
+			decisions = append(decisions, FolderDecision{Path: path, Reason: "Terraform files contain no configuration blocks"})
+		default:
+			candidates = append(candidates, info)
 		}
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Folders used as local module sources are modules, not root modules
+	referencedBy := map[string]string{}
+	for _, candidate := range candidates {
+		for _, source := range candidate.LocalModuleSources {
+			if _, ok := referencedBy[source]; !ok {
+				referencedBy[source] = candidate.Dir
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		if caller, ok := referencedBy[filepath.Clean(candidate.Dir)]; ok {
+			decisions = append(decisions, FolderDecision{
+				Path:   candidate.Dir,
+				Reason: fmt.Sprintf("used as a local module source by %s", caller),
+			})
+			continue
+		}
+
+		decisions = append(decisions, FolderDecision{
+			Path:     candidate.Dir,
+			Included: true,
+			Reason:   fmt.Sprintf("contains Terraform configuration in %d files", len(candidate.Files)),
+		})
+	}
+
+	sort.SliceStable(decisions, func(i, j int) bool { return decisions[i].Path < decisions[j].Path })
+	return decisions, nil
+}
+
+// readIgnoreFile reads the .tfhybridignore file of a folder.
+// It reports ignoreAll when the file exists without any patterns.
+func readIgnoreFile(dir string) (*ignoreRules, bool, error) {
+	file, err := os.Open(filepath.Join(dir, IgnoreFileName))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading %s: %v", filepath.Join(dir, IgnoreFileName), err)
+	}
+	defer file.Close()
+
+	rules := &ignoreRules{dir: dir}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern := strings.Trim(line, "/")
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, false, fmt.Errorf("invalid pattern %q in %s", line, filepath.Join(dir, IgnoreFileName))
+		}
+		rules.patterns = append(rules.patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("error reading %s: %v", filepath.Join(dir, IgnoreFileName), err)
+	}
+
+	return rules, len(rules.patterns) == 0, nil
+}
 
-	return componentFolders, err
+// matchIgnoreRules returns the ignore file excluding a path, if any
+func matchIgnoreRules(rules []ignoreRules, path string) (string, bool) {
+	for _, rule := range rules {
+		relativePath, err := filepath.Rel(rule.dir, path)
+		if err != nil || strings.HasPrefix(relativePath, "..") {
+			continue
+		}
+		for _, pattern := range rule.patterns {
+			if matched, _ := doublestar.Match(pattern, filepath.ToSlash(relativePath)); matched {
+				return filepath.Join(rule.dir, IgnoreFileName), true
+			}
+		}
+	}
+	return "", false
 }
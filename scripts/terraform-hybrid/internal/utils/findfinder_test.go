@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TerraformFolderFinder", func() {
+	var (
+		root   string
+		layout *Layout
+	)
+
+	writeFile := func(relativePath, content string) {
+		path := filepath.Join(root, relativePath)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	reasonFor := func(decisions []FolderDecision, relativePath string) (bool, string) {
+		for _, decision := range decisions {
+			if decision.Path == filepath.Join(root, relativePath) {
+				return decision.Included, decision.Reason
+			}
+		}
+		Fail("no decision for " + relativePath)
+		return false, ""
+	}
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+
+		var err error
+		layout, err = NewLayout("deploy/provider", "{provider}/accounts/{account}/component/{stack}/**", nil)
+		Expect(err).To(BeNil())
+	})
+
+	It("should only include folders containing Terraform configuration", func() {
+		writeFile("aws/accounts/a/component/vpc/main.tf", `resource "null_resource" "this" {}`)
+		writeFile("aws/accounts/a/component/json/main.tf.json", `{"output": {"id": {"value": "x"}}}`)
+		writeFile("aws/accounts/a/component/vpc/templates/user_data.tpl", "#!/bin/sh")
+		writeFile("aws/accounts/a/component/comments/main.tf", "# nothing here yet")
+		Expect(os.MkdirAll(filepath.Join(root, "aws/accounts/a/component/empty"), 0755)).To(Succeed())
+
+		decisions, err := NewFolderFinder().FindComponentProviderFolders(context.Background(), root, "aws", layout)
+		Expect(err).To(BeNil())
+
+		Expect(IncludedFolders(decisions)).To(ConsistOf(
+			filepath.Join(root, "aws/accounts/a/component/vpc"),
+			filepath.Join(root, "aws/accounts/a/component/json"),
+		))
+
+		_, reason := reasonFor(decisions, "aws/accounts/a/component/vpc/templates")
+		Expect(reason).To(ContainSubstring("no .tf or .tf.json files"))
+		_, reason = reasonFor(decisions, "aws/accounts/a/component/comments")
+		Expect(reason).To(ContainSubstring("no configuration blocks"))
+	})
+
+	It("should skip folders used as local module sources", func() {
+		writeFile("aws/accounts/a/component/app/main.tf", `
+module "network" {
+  source = "./modules/network"
+}
+module "remote" {
+  source = "hashicorp/consul/aws"
+}`)
+		writeFile("aws/accounts/a/component/app/modules/network/main.tf", `resource "null_resource" "this" {}`)
+
+		decisions, err := NewFolderFinder().FindComponentProviderFolders(context.Background(), root, "aws", layout)
+		Expect(err).To(BeNil())
+
+		Expect(IncludedFolders(decisions)).To(ConsistOf(filepath.Join(root, "aws/accounts/a/component/app")))
+		included, reason := reasonFor(decisions, "aws/accounts/a/component/app/modules/network")
+		Expect(included).To(BeFalse())
+		Expect(reason).To(ContainSubstring("local module source"))
+	})
+
+	It("should honour .tfhybridignore files", func() {
+		writeFile("aws/accounts/a/component/vpc/main.tf", `resource "null_resource" "this" {}`)
+		writeFile("aws/accounts/a/component/legacy/main.tf", `resource "null_resource" "this" {}`)
+		writeFile("aws/accounts/a/component/legacy/"+IgnoreFileName, "")
+		writeFile("aws/accounts/b/component/old-dns/main.tf", `resource "null_resource" "this" {}`)
+		writeFile("aws/accounts/b/component/dns/main.tf", `resource "null_resource" "this" {}`)
+		writeFile("aws/accounts/b/"+IgnoreFileName, "# legacy stacks\ncomponent/old-*\n")
+
+		decisions, err := NewFolderFinder().FindComponentProviderFolders(context.Background(), root, "aws", layout)
+		Expect(err).To(BeNil())
+
+		Expect(IncludedFolders(decisions)).To(ConsistOf(
+			filepath.Join(root, "aws/accounts/a/component/vpc"),
+			filepath.Join(root, "aws/accounts/b/component/dns"),
+		))
+		_, reason := reasonFor(decisions, "aws/accounts/a/component/legacy")
+		Expect(reason).To(ContainSubstring(IgnoreFileName))
+		_, reason = reasonFor(decisions, "aws/accounts/b/component/old-dns")
+		Expect(reason).To(ContainSubstring(filepath.Join(root, "aws/accounts/b", IgnoreFileName)))
+	})
+
+	It("should honour a .tfhybridignore file at the root", func() {
+		writeFile("aws/accounts/a/component/vpc/main.tf", `resource "null_resource" "this" {}`)
+		writeFile("aws/accounts/a/component/legacy/main.tf", `resource "null_resource" "this" {}`)
+		writeFile(IgnoreFileName, "aws/accounts/*/component/legacy\n")
+
+		decisions, err := NewFolderFinder().FindComponentProviderFolders(context.Background(), root, "aws", layout)
+		Expect(err).To(BeNil())
+
+		Expect(IncludedFolders(decisions)).To(ConsistOf(filepath.Join(root, "aws/accounts/a/component/vpc")))
+		_, reason := reasonFor(decisions, "aws/accounts/a/component/legacy")
+		Expect(reason).To(ContainSubstring(filepath.Join(root, IgnoreFileName)))
+	})
+
+	It("should exclude everything below a root with an empty .tfhybridignore file", func() {
+		writeFile("aws/accounts/a/component/vpc/main.tf", `resource "null_resource" "this" {}`)
+		writeFile(IgnoreFileName, "")
+
+		decisions, err := NewFolderFinder().FindComponentProviderFolders(context.Background(), root, "aws", layout)
+		Expect(err).To(BeNil())
+		Expect(IncludedFolders(decisions)).To(BeEmpty())
+	})
+
+	It("should only return folders of the requested provider", func() {
+		writeFile("aws/accounts/a/component/vpc/main.tf", `resource "null_resource" "this" {}`)
+		writeFile("gcp/accounts/a/component/vpc/main.tf", `resource "null_resource" "this" {}`)
+
+		decisions, err := NewFolderFinder().FindComponentProviderFolders(context.Background(), root, "gcp", layout)
+		Expect(err).To(BeNil())
+		Expect(IncludedFolders(decisions)).To(ConsistOf(filepath.Join(root, "gcp/accounts/a/component/vpc")))
+	})
+
+	It("should skip folders with invalid Terraform files and keep walking", func() {
+		writeFile("aws/accounts/a/component/vpc/main.tf", `resource "null_resource" {`)
+		writeFile("aws/accounts/a/component/dns/main.tf", `resource "null_resource" "this" {}`)
+
+		decisions, err := NewFolderFinder().FindComponentProviderFolders(context.Background(), root, "aws", layout)
+		Expect(err).To(BeNil())
+		Expect(IncludedFolders(decisions)).To(ConsistOf(filepath.Join(root, "aws/accounts/a/component/dns")))
+		included, reason := reasonFor(decisions, "aws/accounts/a/component/vpc")
+		Expect(included).To(BeFalse())
+		Expect(reason).To(ContainSubstring("error parsing " + filepath.Join(root, "aws/accounts/a/component/vpc/main.tf")))
+	})
+})
@@ -0,0 +1,9 @@
+package utils
+
+// OrDash returns "-" for empty values in tables
+func OrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Layout describes where root modules live in the repository
+type Layout struct {
+	// Root is the folder all relative paths are computed from, e.g. "deploy/provider"
+	Root     string
+	Template *PathTemplate
+	Ignore   []string
+}
+
+// NewLayout creates a Layout after validating the template and ignore globs
+func NewLayout(root, template string, ignore []string) (*Layout, error) {
+	if strings.TrimSpace(root) == "" {
+		return nil, fmt.Errorf("layout root is empty")
+	}
+
+	pathTemplate, err := ParsePathTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range ignore {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("invalid ignore glob %q", pattern)
+		}
+	}
+
+	return &Layout{Root: filepath.Clean(root), Template: pathTemplate, Ignore: ignore}, nil
+}
+
+// HasPlaceholder reports whether the path template declares the given placeholder
+func (l *Layout) HasPlaceholder(name string) bool {
+	return slices.Contains(l.Template.Placeholders(), name)
+}
+
+// Match matches a path relative to the root against the path template
+func (l *Layout) Match(relativePath string) (map[string]string, bool) {
+	return l.Template.Match(relativePath)
+}
+
+// IsIgnored reports whether a path relative to the root matches one of the ignore globs
+func (l *Layout) IsIgnored(relativePath string) bool {
+	slashPath := filepath.ToSlash(relativePath)
+	for _, pattern := range l.Ignore {
+		if matched, _ := doublestar.Match(pattern, slashPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// RelativePath returns the path of dir relative to the layout root.
+//
+// An absolute root is used as is. A relative root such as "deploy/provider" is searched for
+// as a sequence of whole path segments within the absolute path of dir.
+func (l *Layout) RelativePath(dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("could not determine absolute path: %v", err)
+	}
+
+	if filepath.IsAbs(l.Root) {
+		relativePath, err := filepath.Rel(l.Root, absDir)
+		if err != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") {
+			return "", fmt.Errorf("workspace directory does not seem to be under '%s'", l.Root)
+		}
+		return relativePath, nil
+	}
+
+	rootParts := strings.Split(filepath.ToSlash(l.Root), "/")
+	dirParts := strings.Split(filepath.ToSlash(absDir), "/")
+	for i := 0; i+len(rootParts) < len(dirParts); i++ {
+		if slices.Equal(dirParts[i:i+len(rootParts)], rootParts) {
+			return filepath.Join(dirParts[i+len(rootParts):]...), nil
+		}
+	}
+
+	return "", fmt.Errorf("workspace directory does not seem to be under '%s'", l.Root)
+}
+
+// Slug joins the segments of a path relative to the layout root with underscores, e.g. aws_accounts_prod
+func (l *Layout) Slug(relativePath string) string {
+	return strings.ReplaceAll(relativePath, string(filepath.Separator), "_")
+}
@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// FolderTask processes a single folder and writes its output to out
+type FolderTask func(ctx context.Context, folder string, out io.Writer) error
+
+// FolderError is the failure of a FolderTask for one folder
+type FolderError struct {
+	Folder string
+	Err    error
+}
+
+// Error returns the folder and the error message
+func (fe *FolderError) Error() string {
+	return fmt.Sprintf("%s: %v", fe.Folder, fe.Err)
+}
+
+// Unwrap returns the underlying error
+func (fe *FolderError) Unwrap() error {
+	return fe.Err
+}
+
+// FolderErrors collects the failures of a run over many folders
+type FolderErrors struct {
+	Total  int
+	Errors []*FolderError
+	// NotStarted is the number of folders left untouched because the run was cancelled
+	NotStarted int
+	// Cause is the reason the run was cancelled, if it was
+	Cause error
+}
+
+// Error summarizes every failed folder
+func (fe *FolderErrors) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d of %d folders failed", len(fe.Errors), fe.Total)
+	if fe.Cause != nil {
+		fmt.Fprintf(&sb, ", %d were not started: %v", fe.NotStarted, fe.Cause)
+	}
+	if len(fe.Errors) > 0 {
+		sb.WriteString(":")
+	}
+	for _, err := range fe.Errors {
+		fmt.Fprintf(&sb, "\n  %s", err.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap returns the errors of the individual folders and the cancellation cause
+func (fe *FolderErrors) Unwrap() []error {
+	errs := make([]error, 0, len(fe.Errors)+1)
+	for _, err := range fe.Errors {
+		errs = append(errs, err)
+	}
+	if fe.Cause != nil {
+		errs = append(errs, fe.Cause)
+	}
+	return errs
+}
+
+// folderResult is the buffered outcome of a FolderTask
+type folderResult struct {
+	index   int
+	output  []byte
+	err     error
+	started bool
+}
+
+// ProcessFolders runs the task for every folder with at most parallelism tasks at a time.
+// The output of each folder is buffered and written to out in the order of folders,
+// and every failure is collected into a *FolderErrors instead of stopping the run.
+// Once ctx is cancelled no further folders are started, while running tasks are left to finish.
+func ProcessFolders(ctx context.Context, folders []string, parallelism int, out io.Writer, task FolderTask) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	jobs := make(chan int)
+	results := make(chan folderResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism && i < len(folders); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				if ctx.Err() != nil {
+					results <- folderResult{index: index}
+					continue
+				}
+				var buffer bytes.Buffer
+				err := task(ctx, folders[index], &buffer)
+				results <- folderResult{index: index, output: buffer.Bytes(), err: err, started: true}
+			}
+		}()
+	}
+
+	go func() {
+		for index := range folders {
+			jobs <- index
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Flush results in folder order as soon as all previous folders are done
+	pending := map[int]folderResult{}
+	next := 0
+	var failures []*FolderError
+	notStarted := 0
+	for result := range results {
+		pending[result.index] = result
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if !ready.started {
+				notStarted++
+			}
+			_, _ = out.Write(ready.output)
+			if ready.err != nil {
+				failures = append(failures, &FolderError{Folder: folders[next], Err: ready.err})
+			}
+			next++
+		}
+	}
+
+	if len(failures) > 0 || notStarted > 0 {
+		return &FolderErrors{Total: len(folders), Errors: failures, NotStarted: notStarted, Cause: context.Cause(ctx)}
+	}
+	return nil
+}
+
+// ProcessFoldersInOrder runs the task for the folders in the order of the dependency graph, processing
+// the folders of each level of the graph like ProcessFolders. Folders not in the graph are ignored.
+// A folder depending, directly or through other nodes, on a failed folder is not started and fails.
+// With reverse, e.g. for destroying, folders run after everything depending on them instead.
+func ProcessFoldersInOrder(
+	ctx context.Context, graph *Graph, folders []string, reverse bool, parallelism int, out io.Writer, task FolderTask,
+) error {
+	levels, err := graph.Levels()
+	if err != nil {
+		return err
+	}
+	if reverse {
+		slices.Reverse(levels)
+	}
+
+	selected := map[string]bool{}
+	for _, folder := range folders {
+		selected[folder] = true
+	}
+
+	result := &FolderErrors{}
+	failed := map[string]bool{}
+	for _, level := range levels {
+		var runnable []string
+		for _, folder := range level {
+			if !selected[folder] {
+				continue
+			}
+			result.Total++
+
+			if blocker, ok := firstFailed(graph.Reachable(folder, reverse), failed); ok {
+				fmt.Fprintf(out, "Skipping folder %s: %s failed\n", folder, blocker)
+				result.Errors = append(result.Errors, &FolderError{Folder: folder, Err: fmt.Errorf("not started because %s failed", blocker)})
+				failed[folder] = true
+				continue
+			}
+			runnable = append(runnable, folder)
+		}
+
+		if ctx.Err() != nil {
+			result.NotStarted += len(runnable)
+			continue
+		}
+
+		err := ProcessFolders(ctx, runnable, parallelism, out, task)
+		var levelErrors *FolderErrors
+		if errors.As(err, &levelErrors) {
+			result.Errors = append(result.Errors, levelErrors.Errors...)
+			result.NotStarted += levelErrors.NotStarted
+			for _, folderErr := range levelErrors.Errors {
+				failed[folderErr.Folder] = true
+			}
+		}
+	}
+
+	if len(result.Errors) > 0 || result.NotStarted > 0 {
+		result.Cause = context.Cause(ctx)
+		return result
+	}
+	return nil
+}
+
+// firstFailed returns the first failed folder of a set in sorted order
+func firstFailed(folders, failed map[string]bool) (string, bool) {
+	for _, folder := range sortedKeys(folders) {
+		if failed[folder] {
+			return folder, true
+		}
+	}
+	return "", false
+}
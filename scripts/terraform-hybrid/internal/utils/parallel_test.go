@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProcessFolders", func() {
+	folders := []string{"a", "b", "c", "d", "e", "f"}
+
+	It("should write the output of every folder in folder order", func() {
+		var out bytes.Buffer
+		err := ProcessFolders(context.Background(), folders, 3, &out, func(_ context.Context, folder string, w io.Writer) error {
+			// Finish later folders first to exercise ordering
+			time.Sleep(time.Duration(len(folders)-int(folder[0]-'a')) * time.Millisecond)
+			fmt.Fprintf(w, "start %s\n", folder)
+			fmt.Fprintf(w, "end %s\n", folder)
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(out.String()).To(Equal("start a\nend a\nstart b\nend b\nstart c\nend c\nstart d\nend d\nstart e\nend e\nstart f\nend f\n"))
+	})
+
+	It("should not exceed the parallelism", func() {
+		var running, maxRunning int32
+		err := ProcessFolders(context.Background(), folders, 2, io.Discard, func(context.Context, string, io.Writer) error {
+			current := atomic.AddInt32(&running, 1)
+			for {
+				previous := atomic.LoadInt32(&maxRunning)
+				if current <= previous || atomic.CompareAndSwapInt32(&maxRunning, previous, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(maxRunning).To(BeNumerically("<=", 2))
+	})
+
+	It("should process every folder and collect all errors", func() {
+		var processed int32
+		errBoom := errors.New("boom")
+		err := ProcessFolders(context.Background(), folders, 4, io.Discard, func(_ context.Context, folder string, _ io.Writer) error {
+			atomic.AddInt32(&processed, 1)
+			if folder == "b" || folder == "e" {
+				return errBoom
+			}
+			return nil
+		})
+		Expect(processed).To(BeEquivalentTo(len(folders)))
+
+		var folderErrors *FolderErrors
+		Expect(errors.As(err, &folderErrors)).To(BeTrue())
+		Expect(folderErrors.Errors).To(HaveLen(2))
+		Expect(folderErrors.Errors[0].Folder).To(Equal("b"))
+		Expect(folderErrors.Errors[1].Folder).To(Equal("e"))
+		Expect(errors.Is(err, errBoom)).To(BeTrue())
+		Expect(err.Error()).To(HavePrefix("2 of 6 folders failed:"))
+	})
+
+	It("should not start folders once the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		var processed []string
+		err := ProcessFolders(ctx, folders, 1, io.Discard, func(_ context.Context, folder string, _ io.Writer) error {
+			processed = append(processed, folder)
+			if folder == "b" {
+				cancel()
+			}
+			return nil
+		})
+		Expect(processed).To(Equal([]string{"a", "b"}))
+
+		var folderErrors *FolderErrors
+		Expect(errors.As(err, &folderErrors)).To(BeTrue())
+		Expect(folderErrors.NotStarted).To(Equal(4))
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+	})
+})
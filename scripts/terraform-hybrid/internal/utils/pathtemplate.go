@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PathTemplate matches slash-separated relative paths against a declared layout.
+//
+// Segments of the template are either literals, "{name}" placeholders capturing exactly one
+// path segment, "*" matching one segment without capturing it, or "**" matching zero or more segments.
+type PathTemplate struct {
+	raw      string
+	segments []string
+}
+
+// ParsePathTemplate parses a layout template such as "{provider}/accounts/{account}/component/**"
+func ParsePathTemplate(template string) (*PathTemplate, error) {
+	trimmed := strings.Trim(filepath.ToSlash(template), "/")
+	if trimmed == "" {
+		return nil, fmt.Errorf("path template is empty")
+	}
+
+	segments := strings.Split(trimmed, "/")
+	seen := map[string]bool{}
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("path template %q contains an empty segment", template)
+		}
+
+		name, ok := placeholderName(segment)
+		if !ok {
+			if strings.ContainsAny(segment, "{}") {
+				return nil, fmt.Errorf("path template %q has a malformed placeholder %q", template, segment)
+			}
+			continue
+		}
+		if name == "" {
+			return nil, fmt.Errorf("path template %q has an unnamed placeholder", template)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("path template %q declares placeholder {%s} twice", template, name)
+		}
+		seen[name] = true
+	}
+
+	return &PathTemplate{raw: template, segments: segments}, nil
+}
+
+// String returns the template as it was declared
+func (pt *PathTemplate) String() string {
+	return pt.raw
+}
+
+// Placeholders returns the placeholder names in the order they appear in the template
+func (pt *PathTemplate) Placeholders() []string {
+	var names []string
+	for _, segment := range pt.segments {
+		if name, ok := placeholderName(segment); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Match matches a relative path against the template and returns the captured placeholders
+func (pt *PathTemplate) Match(relativePath string) (map[string]string, bool) {
+	trimmed := strings.Trim(filepath.ToSlash(relativePath), "/")
+	var parts []string
+	if trimmed != "" && trimmed != "." {
+		parts = strings.Split(trimmed, "/")
+	}
+
+	values := map[string]string{}
+	if !matchSegments(pt.segments, parts, values) {
+		return nil, false
+	}
+	return values, true
+}
+
+// matchSegments matches template segments against path parts, backtracking over "**"
+func matchSegments(segments, parts []string, values map[string]string) bool {
+	if len(segments) == 0 {
+		return len(parts) == 0
+	}
+
+	segment := segments[0]
+	if segment == "**" {
+		for skip := 0; skip <= len(parts); skip++ {
+			if matchSegments(segments[1:], parts[skip:], values) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+
+	if name, ok := placeholderName(segment); ok {
+		previous, existed := values[name]
+		values[name] = parts[0]
+		if matchSegments(segments[1:], parts[1:], values) {
+			return true
+		}
+		if existed {
+			values[name] = previous
+		} else {
+			delete(values, name)
+		}
+		return false
+	}
+
+	if segment != "*" && segment != parts[0] {
+		return false
+	}
+	return matchSegments(segments[1:], parts[1:], values)
+}
+
+// placeholderName returns the name of a "{name}" segment
+func placeholderName(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
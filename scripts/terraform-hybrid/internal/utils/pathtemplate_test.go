@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestUtils(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Utils Suite")
+}
+
+var _ = Describe("PathTemplate", func() {
+	DescribeTable("should match relative paths",
+		func(template, relativePath string, expected map[string]string) {
+			pt, err := ParsePathTemplate(template)
+			Expect(err).To(BeNil())
+
+			values, ok := pt.Match(relativePath)
+			if expected == nil {
+				Expect(ok).To(BeFalse())
+				return
+			}
+			Expect(ok).To(BeTrue())
+			Expect(values).To(Equal(expected))
+		},
+		Entry("exact account segment", "{provider}/accounts/{account}/component/**",
+			"aws/accounts/aws_test_1/component", map[string]string{"provider": "aws", "account": "aws_test_1"}),
+		Entry("nested folders below the component", "{provider}/accounts/{account}/component/**",
+			"aws/accounts/aws_test_10/component/file1/templates", map[string]string{"provider": "aws", "account": "aws_test_10"}),
+		Entry("different layout", "{provider}/accounts/{account}/component/**",
+			"gcp/project/gcp_test_1/component", nil),
+		Entry("account name elsewhere in the path", "{provider}/accounts/{account}/component/**",
+			"aws_test_1/component", nil),
+		Entry("single segment wildcard", "{provider}/*/{account}/component",
+			"gcp/project/gcp_test_1/component", map[string]string{"provider": "gcp", "account": "gcp_test_1"}),
+		Entry("double star in the middle", "{provider}/**/component/{stack}",
+			"gcp/component/file1", map[string]string{"provider": "gcp", "stack": "file1"}),
+	)
+
+	DescribeTable("should reject invalid templates",
+		func(template, expectedError string) {
+			_, err := ParsePathTemplate(template)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(expectedError))
+		},
+		Entry("empty", "", "empty"),
+		Entry("empty segment", "{provider}//{account}", "empty segment"),
+		Entry("unnamed placeholder", "{provider}/{}", "unnamed placeholder"),
+		Entry("duplicate placeholder", "{account}/{account}", "twice"),
+		Entry("malformed placeholder", "{provider/{account}", "malformed placeholder"),
+	)
+})
+
+var _ = Describe("Layout", func() {
+	It("should reject invalid ignore globs", func() {
+		_, err := NewLayout("deploy/provider", "{provider}/{stack}", []string{"[a-"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("invalid ignore glob"))
+	})
+
+	It("should match ignore globs against the relative path", func() {
+		layout, err := NewLayout("deploy/provider", "{provider}/{stack}", []string{"**/templates", "aws/legacy-*"})
+		Expect(err).To(BeNil())
+		Expect(layout.IsIgnored("aws/accounts/prod/component/templates")).To(BeTrue())
+		Expect(layout.IsIgnored("aws/legacy-vpc")).To(BeTrue())
+		Expect(layout.IsIgnored("aws/vpc")).To(BeFalse())
+	})
+
+	It("should compute paths relative to an absolute root", func() {
+		layout, err := NewLayout("/repo/stacks", "{provider}/{stack}", nil)
+		Expect(err).To(BeNil())
+
+		relativePath, err := layout.RelativePath("/repo/stacks/aws/vpc")
+		Expect(err).To(BeNil())
+		Expect(relativePath).To(Equal("aws/vpc"))
+
+		_, err = layout.RelativePath("/repo/other/aws/vpc")
+		Expect(err).To(HaveOccurred())
+	})
+})
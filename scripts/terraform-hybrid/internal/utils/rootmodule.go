@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// terraformFileSchema lists the top-level blocks that make up Terraform configuration
+var terraformFileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "terraform"},
+		{Type: "provider", LabelNames: []string{"name"}},
+		{Type: "variable", LabelNames: []string{"name"}},
+		{Type: "output", LabelNames: []string{"name"}},
+		{Type: "locals"},
+		{Type: "module", LabelNames: []string{"name"}},
+		{Type: "resource", LabelNames: []string{"type", "name"}},
+		{Type: "data", LabelNames: []string{"type", "name"}},
+		{Type: "import"},
+		{Type: "moved"},
+		{Type: "removed"},
+		{Type: "check", LabelNames: []string{"name"}},
+	},
+}
+
+// moduleBlockSchema extracts the source of a module block
+var moduleBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "source"}},
+}
+
+// remoteStateBlockSchema extracts how a terraform_remote_state data source locates its state
+var remoteStateBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "backend"}, {Name: "config"}, {Name: "workspace"}},
+}
+
+// RemoteStateRef is a terraform_remote_state data source reading the state of another configuration
+type RemoteStateRef struct {
+	Name string
+	// File is the file declaring the data source
+	File string
+	// Backend is the backend type, empty when it is not a literal
+	Backend string
+	// Config holds the literal string attributes of the config object
+	Config map[string]string
+	// Workspace is the literal workspace, empty when unset or not a literal
+	Workspace string
+	// Dynamic lists the attributes whose value depends on variables or other expressions
+	Dynamic []string
+}
+
+// String identifies the data source, e.g. "data.terraform_remote_state.vpc in main.tf"
+func (rs RemoteStateRef) String() string {
+	return fmt.Sprintf("data.terraform_remote_state.%s in %s", rs.Name, rs.File)
+}
+
+// ModuleInfo describes the Terraform configuration found in a folder
+type ModuleInfo struct {
+	Dir string
+	// Files are the .tf and .tf.json files of the folder
+	Files []string
+	// Blocks is the number of top-level configuration blocks across all files
+	Blocks int
+	// LocalModuleSources are the absolute folders referenced by local module sources
+	LocalModuleSources []string
+	// RemoteStates are the terraform_remote_state data sources of the folder
+	RemoteStates []RemoteStateRef
+}
+
+// HasConfiguration reports whether the folder contains any Terraform configuration
+func (mi *ModuleInfo) HasConfiguration() bool {
+	return mi.Blocks > 0
+}
+
+// InspectModule parses the .tf and .tf.json files of a folder
+func InspectModule(dir string) (*ModuleInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading folder %s: %v", dir, err)
+	}
+
+	info := &ModuleInfo{Dir: dir}
+	parser := hclparse.NewParser()
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isTerraformFile(entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		var file *hcl.File
+		var diags hcl.Diagnostics
+		if strings.HasSuffix(entry.Name(), ".json") {
+			file, diags = parser.ParseJSONFile(path)
+		} else {
+			file, diags = parser.ParseHCLFile(path)
+		}
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("error parsing %s: %s", path, diags.Error())
+		}
+
+		content, _, diags := file.Body.PartialContent(terraformFileSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("error reading %s: %s", path, diags.Error())
+		}
+
+		info.Files = append(info.Files, path)
+		info.Blocks += len(content.Blocks)
+
+		for _, block := range content.Blocks.OfType("module") {
+			source, ok := moduleSource(block)
+			if ok && isLocalModuleSource(source) {
+				info.LocalModuleSources = append(info.LocalModuleSources, filepath.Clean(filepath.Join(dir, source)))
+			}
+		}
+
+		for _, block := range content.Blocks.OfType("data") {
+			if block.Labels[0] == "terraform_remote_state" {
+				info.RemoteStates = append(info.RemoteStates, remoteState(block, path))
+			}
+		}
+	}
+
+	sort.Strings(info.LocalModuleSources)
+	return info, nil
+}
+
+// moduleSource returns the literal source of a module block
+func moduleSource(block *hcl.Block) (string, bool) {
+	content, _, diags := block.Body.PartialContent(moduleBlockSchema)
+	if diags.HasErrors() {
+		return "", false
+	}
+
+	attribute, ok := content.Attributes["source"]
+	if !ok {
+		return "", false
+	}
+
+	value, diags := attribute.Expr.Value(nil)
+	if diags.HasErrors() || !value.Type().Equals(cty.String) || value.IsNull() {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// remoteState reads the literal attributes of a terraform_remote_state data source
+func remoteState(block *hcl.Block, path string) RemoteStateRef {
+	ref := RemoteStateRef{Name: block.Labels[1], File: path, Config: map[string]string{}}
+
+	content, _, diags := block.Body.PartialContent(remoteStateBlockSchema)
+	if diags.HasErrors() {
+		ref.Dynamic = append(ref.Dynamic, "backend")
+		return ref
+	}
+
+	if attribute, ok := content.Attributes["backend"]; ok {
+		if value, ok := literalString(attribute.Expr); ok {
+			ref.Backend = value
+		} else {
+			ref.Dynamic = append(ref.Dynamic, "backend")
+		}
+	}
+
+	if attribute, ok := content.Attributes["workspace"]; ok {
+		if value, ok := literalString(attribute.Expr); ok {
+			ref.Workspace = value
+		} else {
+			ref.Dynamic = append(ref.Dynamic, "workspace")
+		}
+	}
+
+	if attribute, ok := content.Attributes["config"]; ok {
+		pairs, diags := hcl.ExprMap(attribute.Expr)
+		if diags.HasErrors() {
+			ref.Dynamic = append(ref.Dynamic, "config")
+		}
+		for _, pair := range pairs {
+			key, ok := objectKey(pair.Key)
+			if !ok {
+				continue
+			}
+			if value, ok := literalString(pair.Value); ok {
+				ref.Config[key] = value
+			} else {
+				ref.Dynamic = append(ref.Dynamic, "config."+key)
+			}
+		}
+	}
+
+	return ref
+}
+
+// objectKey returns the name of an object key, which HCL parses as a traversal, e.g. bucket in { bucket = "state" }
+func objectKey(expr hcl.Expression) (string, bool) {
+	if keyword := hcl.ExprAsKeyword(expr); keyword != "" {
+		return keyword, true
+	}
+	return literalString(expr)
+}
+
+// literalString evaluates an expression that does not reference anything to a string
+func literalString(expr hcl.Expression) (string, bool) {
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || value.IsNull() || !value.IsKnown() {
+		return "", false
+	}
+	if !value.Type().Equals(cty.String) {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// isTerraformFile reports whether a file name is a Terraform configuration file
+func isTerraformFile(name string) bool {
+	return strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json")
+}
+
+// isLocalModuleSource reports whether a module source refers to a local folder
+func isLocalModuleSource(source string) bool {
+	return strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// WorkspaceStrategy is how the workspace of a root module is named
+type WorkspaceStrategy string
+
+const (
+	// WorkspaceStrategyPath joins the path relative to the layout root with underscores
+	WorkspaceStrategyPath WorkspaceStrategy = "path"
+	// WorkspaceStrategyTemplate fills a template such as "{account}-{stack}" with the layout placeholders
+	WorkspaceStrategyTemplate WorkspaceStrategy = "template"
+	// WorkspaceStrategyHash suffixes the path name with a hash of the path so different paths get different names
+	WorkspaceStrategyHash WorkspaceStrategy = "hash"
+	// WorkspaceStrategyDefault keeps every root module on the default workspace
+	WorkspaceStrategyDefault WorkspaceStrategy = "default"
+)
+
+// WorkspaceStrategies lists the supported strategies
+func WorkspaceStrategies() []WorkspaceStrategy {
+	return []WorkspaceStrategy{WorkspaceStrategyPath, WorkspaceStrategyTemplate, WorkspaceStrategyHash, WorkspaceStrategyDefault}
+}
+
+// DefaultWorkspace is terraform's default workspace
+const DefaultWorkspace = "default"
+
+// workspacePlaceholderPattern matches the placeholders of a workspace template
+var workspacePlaceholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// invalidWorkspaceCharacters matches characters that are not allowed in workspace names
+var invalidWorkspaceCharacters = regexp.MustCompile(`[^A-Za-z0-9_.\-]`)
+
+// ValidateWorkspaceName rejects names terraform refuses, and any name that would resolve outside
+// the workspace directory of the local backend, such as "../x" or ".."
+func ValidateWorkspaceName(name string) error {
+	if name == "" {
+		return fmt.Errorf("workspace name cannot be empty")
+	}
+	if invalidWorkspaceCharacters.MatchString(name) {
+		return fmt.Errorf("workspace %q contains characters other than letters, digits, '_', '-' and '.'", name)
+	}
+	if name == "." || name == ".." {
+		return fmt.Errorf("workspace %q is not a valid name", name)
+	}
+	return nil
+}
+
+// WorkspaceNamer names the workspaces of root modules according to a strategy
+type WorkspaceNamer struct {
+	Layout   *Layout
+	Strategy WorkspaceStrategy
+	// Template is the workspace template of WorkspaceStrategyTemplate
+	Template string
+}
+
+// NewWorkspaceNamer creates a WorkspaceNamer after validating the strategy and template against the layout
+func NewWorkspaceNamer(layout *Layout, strategy WorkspaceStrategy, template string) (*WorkspaceNamer, error) {
+	if strategy == "" {
+		strategy = WorkspaceStrategyPath
+	}
+	if !slices.Contains(WorkspaceStrategies(), strategy) {
+		return nil, fmt.Errorf("unsupported workspace strategy %q", strategy)
+	}
+
+	if strategy == WorkspaceStrategyTemplate {
+		if template == "" {
+			return nil, fmt.Errorf("workspace strategy template requires a template")
+		}
+		for _, match := range workspacePlaceholderPattern.FindAllStringSubmatch(template, -1) {
+			if !layout.HasPlaceholder(match[1]) {
+				return nil, fmt.Errorf("workspace template %s uses {%s} which layout path template %s does not declare",
+					template, match[1], layout.Template)
+			}
+		}
+	} else if template != "" {
+		return nil, fmt.Errorf("a workspace template is only used by the template strategy, not %s", strategy)
+	}
+
+	return &WorkspaceNamer{Layout: layout, Strategy: strategy, Template: template}, nil
+}
+
+// Name returns the workspace of the root module in dir
+func (wn *WorkspaceNamer) Name(dir string) (string, error) {
+	relativePath, err := wn.Layout.RelativePath(dir)
+	if err != nil {
+		return "", err
+	}
+
+	switch wn.Strategy {
+	case WorkspaceStrategyDefault:
+		return DefaultWorkspace, nil
+	case WorkspaceStrategyTemplate:
+		values, ok := wn.Layout.Match(relativePath)
+		if !ok {
+			return "", fmt.Errorf("%s does not match layout path template %s", relativePath, wn.Layout.Template)
+		}
+		name := workspacePlaceholderPattern.ReplaceAllStringFunc(wn.Template, func(placeholder string) string {
+			return values[strings.Trim(placeholder, "{}")]
+		})
+		if invalidWorkspaceCharacters.MatchString(name) {
+			return "", fmt.Errorf("workspace %q of %s contains characters other than letters, digits, '_', '-' and '.'", name, relativePath)
+		}
+		return name, nil
+	case WorkspaceStrategyHash:
+		sum := sha256.Sum256([]byte(filepath.ToSlash(relativePath)))
+		return fmt.Sprintf("%s-%s", wn.Layout.Slug(relativePath), hex.EncodeToString(sum[:4])), nil
+	default:
+		return wn.Layout.Slug(relativePath), nil
+	}
+}
+
+// Index names the workspaces of the folders and fails when two folders would share a workspace.
+// The default strategy shares the default workspace by design and is never a collision.
+func (wn *WorkspaceNamer) Index(folders []string) (*WorkspaceIndex, error) {
+	index := &WorkspaceIndex{folders: map[string]string{}, names: map[string]string{}}
+	var collisions []string
+	for _, folder := range folders {
+		name, err := wn.Name(folder)
+		if err != nil {
+			return nil, err
+		}
+		index.names[folder] = name
+
+		if other, ok := index.folders[name]; ok && wn.Strategy != WorkspaceStrategyDefault {
+			collisions = append(collisions, fmt.Sprintf("workspace %s is used by both %s and %s", name, other, folder))
+			continue
+		}
+		index.folders[name] = folder
+	}
+
+	if len(collisions) > 0 {
+		return nil, fmt.Errorf("workspace names collide with strategy %s:\n  %s", wn.Strategy, strings.Join(collisions, "\n  "))
+	}
+	return index, nil
+}
+
+// WorkspaceIndex maps root modules to their workspaces and back
+type WorkspaceIndex struct {
+	folders map[string]string
+	names   map[string]string
+}
+
+// Folder returns the root module using a workspace, the first one for the default strategy
+func (wi *WorkspaceIndex) Folder(name string) (string, bool) {
+	folder, ok := wi.folders[name]
+	return folder, ok
+}
+
+// Name returns the workspace of a root module
+func (wi *WorkspaceIndex) Name(folder string) (string, bool) {
+	name, ok := wi.names[folder]
+	return name, ok
+}
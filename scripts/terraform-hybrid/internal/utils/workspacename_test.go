@@ -0,0 +1,93 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WorkspaceNamer", func() {
+	var layout *Layout
+
+	BeforeEach(func() {
+		var err error
+		layout, err = NewLayout("/repo/live", "{provider}/{account}/**", nil)
+		Expect(err).To(BeNil())
+	})
+
+	namer := func(strategy WorkspaceStrategy, template string) *WorkspaceNamer {
+		wn, err := NewWorkspaceNamer(layout, strategy, template)
+		Expect(err).To(BeNil())
+		return wn
+	}
+
+	DescribeTable("should name workspaces",
+		func(strategy WorkspaceStrategy, template, dir, expected string) {
+			Expect(namer(strategy, template).Name(dir)).To(Equal(expected))
+		},
+		Entry("path by default", WorkspaceStrategy(""), "", "/repo/live/aws/prod/network", "aws_prod_network"),
+		Entry("path", WorkspaceStrategyPath, "", "/repo/live/aws/prod/network", "aws_prod_network"),
+		Entry("template", WorkspaceStrategyTemplate, "{account}-{provider}", "/repo/live/aws/prod/network", "prod-aws"),
+		Entry("hash", WorkspaceStrategyHash, "", "/repo/live/aws/prod/network", "aws_prod_network-92fa455e"),
+		Entry("default", WorkspaceStrategyDefault, "", "/repo/live/aws/prod/network", "default"),
+	)
+
+	It("should reject unknown strategies", func() {
+		_, err := NewWorkspaceNamer(layout, "random", "")
+		Expect(err).To(MatchError(`unsupported workspace strategy "random"`))
+	})
+
+	It("should reject templates using placeholders the layout does not declare", func() {
+		_, err := NewWorkspaceNamer(layout, WorkspaceStrategyTemplate, "{account}-{stack}")
+		Expect(err).To(MatchError(ContainSubstring("uses {stack}")))
+	})
+
+	It("should require a template only for the template strategy", func() {
+		_, err := NewWorkspaceNamer(layout, WorkspaceStrategyTemplate, "")
+		Expect(err).To(HaveOccurred())
+		_, err = NewWorkspaceNamer(layout, WorkspaceStrategyPath, "{account}")
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("should reject workspace names outside the workspace directory",
+		func(name string) {
+			Expect(ValidateWorkspaceName(name)).To(HaveOccurred())
+		},
+		Entry("empty", ""),
+		Entry("parent", ".."),
+		Entry("current", "."),
+		Entry("traversal", "../../x"),
+		Entry("separator", "a/b"),
+	)
+
+	It("should accept workspace names terraform accepts", func() {
+		Expect(ValidateWorkspaceName("aws_prod.network-1")).To(Succeed())
+	})
+
+	Describe("Index", func() {
+		folders := []string{"/repo/live/aws/a_b/c", "/repo/live/aws/a/b_c"}
+
+		It("should report folders sharing a workspace", func() {
+			_, err := namer(WorkspaceStrategyPath, "").Index(folders)
+			Expect(err).To(MatchError(ContainSubstring("workspace aws_a_b_c is used by both /repo/live/aws/a_b/c and /repo/live/aws/a/b_c")))
+		})
+
+		It("should avoid collisions with the hash strategy and look folders up by workspace", func() {
+			index, err := namer(WorkspaceStrategyHash, "").Index(folders)
+			Expect(err).To(BeNil())
+
+			name, ok := index.Name(folders[1])
+			Expect(ok).To(BeTrue())
+			folder, ok := index.Folder(name)
+			Expect(ok).To(BeTrue())
+			Expect(folder).To(Equal(folders[1]))
+
+			_, ok = index.Folder("aws_a_b_c")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should let every folder share the default workspace", func() {
+			_, err := namer(WorkspaceStrategyDefault, "").Index(folders)
+			Expect(err).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,73 @@
+package workspace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+)
+
+// ErrUnsupportedBackend is returned for backends whose workspaces are only managed through terraform
+var ErrUnsupportedBackend = errors.New("workspaces of this backend are managed through terraform")
+
+// ErrStateChanged is returned when a workspace is deleted after its state changed since it was read
+var ErrStateChanged = errors.New("the state changed since it was checked")
+
+// Backend stores the workspaces of root modules the way terraform's backend of the same type does
+type Backend interface {
+	// List returns the workspaces available to the root module in dir, without the default workspace
+	List(ctx context.Context, dir string) ([]string, error)
+	// Create creates a workspace with an empty state
+	Create(ctx context.Context, dir, name string) error
+	// State returns the state of a workspace, nil when it has none
+	State(ctx context.Context, dir, name string) ([]byte, error)
+	// Lock locks the state of a workspace for an operation, returning a function releasing the lock
+	Lock(ctx context.Context, dir, name string, info *LockInfo) (func() error, error)
+	// Delete removes a workspace and its state, provided the state is still expected, e.g. the state
+	// checked for resources, and fails with ErrStateChanged otherwise
+	Delete(ctx context.Context, dir, name string, expected []byte) error
+	// Close releases the connections of the backend
+	Close() error
+}
+
+// NewBackend returns the Backend of the configured backend type, or ErrUnsupportedBackend
+func NewBackend(cfg *config.TerraformHybridConfig) (Backend, error) {
+	switch backend := cfg.Global.Backend.(type) {
+	case *config.LocalBackendConfig:
+		return NewLocalBackend(), nil
+	case *config.PostgresBackendConfig:
+		return NewPostgresBackend(backend.ConnectionString, backend.SchemaName)
+	default:
+		return nil, fmt.Errorf("%s: %w", cfg.Global.BackendType, ErrUnsupportedBackend)
+	}
+}
+
+// emptyState returns the state terraform writes when it creates a workspace
+func emptyState() ([]byte, error) {
+	lineage, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"version":   4,
+		"serial":    1,
+		"lineage":   lineage,
+		"outputs":   map[string]interface{}{},
+		"resources": []interface{}{},
+	}, "", "  ")
+}
+
+// newUUID returns a random UUID, e.g. the lineage of a new state
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("error generating UUID: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,158 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+)
+
+// localWorkspaceDir is where the local backend keeps the states of workspaces other than default
+const localWorkspaceDir = "terraform.tfstate.d"
+
+// LocalBackend stores workspaces in terraform.tfstate.d/<workspace>/terraform.tfstate of the root module
+type LocalBackend struct{}
+
+// NewLocalBackend creates a LocalBackend
+func NewLocalBackend() *LocalBackend {
+	return &LocalBackend{}
+}
+
+// List returns the workspace directories of the root module
+func (lb *LocalBackend) List(_ context.Context, dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, localWorkspaceDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing workspaces: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// stateDir returns the directory of a workspace's state, refusing names that resolve outside terraform.tfstate.d
+func (lb *LocalBackend) stateDir(dir, name string) (string, error) {
+	if err := utils.ValidateWorkspaceName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, localWorkspaceDir, name), nil
+}
+
+// Create writes an empty state for the workspace
+func (lb *LocalBackend) Create(_ context.Context, dir, name string) error {
+	stateDir, err := lb.stateDir(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("error creating workspace %s: %v", name, err)
+	}
+
+	state, err := emptyState()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(stateDir, "terraform.tfstate"), state, 0644); err != nil {
+		return fmt.Errorf("error writing state of workspace %s: %v", name, err)
+	}
+	return nil
+}
+
+// State reads terraform.tfstate.d/<workspace>/terraform.tfstate
+func (lb *LocalBackend) State(_ context.Context, dir, name string) ([]byte, error) {
+	stateDir, err := lb.stateDir(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(stateDir, "terraform.tfstate"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state of workspace %s: %v", name, err)
+	}
+	return data, nil
+}
+
+// Lock writes the lock info file terraform writes next to a locked state, failing when it exists
+func (lb *LocalBackend) Lock(_ context.Context, dir, name string, info *LockInfo) (func() error, error) {
+	stateDir, err := lb.stateDir(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	statePath := filepath.Join(stateDir, "terraform.tfstate")
+	lockPath := filepath.Join(filepath.Dir(statePath), ".terraform.tfstate.lock.info")
+	info.Path = statePath
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding lock info: %v", err)
+	}
+
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		locked := &LockedError{Workspace: name}
+		if existing, readErr := os.ReadFile(lockPath); readErr == nil {
+			var holder LockInfo
+			if json.Unmarshal(existing, &holder) == nil {
+				locked.Holder = &holder
+			}
+		}
+		return nil, locked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error locking workspace %s: %v", name, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return nil, fmt.Errorf("error locking workspace %s: %v", name, err)
+	}
+
+	return func() error {
+		// Deleting the workspace removes the lock with it
+		if err := os.Remove(lockPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error unlocking workspace %s: %v", name, err)
+		}
+		return nil
+	}, nil
+}
+
+// Delete removes the workspace directory and its state, unless the state differs from the expected one
+func (lb *LocalBackend) Delete(ctx context.Context, dir, name string, expected []byte) error {
+	stateDir, err := lb.stateDir(dir, name)
+	if err != nil {
+		return err
+	}
+	state, err := lb.State(ctx, dir, name)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(state, expected) {
+		return fmt.Errorf("error deleting workspace %s: %w", name, ErrStateChanged)
+	}
+	if err := os.RemoveAll(stateDir); err != nil {
+		return fmt.Errorf("error deleting workspace %s: %v", name, err)
+	}
+	return nil
+}
+
+// Close does nothing for the local backend
+func (lb *LocalBackend) Close() error {
+	return nil
+}
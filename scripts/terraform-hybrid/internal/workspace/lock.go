@@ -0,0 +1,42 @@
+package workspace
+
+import (
+	"fmt"
+	"time"
+)
+
+// LockInfo describes the holder of a workspace lock, with the fields terraform writes to lock files
+type LockInfo struct {
+	ID        string    `json:"ID"`
+	Operation string    `json:"Operation"`
+	Info      string    `json:"Info"`
+	Who       string    `json:"Who"`
+	Version   string    `json:"Version"`
+	Created   time.Time `json:"Created"`
+	Path      string    `json:"Path"`
+}
+
+// NewLockInfo creates the LockInfo of an operation run by who
+func NewLockInfo(operation, who string) (*LockInfo, error) {
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &LockInfo{ID: id, Operation: operation, Info: "terraform-hybrid", Who: who, Created: time.Now().UTC()}, nil
+}
+
+// LockedError reports a workspace locked by someone else
+type LockedError struct {
+	Workspace string
+	// Holder is the lock of the other party when the backend records it
+	Holder *LockInfo
+}
+
+// Error names the holder of the lock when known
+func (le *LockedError) Error() string {
+	if le.Holder == nil {
+		return fmt.Sprintf("workspace %s is locked by another session", le.Workspace)
+	}
+	return fmt.Sprintf("workspace %s is locked by %s for %s since %s (lock ID %s)",
+		le.Workspace, le.Holder.Who, le.Holder.Operation, le.Holder.Created.Format(time.RFC3339), le.Holder.ID)
+}
@@ -0,0 +1,178 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/utils"
+)
+
+// environmentFile records the selected workspace of a root module, relative to the module
+var environmentFile = filepath.Join(".terraform", "environment")
+
+// Manager lists, selects, creates and deletes the workspaces of root modules without running terraform
+type Manager struct {
+	Backend Backend
+}
+
+// NewManager creates a Manager storing workspaces in a Backend
+func NewManager(backend Backend) *Manager {
+	return &Manager{Backend: backend}
+}
+
+// List returns the workspaces of the root module in dir, starting with the default workspace
+func (m *Manager) List(ctx context.Context, dir string) ([]string, error) {
+	names, err := m.Backend.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{utils.DefaultWorkspace}, names...), nil
+}
+
+// Current returns the selected workspace of the root module in dir.
+// Like terraform, TF_WORKSPACE takes precedence over the selection recorded in .terraform/environment.
+func (m *Manager) Current(dir string) (string, error) {
+	if name := os.Getenv("TF_WORKSPACE"); name != "" {
+		return name, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, environmentFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return utils.DefaultWorkspace, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading selected workspace: %v", err)
+	}
+	if name := strings.TrimSpace(string(data)); name != "" {
+		return name, nil
+	}
+	return utils.DefaultWorkspace, nil
+}
+
+// Select records an existing workspace as the selected workspace of the root module
+func (m *Manager) Select(ctx context.Context, dir, name string) error {
+	exists, err := m.exists(ctx, dir, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("workspace %s does not exist", name)
+	}
+	return m.selectWorkspace(dir, name)
+}
+
+// Create creates a workspace and selects it
+func (m *Manager) Create(ctx context.Context, dir, name string) error {
+	exists, err := m.exists(ctx, dir, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("workspace %s already exists", name)
+	}
+
+	if err := m.Backend.Create(ctx, dir, name); err != nil {
+		return err
+	}
+	return m.selectWorkspace(dir, name)
+}
+
+// SelectOrCreate selects a workspace, creating it first when it does not exist
+func (m *Manager) SelectOrCreate(ctx context.Context, dir, name string) error {
+	exists, err := m.exists(ctx, dir, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := m.Backend.Create(ctx, dir, name); err != nil {
+			return err
+		}
+	}
+	return m.selectWorkspace(dir, name)
+}
+
+// Delete deletes a workspace other than the default and the selected workspace whose state is still expected
+func (m *Manager) Delete(ctx context.Context, dir, name string, expected []byte) error {
+	if name == utils.DefaultWorkspace {
+		return fmt.Errorf("the default workspace cannot be deleted")
+	}
+
+	current, err := m.Current(dir)
+	if err != nil {
+		return err
+	}
+	if current == name {
+		return fmt.Errorf("workspace %s is selected, select another workspace before deleting it", name)
+	}
+
+	exists, err := m.exists(ctx, dir, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("workspace %s does not exist", name)
+	}
+	return m.Backend.Delete(ctx, dir, name, expected)
+}
+
+// State returns the state of an existing workspace, nil when it has none
+func (m *Manager) State(ctx context.Context, dir, name string) ([]byte, error) {
+	exists, err := m.exists(ctx, dir, name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("workspace %s does not exist", name)
+	}
+	return m.Backend.State(ctx, dir, name)
+}
+
+// Lock locks the state of an existing workspace for an operation run by who
+func (m *Manager) Lock(ctx context.Context, dir, name, operation, who string) (func() error, error) {
+	exists, err := m.exists(ctx, dir, name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("workspace %s does not exist", name)
+	}
+
+	info, err := NewLockInfo(operation, who)
+	if err != nil {
+		return nil, err
+	}
+	return m.Backend.Lock(ctx, dir, name, info)
+}
+
+// exists reports whether the root module has a workspace
+func (m *Manager) exists(ctx context.Context, dir, name string) (bool, error) {
+	names, err := m.List(ctx, dir)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(names, name), nil
+}
+
+// selectWorkspace writes the selected workspace to .terraform/environment
+func (m *Manager) selectWorkspace(dir, name string) error {
+	path := filepath.Join(dir, environmentFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error selecting workspace %s: %v", name, err)
+	}
+	if name == utils.DefaultWorkspace {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error selecting workspace %s: %v", name, err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+		return fmt.Errorf("error selecting workspace %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// PostgresBackend stores workspaces as rows of the <schema>.states table used by terraform's pg backend.
+// Every root module shares the table, so List returns the workspaces of all of them.
+type PostgresBackend struct {
+	db     *sql.DB
+	schema string
+}
+
+// NewPostgresBackend connects to the database of the pg backend
+func NewPostgresBackend(connectionString, schema string) (*PostgresBackend, error) {
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to postgres: %v", err)
+	}
+	return newPostgresBackend(db, schema), nil
+}
+
+// newPostgresBackend creates a PostgresBackend using an open database
+func newPostgresBackend(db *sql.DB, schema string) *PostgresBackend {
+	return &PostgresBackend{db: db, schema: schema}
+}
+
+// table returns the quoted name of the states table
+func (pb *PostgresBackend) table() string {
+	return pq.QuoteIdentifier(pb.schema) + ".states"
+}
+
+// List returns the workspaces stored in the states table
+func (pb *PostgresBackend) List(ctx context.Context, _ string) ([]string, error) {
+	rows, err := pb.db.QueryContext(ctx, fmt.Sprintf("SELECT name FROM %s WHERE name <> 'default' ORDER BY name", pb.table()))
+	if err != nil {
+		return nil, fmt.Errorf("error listing workspaces: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error listing workspaces: %v", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing workspaces: %v", err)
+	}
+	return names, nil
+}
+
+// Create inserts a row with an empty state for the workspace
+func (pb *PostgresBackend) Create(ctx context.Context, _, name string) error {
+	state, err := emptyState()
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (name, data) VALUES ($1, $2)", pb.table())
+	if _, err := pb.db.ExecContext(ctx, query, name, string(state)); err != nil {
+		return fmt.Errorf("error creating workspace %s: %v", name, err)
+	}
+	return nil
+}
+
+// State reads the data column of the workspace row
+func (pb *PostgresBackend) State(ctx context.Context, _, name string) ([]byte, error) {
+	var data sql.NullString
+	query := fmt.Sprintf("SELECT data FROM %s WHERE name = $1", pb.table())
+	err := pb.db.QueryRowContext(ctx, query, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !data.Valid) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state of workspace %s: %v", name, err)
+	}
+	return []byte(data.String), nil
+}
+
+// Lock takes the session advisory lock terraform's pg backend takes on the row id of the workspace.
+// Postgres does not store lock info, so the holder is named in the application_name of the session,
+// where pg_stat_activity shows it.
+func (pb *PostgresBackend) Lock(ctx context.Context, _, name string, info *LockInfo) (func() error, error) {
+	conn, err := pb.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error locking workspace %s: %v", name, err)
+	}
+
+	applicationName := fmt.Sprintf("terraform-hybrid: %s by %s", info.Operation, info.Who)
+	if _, err := conn.ExecContext(ctx, "SELECT set_config('application_name', $1, false)", applicationName); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error locking workspace %s: %v", name, err)
+	}
+
+	var id int64
+	var locked bool
+	query := fmt.Sprintf("SELECT id, pg_try_advisory_lock(id) FROM %s WHERE name = $1", pb.table())
+	if err := conn.QueryRowContext(ctx, query, name).Scan(&id, &locked); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error locking workspace %s: %v", name, err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, &LockedError{Workspace: name}
+	}
+
+	return func() error {
+		defer conn.Close()
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", id); err != nil {
+			return fmt.Errorf("error unlocking workspace %s: %v", name, err)
+		}
+		return nil
+	}, nil
+}
+
+// Delete removes the row of the workspace in the same statement that checks its data is still the expected state
+func (pb *PostgresBackend) Delete(ctx context.Context, _, name string, expected []byte) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE name = $1 AND data IS NOT DISTINCT FROM $2", pb.table())
+	result, err := pb.db.ExecContext(ctx, query, name, sql.NullString{String: string(expected), Valid: expected != nil})
+	if err != nil {
+		return fmt.Errorf("error deleting workspace %s: %v", name, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting workspace %s: %v", name, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("error deleting workspace %s: %w", name, ErrStateChanged)
+	}
+	return nil
+}
+
+// Close closes the database connections
+func (pb *PostgresBackend) Close() error {
+	return pb.db.Close()
+}
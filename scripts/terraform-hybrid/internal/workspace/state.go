@@ -0,0 +1,72 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BackupDir is where states are backed up before their workspace is deleted by default. It lies in the
+// user cache directory rather than in the root module, so that states and their secrets stay out of git.
+func BackupDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding the backup directory, pass one: %v", err)
+	}
+	return filepath.Join(cacheDir, "terraform-hybrid", "backups"), nil
+}
+
+// stateFile is the part of a terraform state file needed to tell whether it tracks resources
+type stateFile struct {
+	Resources []struct {
+		Mode      string            `json:"mode"`
+		Instances []json.RawMessage `json:"instances"`
+	} `json:"resources"`
+}
+
+// CountResources returns the number of managed resource instances a state tracks.
+// Data sources are not counted, as terraform does not count them when deleting a workspace.
+func CountResources(state []byte) (int, error) {
+	if len(state) == 0 {
+		return 0, nil
+	}
+
+	var parsed stateFile
+	if err := json.Unmarshal(state, &parsed); err != nil {
+		return 0, fmt.Errorf("error parsing state: %v", err)
+	}
+
+	count := 0
+	for _, resource := range parsed.Resources {
+		if resource.Mode == "managed" {
+			count += len(resource.Instances)
+		}
+	}
+	return count, nil
+}
+
+// WriteBackup saves the state of a workspace to <backupDir>/<workspace>-<UTC time>.tfstate and returns the path.
+// An empty backupDir is the default BackupDir, and a relative one is resolved against the root module in dir.
+func WriteBackup(dir, backupDir, name string, state []byte, now time.Time) (string, error) {
+	if backupDir == "" {
+		defaultDir, err := BackupDir()
+		if err != nil {
+			return "", err
+		}
+		backupDir = defaultDir
+	}
+	if !filepath.IsAbs(backupDir) {
+		backupDir = filepath.Join(dir, backupDir)
+	}
+	if err := os.MkdirAll(backupDir, 0700); err != nil {
+		return "", fmt.Errorf("error creating backup directory: %v", err)
+	}
+
+	path := filepath.Join(backupDir, fmt.Sprintf("%s-%s.tfstate", name, now.UTC().Format("20060102T150405Z")))
+	if err := os.WriteFile(path, state, 0600); err != nil {
+		return "", fmt.Errorf("error backing up state of workspace %s: %v", name, err)
+	}
+	return path, nil
+}
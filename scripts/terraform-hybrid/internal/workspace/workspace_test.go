@@ -0,0 +1,291 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/msharbaji/terraform-state-migration/terraform-hybrid/internal/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWorkspace(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Workspace Suite")
+}
+
+var _ = Describe("Manager", func() {
+	var (
+		ctx     context.Context
+		dir     string
+		manager *Manager
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dir = GinkgoT().TempDir()
+		manager = NewManager(NewLocalBackend())
+		GinkgoT().Setenv("TF_WORKSPACE", "")
+	})
+
+	Describe("with the local backend", func() {
+		It("should start on the default workspace", func() {
+			Expect(manager.List(ctx, dir)).To(Equal([]string{"default"}))
+			Expect(manager.Current(dir)).To(Equal("default"))
+		})
+
+		It("should create and select a workspace with an empty state", func() {
+			Expect(manager.Create(ctx, dir, "dev")).To(Succeed())
+
+			Expect(manager.List(ctx, dir)).To(Equal([]string{"default", "dev"}))
+			Expect(manager.Current(dir)).To(Equal("dev"))
+			Expect(os.ReadFile(filepath.Join(dir, ".terraform", "environment"))).To(Equal([]byte("dev")))
+
+			data, err := os.ReadFile(filepath.Join(dir, "terraform.tfstate.d", "dev", "terraform.tfstate"))
+			Expect(err).NotTo(HaveOccurred())
+			var state map[string]interface{}
+			Expect(json.Unmarshal(data, &state)).To(Succeed())
+			Expect(state).To(HaveKeyWithValue("version", BeNumerically("==", 4)))
+			Expect(state).To(HaveKeyWithValue("lineage", MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)))
+		})
+
+		It("should refuse to create an existing workspace", func() {
+			Expect(manager.Create(ctx, dir, "dev")).To(Succeed())
+			Expect(manager.Create(ctx, dir, "dev")).To(MatchError("workspace dev already exists"))
+		})
+
+		It("should only select existing workspaces", func() {
+			Expect(manager.Select(ctx, dir, "dev")).To(MatchError("workspace dev does not exist"))
+
+			Expect(manager.Create(ctx, dir, "dev")).To(Succeed())
+			Expect(manager.Select(ctx, dir, "default")).To(Succeed())
+			Expect(manager.Current(dir)).To(Equal("default"))
+			Expect(filepath.Join(dir, ".terraform", "environment")).NotTo(BeAnExistingFile())
+		})
+
+		It("should select or create a workspace", func() {
+			Expect(manager.SelectOrCreate(ctx, dir, "dev")).To(Succeed())
+			Expect(manager.SelectOrCreate(ctx, dir, "dev")).To(Succeed())
+			Expect(manager.List(ctx, dir)).To(Equal([]string{"default", "dev"}))
+			Expect(manager.Current(dir)).To(Equal("dev"))
+		})
+
+		It("should delete a workspace that is not selected", func() {
+			Expect(manager.Create(ctx, dir, "dev")).To(Succeed())
+			state, err := manager.State(ctx, dir, "dev")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manager.Delete(ctx, dir, "dev", state)).To(MatchError(ContainSubstring("workspace dev is selected")))
+
+			Expect(manager.Select(ctx, dir, "default")).To(Succeed())
+			Expect(manager.Delete(ctx, dir, "dev", state)).To(Succeed())
+			Expect(manager.List(ctx, dir)).To(Equal([]string{"default"}))
+			Expect(filepath.Join(dir, "terraform.tfstate.d", "dev")).NotTo(BeADirectory())
+		})
+
+		It("should refuse to delete the default or a missing workspace", func() {
+			Expect(manager.Delete(ctx, dir, "default", nil)).To(MatchError("the default workspace cannot be deleted"))
+			Expect(manager.Delete(ctx, dir, "dev", nil)).To(MatchError("workspace dev does not exist"))
+		})
+
+		It("should refuse to delete a workspace whose state changed since it was read", func() {
+			Expect(manager.Create(ctx, dir, "dev")).To(Succeed())
+			Expect(manager.Select(ctx, dir, "default")).To(Succeed())
+			state, err := manager.State(ctx, dir, "dev")
+			Expect(err).NotTo(HaveOccurred())
+			statePath := filepath.Join(dir, "terraform.tfstate.d", "dev", "terraform.tfstate")
+			Expect(os.WriteFile(statePath, []byte(`{"version": 4, "serial": 2}`), 0644)).To(Succeed())
+
+			Expect(manager.Delete(ctx, dir, "dev", state)).To(MatchError(ErrStateChanged))
+			Expect(statePath).To(BeAnExistingFile())
+		})
+
+		It("should refuse names outside terraform.tfstate.d", func() {
+			outside := filepath.Join(dir, "outside")
+			Expect(os.MkdirAll(outside, 0755)).To(Succeed())
+
+			backend := NewLocalBackend()
+			Expect(backend.Create(ctx, dir, "../outside/x")).To(HaveOccurred())
+			Expect(backend.Delete(ctx, dir, "../outside", nil)).To(HaveOccurred())
+			Expect(backend.Delete(ctx, dir, "..", nil)).To(HaveOccurred())
+			Expect(outside).To(BeADirectory())
+			Expect(filepath.Join(outside, "x")).NotTo(BeADirectory())
+		})
+
+		It("should lock the state of a workspace with a terraform lock info file", func() {
+			Expect(manager.Create(ctx, dir, "dev")).To(Succeed())
+			lockFile := filepath.Join(dir, "terraform.tfstate.d", "dev", ".terraform.tfstate.lock.info")
+
+			unlock, err := manager.Lock(ctx, dir, "dev", "workspace delete", "alice")
+			Expect(err).NotTo(HaveOccurred())
+			data, err := os.ReadFile(lockFile)
+			Expect(err).NotTo(HaveOccurred())
+			var info LockInfo
+			Expect(json.Unmarshal(data, &info)).To(Succeed())
+			Expect(info.Who).To(Equal("alice"))
+			Expect(info.Operation).To(Equal("workspace delete"))
+
+			_, err = manager.Lock(ctx, dir, "dev", "workspace delete", "bob")
+			Expect(err).To(MatchError(ContainSubstring("workspace dev is locked by alice for workspace delete since")))
+
+			Expect(unlock()).To(Succeed())
+			Expect(lockFile).NotTo(BeAnExistingFile())
+		})
+
+		It("should prefer TF_WORKSPACE as the current workspace", func() {
+			GinkgoT().Setenv("TF_WORKSPACE", "ci")
+			Expect(manager.Current(dir)).To(Equal("ci"))
+		})
+	})
+
+	Describe("with the pg backend", func() {
+		var mock sqlmock.Sqlmock
+
+		BeforeEach(func() {
+			db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			Expect(err).NotTo(HaveOccurred())
+			mock = sqlMock
+			manager = NewManager(newPostgresBackend(db, "terraform_remote_state"))
+		})
+
+		AfterEach(func() {
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+
+		listQuery := `SELECT name FROM "terraform_remote_state".states WHERE name <> 'default' ORDER BY name`
+
+		It("should list the rows of the states table", func() {
+			mock.ExpectQuery(listQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("aws_dev_network").AddRow("aws_prod_network"))
+			Expect(manager.List(ctx, dir)).To(Equal([]string{"default", "aws_dev_network", "aws_prod_network"}))
+		})
+
+		It("should insert a row for a new workspace and select it", func() {
+			mock.ExpectQuery(listQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}))
+			mock.ExpectExec(`INSERT INTO "terraform_remote_state".states (name, data) VALUES ($1, $2)`).
+				WithArgs("aws_dev_network", sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+
+			Expect(manager.Create(ctx, dir, "aws_dev_network")).To(Succeed())
+			Expect(manager.Current(dir)).To(Equal("aws_dev_network"))
+		})
+
+		It("should delete the row of a workspace", func() {
+			mock.ExpectQuery(listQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("aws_dev_network"))
+			mock.ExpectExec(`DELETE FROM "terraform_remote_state".states WHERE name = $1 AND data IS NOT DISTINCT FROM $2`).
+				WithArgs("aws_dev_network", `{"version": 4}`).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			Expect(manager.Delete(ctx, dir, "aws_dev_network", []byte(`{"version": 4}`))).To(Succeed())
+		})
+
+		It("should not delete the row when its data changed since it was read", func() {
+			mock.ExpectQuery(listQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("aws_dev_network"))
+			mock.ExpectExec(`DELETE FROM "terraform_remote_state".states WHERE name = $1 AND data IS NOT DISTINCT FROM $2`).
+				WithArgs("aws_dev_network", nil).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+
+			Expect(manager.Delete(ctx, dir, "aws_dev_network", nil)).To(MatchError(ErrStateChanged))
+		})
+
+		It("should read the state of a workspace", func() {
+			mock.ExpectQuery(listQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("aws_dev_network"))
+			mock.ExpectQuery(`SELECT data FROM "terraform_remote_state".states WHERE name = $1`).
+				WithArgs("aws_dev_network").
+				WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(`{"version": 4}`))
+
+			Expect(manager.State(ctx, dir, "aws_dev_network")).To(Equal([]byte(`{"version": 4}`)))
+		})
+
+		It("should take an advisory lock on the workspace row naming the holder", func() {
+			mock.ExpectQuery(listQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("aws_dev_network"))
+			mock.ExpectExec(`SELECT set_config('application_name', $1, false)`).
+				WithArgs("terraform-hybrid: workspace delete by alice").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT id, pg_try_advisory_lock(id) FROM "terraform_remote_state".states WHERE name = $1`).
+				WithArgs("aws_dev_network").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "pg_try_advisory_lock"}).AddRow(7, true))
+			mock.ExpectExec(`SELECT pg_advisory_unlock($1)`).WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			unlock, err := manager.Lock(ctx, dir, "aws_dev_network", "workspace delete", "alice")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(unlock()).To(Succeed())
+		})
+
+		It("should fail when another session holds the lock", func() {
+			mock.ExpectQuery(listQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("aws_dev_network"))
+			mock.ExpectExec(`SELECT set_config('application_name', $1, false)`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT id, pg_try_advisory_lock(id) FROM "terraform_remote_state".states WHERE name = $1`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "pg_try_advisory_lock"}).AddRow(7, false))
+
+			_, err := manager.Lock(ctx, dir, "aws_dev_network", "workspace delete", "alice")
+			Expect(err).To(MatchError("workspace aws_dev_network is locked by another session"))
+		})
+
+		It("should return database errors", func() {
+			mock.ExpectQuery(listQuery).WillReturnError(errors.New("relation does not exist"))
+			Expect(manager.Select(ctx, dir, "dev")).To(MatchError("error listing workspaces: relation does not exist"))
+		})
+	})
+
+	Describe("CountResources", func() {
+		It("should count managed resource instances only", func() {
+			Expect(CountResources([]byte(`{"resources": [
+				{"mode": "managed", "instances": [{}, {}]},
+				{"mode": "data", "instances": [{}]}
+			]}`))).To(Equal(2))
+		})
+
+		It("should count nothing in an empty or missing state", func() {
+			state, err := emptyState()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(CountResources(state)).To(Equal(0))
+			Expect(CountResources(nil)).To(Equal(0))
+		})
+
+		It("should fail on an invalid state", func() {
+			_, err := CountResources([]byte("not json"))
+			Expect(err).To(MatchError(ContainSubstring("error parsing state")))
+		})
+	})
+
+	Describe("WriteBackup", func() {
+		It("should write the state to the user cache directory by default", func() {
+			cacheDir := GinkgoT().TempDir()
+			GinkgoT().Setenv("XDG_CACHE_HOME", cacheDir)
+			GinkgoT().Setenv("HOME", cacheDir)
+			backupDir, err := BackupDir()
+			Expect(err).NotTo(HaveOccurred())
+
+			now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+			path, err := WriteBackup(dir, "", "dev", []byte("state"), now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(path).To(Equal(filepath.Join(backupDir, "dev-20240501T123000Z.tfstate")))
+			Expect(path).NotTo(HavePrefix(dir))
+			Expect(os.ReadFile(path)).To(Equal([]byte("state")))
+		})
+
+		It("should write the state relative to the root module", func() {
+			now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+			path, err := WriteBackup(dir, "backups", "dev", []byte("state"), now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(path).To(Equal(filepath.Join(dir, "backups", "dev-20240501T123000Z.tfstate")))
+		})
+	})
+
+	Describe("NewBackend", func() {
+		It("should not manage cloud storage workspaces", func() {
+			cfg := &config.TerraformHybridConfig{Global: config.GlobalConfig{
+				BackendType: config.BackendTypeCloudStorage,
+				Backend:     &config.CloudStorageBackendConfig{},
+			}}
+			_, err := NewBackend(cfg)
+			Expect(errors.Is(err, ErrUnsupportedBackend)).To(BeTrue())
+		})
+	})
+})